@@ -0,0 +1,309 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/hotcache"
+	"github.com/ethereum/go-ethereum/hotcache/witness"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/urfave/cli/v2"
+)
+
+var blockRunnerCommand = &cli.Command{
+	Action:    blockRunnerCmd,
+	Name:      "blockrunner",
+	Usage:     "executes captured blocks on their witnesses",
+	ArgsUsage: "<witness file>",
+	Flags: []cli.Flag{
+		NetworkFlag,
+		BlockNumberFlag,
+		AccessSetsFlag,
+		TimingsFlag,
+	},
+	Description: `
+The blockrunner command replays the blocks of a witness file written by
+'geth capture --capture.witness' without the chain database. Every block is
+executed by the state processor of an in-memory chain holding nothing but the
+block's witness, and the resulting state root and gas used are checked against
+the block header. The chain configuration and genesis are the ones of --network,
+or of the --prestate genesis file if given.`,
+}
+
+// BlockrunnerResult contains the outcome of replaying a single block, and the
+// per-transaction details asked for on the command line.
+type BlockrunnerResult struct {
+	Number  uint64           `json:"number"`
+	Hash    common.Hash      `json:"hash"`
+	Pass    bool             `json:"pass"`
+	Error   string           `json:"error,omitempty"`
+	GasUsed uint64           `json:"gasUsed"`
+	Elapsed time.Duration    `json:"elapsed"`
+	Txs     []*BlockrunnerTx `json:"txs,omitempty"`
+}
+
+// BlockrunnerTx holds the access set and execution times of a transaction.
+type BlockrunnerTx struct {
+	Index   int         `json:"index"`
+	Hash    common.Hash `json:"hash"`
+	Status  uint64      `json:"status"`
+	GasUsed uint64      `json:"gasUsed"`
+
+	Time      time.Duration `json:"time,omitempty"`
+	EVM       time.Duration `json:"evm,omitempty"`
+	StateRead time.Duration `json:"stateRead,omitempty"`
+	Hashing   time.Duration `json:"hashing,omitempty"`
+	OpCount   uint64        `json:"opCount,omitempty"`
+
+	Reads        []string `json:"reads,omitempty"`
+	Writes       []string `json:"writes,omitempty"`
+	SilentWrites []string `json:"silentWrites,omitempty"`
+	Reverted     []string `json:"reverted,omitempty"`
+}
+
+func blockRunnerCmd(ctx *cli.Context) error {
+	if len(ctx.Args().First()) == 0 {
+		return errors.New("path-to-witness-file argument required")
+	}
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.Int(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	var genesis *core.Genesis
+	if ctx.IsSet(GenesisFlag.Name) {
+		genesis = readGenesis(ctx.String(GenesisFlag.Name))
+	} else {
+		switch network := ctx.String(NetworkFlag.Name); network {
+		case "mainnet":
+			genesis = core.DefaultGenesisBlock()
+		case "goerli":
+			genesis = core.DefaultGoerliGenesisBlock()
+		case "rinkeby":
+			genesis = core.DefaultRinkebyGenesisBlock()
+		case "sepolia":
+			genesis = core.DefaultSepoliaGenesisBlock()
+		default:
+			return fmt.Errorf("unknown network %q", network)
+		}
+	}
+	reader, err := witness.OpenReader(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var (
+		number  = ctx.Uint64(BlockNumberFlag.Name)
+		results []*BlockrunnerResult
+		failed  int
+	)
+	for {
+		w, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid witness after %d blocks: %v", len(results), err)
+		}
+		if number != 0 && w.Block.NumberU64() != number {
+			continue
+		}
+		result := replayBlock(genesis, w, ctx.Bool(AccessSetsFlag.Name), ctx.Bool(TimingsFlag.Name))
+		if !result.Pass {
+			failed++
+		}
+		results = append(results, result)
+	}
+	out, _ := json.MarshalIndent(results, "", "  ")
+	fmt.Println(string(out))
+
+	if number != 0 && len(results) == 0 {
+		return fmt.Errorf("no witness of block %d", number)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d blocks failed", failed, len(results))
+	}
+	return nil
+}
+
+// replayBlock executes the block of w on a chain built from the witness alone
+// and checks the outcome against the block header.
+func replayBlock(genesis *core.Genesis, w *witness.Witness, accessSets, timings bool) *BlockrunnerResult {
+	result := &BlockrunnerResult{Number: w.Block.NumberU64(), Hash: w.Block.Hash()}
+
+	receipts, sets, costs, err := executeWitness(genesis, w, result, accessSets)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Pass = true
+
+	if !accessSets && !timings {
+		return result
+	}
+	for i, tx := range w.Block.Transactions() {
+		rtx := &BlockrunnerTx{Index: i, Hash: tx.Hash(), Status: receipts[i].Status, GasUsed: receipts[i].GasUsed}
+		if timings && i < len(costs) {
+			cost := costs[i]
+			rtx.Time, rtx.EVM, rtx.StateRead, rtx.Hashing, rtx.OpCount = cost.Timedur, cost.EVM, cost.StateRead, cost.Hashing, cost.OpCount
+		}
+		if accessSets && i < len(sets) {
+			set := sets[i]
+			rtx.Reads = hotcache.KeyStrings(set.Reads)
+			rtx.Writes = hotcache.KeyStrings(set.Writes)
+			rtx.SilentWrites = hotcache.KeyStrings(set.SilentWrites)
+			rtx.Reverted = hotcache.KeyStrings(set.Reverted)
+		}
+		result.Txs = append(result.Txs, rtx)
+	}
+	return result
+}
+
+// executeWitness runs the block of w through the state processor, filling in
+// the gas used and the elapsed time of result. It returns the receipts of the
+// transactions, their access sets if requested and their execution costs.
+func executeWitness(genesis *core.Genesis, w *witness.Witness, result *BlockrunnerResult, accessSets bool) (types.Receipts, []*hotcache.TxAccessSet, []hotcache.ExecTime, error) {
+	parent := w.Parent()
+	if parent == nil || parent.Hash() != w.Block.ParentHash() {
+		return nil, nil, nil, errors.New("witness lacks the parent header")
+	}
+	db := rawdb.NewMemoryDatabase()
+	if err := writeWitnessChain(db, genesis, w); err != nil {
+		return nil, nil, nil, err
+	}
+	// Without dirty trie caching the chain doesn't try to flush the state of
+	// older blocks when stopped, which the witness doesn't have.
+	var (
+		config      = genesis.Config
+		txLookup    uint64
+		cacheConfig = &core.CacheConfig{
+			TrieCleanLimit:      16,
+			TrieCleanNoPrefetch: true,
+			TrieDirtyDisabled:   true,
+			Start_from:          parent.Number.Uint64(),
+			HASize:              1,
+		}
+	)
+	bc, hc, err := core.NewBlockChainHotNni(db, cacheConfig, config, witnessEngine(genesis), vm.Config{}, nil, &txLookup)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer bc.Stop()
+
+	var sink *hotcache.MemorySink
+	if accessSets {
+		sink = hotcache.NewMemorySink()
+		bc.SetAccessSink(sink)
+	}
+	statedb, err := state.New(parent.Root, bc.StateCache(), nil, hc.Recorder)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	start := time.Now()
+	receipts, _, gasUsed, err := bc.Processor().Process(w.Block, statedb, *bc.GetVMConfig())
+	result.Elapsed, result.GasUsed = time.Since(start), gasUsed
+
+	costs := make([]hotcache.ExecTime, 0, len(w.Block.Transactions()))
+	for range w.Block.Transactions() {
+		select {
+		case cost := <-hc.Recorder.TxExecTime:
+			costs = append(costs, cost)
+		default:
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	root := statedb.IntermediateRoot(config.IsEIP158(w.Block.Number()))
+	if err := statedb.Error(); err != nil {
+		return nil, nil, nil, fmt.Errorf("incomplete witness: %w", err)
+	}
+	if gasUsed != w.Block.GasUsed() {
+		return nil, nil, nil, fmt.Errorf("gas used %d, header has %d", gasUsed, w.Block.GasUsed())
+	}
+	if root != w.Block.Root() {
+		return nil, nil, nil, fmt.Errorf("state root %x, header has %x", root, w.Block.Root())
+	}
+	if sink != nil {
+		return receipts, sink.Sets(), costs, nil
+	}
+	return receipts, nil, costs, nil
+}
+
+// writeWitnessChain stores the genesis block, the ancestor headers and the
+// state held by a witness into db, with the parent of the block as head.
+func writeWitnessChain(db ethdb.Database, genesis *core.Genesis, w *witness.Witness) error {
+	for _, node := range w.Nodes {
+		if err := db.Put(crypto.Keccak256(node), node); err != nil {
+			return err
+		}
+	}
+	for _, code := range w.Codes {
+		rawdb.WriteCode(db, crypto.Keccak256Hash(code), code)
+	}
+	// The state of the genesis is not needed, only its block
+	block := genesis.ToBlock()
+	rawdb.WriteBlock(db, block)
+	rawdb.WriteTd(db, block.Hash(), 0, block.Difficulty())
+	rawdb.WriteCanonicalHash(db, block.Hash(), 0)
+	rawdb.WriteChainConfig(db, block.Hash(), genesis.Config)
+
+	for _, header := range w.Headers {
+		if header.Number.Sign() == 0 {
+			if header.Hash() != block.Hash() {
+				return fmt.Errorf("witness genesis %x does not match network genesis %x", header.Hash(), block.Hash())
+			}
+			continue
+		}
+		rawdb.WriteBlock(db, types.NewBlockWithHeader(header))
+		rawdb.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+	}
+	parent := w.Parent().Hash()
+	rawdb.WriteHeadBlockHash(db, parent)
+	rawdb.WriteHeadHeaderHash(db, parent)
+	rawdb.WriteHeadFastBlockHash(db, parent)
+	return nil
+}
+
+// witnessEngine returns the consensus engine applying the block rewards of the
+// chain. Seals are not verified, a witness is only ever taken of a valid block.
+func witnessEngine(genesis *core.Genesis) consensus.Engine {
+	var engine consensus.Engine = ethash.NewFaker()
+	if genesis.Config.Clique != nil {
+		engine = clique.New(genesis.Config.Clique, rawdb.NewMemoryDatabase())
+	}
+	return beacon.New(engine)
+}
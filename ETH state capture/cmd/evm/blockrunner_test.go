@@ -0,0 +1,148 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/hotcache/witness"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// headerChain serves the headers of generated blocks to the EVM and the chain
+// config to the consensus engine, nothing else is used while recording.
+type headerChain struct {
+	consensus.ChainHeaderReader
+	config  *params.ChainConfig
+	headers map[common.Hash]*types.Header
+}
+
+func (c *headerChain) Engine() consensus.Engine { return ethash.NewFaker() }
+
+func (c *headerChain) Config() *params.ChainConfig { return c.config }
+
+func (c *headerChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return c.headers[hash]
+}
+
+// blockWitness generates a short chain whose blocks call a contract counting
+// its calls, and records the witness of the last block.
+func blockWitness(t *testing.T) (*core.Genesis, *witness.Witness) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0xc0de")
+		config   = params.TestChainConfig
+		db       = rawdb.NewMemoryDatabase()
+		genesis  = &core.Genesis{
+			Config: config,
+			Alloc: core.GenesisAlloc{
+				sender: {Balance: big.NewInt(params.Ether)},
+				contract: {
+					Balance: common.Big0,
+					// slot0++
+					Code: common.FromHex("600054600101600055"),
+				},
+			},
+		}
+		signer = types.LatestSigner(config)
+	)
+	blocks, _ := core.GenerateChain(config, genesis.MustCommit(db), ethash.NewFaker(), db, 2, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), contract, common.Big0, 100000, b.BaseFee(), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	})
+	chain := &headerChain{config: config, headers: make(map[common.Hash]*types.Header)}
+	for _, block := range blocks {
+		chain.headers[block.Hash()] = block.Header()
+	}
+	var (
+		block    = blocks[1]
+		header   = block.Header()
+		recorder = witness.NewRecorder()
+		sdb      = state.NewDatabase(db)
+		gp       = new(core.GasPool).AddGas(block.GasLimit())
+		usedGas  = new(uint64)
+	)
+	sdb.TrieDB().SetNodeRecorder(recorder.AddNode)
+	statedb, err := state.New(blocks[0].Root(), recorder.Database(sdb), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tx := range block.Transactions() {
+		statedb.Prepare(tx.Hash(), i)
+		if _, err := core.ApplyTransaction(config, chain, nil, gp, statedb, header, tx, usedGas, vm.Config{Debug: true, Tracer: recorder}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chain.Engine().Finalize(chain, header, statedb, block.Transactions(), block.Uncles())
+	if root := statedb.IntermediateRoot(true); root != block.Root() {
+		t.Fatalf("recording run root mismatch: have %x, want %x", root, block.Root())
+	}
+	w, err := recorder.Witness(block, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return genesis, w
+}
+
+func TestBlockRunner(t *testing.T) {
+	genesis, w := blockWitness(t)
+
+	result := replayBlock(genesis, w, true, true)
+	if !result.Pass {
+		t.Fatalf("replay failed: %v", result.Error)
+	}
+	if result.GasUsed != w.Block.GasUsed() || len(result.Txs) != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	tx := result.Txs[0]
+	if tx.Status != types.ReceiptStatusSuccessful || tx.Time == 0 || tx.OpCount == 0 {
+		t.Errorf("unexpected transaction result: %+v", tx)
+	}
+	slot := common.HexToAddress("0xc0de").Hex() + "0x0"
+	if !contains(tx.Reads, slot) || !contains(tx.Writes, slot) {
+		t.Errorf("counter slot missing from access set: reads %v, writes %v", tx.Reads, tx.Writes)
+	}
+	// The witness alone holds the state, without a node the replay must fail
+	partial := *w
+	partial.Nodes = w.Nodes[1:]
+	if result := replayBlock(genesis, &partial, false, false); result.Pass {
+		t.Fatal("replay of incomplete witness passed")
+	}
+}
+
+func contains(list []string, item string) bool {
+	for _, s := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/hotcache"
+)
+
+// AccessSet is the state footprint of an included transaction. Items are
+// identified the way the capture does, storage slots as address and slot,
+// account fields as address and field, e.g. "0x...:balance". Reads include
+// the items of silent and reverted writes, which observed the state too.
+type AccessSet struct {
+	Index        int         `json:"index"` // Position among the included transactions
+	Hash         common.Hash `json:"hash"`
+	Reads        []string    `json:"reads"`
+	Writes       []string    `json:"writes"`
+	SilentWrites []string    `json:"silentWrites,omitempty"`
+	Reverted     []string    `json:"reverted,omitempty"`
+}
+
+// Dependency types between two transactions, named after the access of the
+// earlier one followed by that of the later one.
+const (
+	DepRAW = "RAW" // Later transaction reads an item written by the earlier one
+	DepWAW = "WAW" // Both transactions write the item
+	DepWAR = "WAR" // Later transaction writes an item read by the earlier one
+)
+
+// DepEdge is a dependency of transaction To on the earlier transaction From,
+// with the items causing it.
+type DepEdge struct {
+	From int      `json:"from"`
+	To   int      `json:"to"`
+	Type string   `json:"type"`
+	Keys []string `json:"keys"`
+}
+
+// DepGraph holds every dependency between the included transactions, not
+// only those on the closest conflicting predecessor. Edges are ordered by
+// To, From and type.
+type DepGraph struct {
+	Txs   int       `json:"txs"`
+	Edges []DepEdge `json:"edges"`
+}
+
+// newAccessSets converts the access sets collected by the recorder.
+func newAccessSets(sets []*hotcache.TxAccessSet) []*AccessSet {
+	out := make([]*AccessSet, len(sets))
+	for i, set := range sets {
+		out[i] = &AccessSet{
+			Index:        int(set.TxIndex),
+			Hash:         set.TxHash,
+			Reads:        hotcache.KeyStrings(set.Reads),
+			Writes:       hotcache.KeyStrings(set.Writes),
+			SilentWrites: hotcache.KeyStrings(set.SilentWrites),
+			Reverted:     hotcache.KeyStrings(set.Reverted),
+		}
+	}
+	return out
+}
+
+// newDepGraph derives the dependencies between the transactions of sets,
+// which are in execution order.
+func newDepGraph(sets []*hotcache.TxAccessSet) *DepGraph {
+	graph := &DepGraph{Txs: len(sets), Edges: []DepEdge{}}
+	for to, later := range sets {
+		for from := 0; from < to; from++ {
+			earlier := sets[from]
+			for _, dep := range []struct {
+				typ         string
+				first, then []hotcache.StateKey
+			}{
+				{DepRAW, earlier.Writes, later.Reads},
+				{DepWAW, earlier.Writes, later.Writes},
+				{DepWAR, earlier.Reads, later.Writes},
+			} {
+				if keys := intersect(dep.first, dep.then); len(keys) > 0 {
+					graph.Edges = append(graph.Edges, DepEdge{
+						From: int(earlier.TxIndex),
+						To:   int(later.TxIndex),
+						Type: dep.typ,
+						Keys: keys,
+					})
+				}
+			}
+		}
+	}
+	return graph
+}
+
+// intersect returns the items of b also found in a, in the order of b.
+func intersect(a, b []hotcache.StateKey) []string {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	set := make(map[hotcache.StateKey]struct{}, len(a))
+	for _, key := range a {
+		set[key] = struct{}{}
+	}
+	var keys []string
+	for _, key := range b {
+		if _, ok := set[key]; ok {
+			keys = append(keys, key.String())
+		}
+	}
+	return keys
+}
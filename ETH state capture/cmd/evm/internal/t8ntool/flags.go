@@ -78,6 +78,22 @@ var (
 			"\t<file> - into the file <file> ",
 		Value: "result.json",
 	}
+	OutputAccessSetsFlag = &cli.StringFlag{
+		Name: "output.accesssets",
+		Usage: "Determines where to put the state reads and writes of every included transaction.\n" +
+			"\t`stdout` - into the stdout output\n" +
+			"\t`stderr` - into the stderr output\n" +
+			"\t<file> - into the file <file> ",
+		Value: "",
+	}
+	OutputDepGraphFlag = &cli.StringFlag{
+		Name: "output.depgraph",
+		Usage: "Determines where to put the RAW/WAW/WAR dependencies between the included transactions.\n" +
+			"\t`stdout` - into the stdout output\n" +
+			"\t`stderr` - into the stderr output\n" +
+			"\t<file> - into the file <file> ",
+		Value: "",
+	}
 	OutputBlockFlag = &cli.StringFlag{
 		Name: "output.block",
 		Usage: "Determines where to put the `block` after building.\n" +
@@ -34,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+	"github.com/ethereum/go-ethereum/hotcache"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -279,8 +280,17 @@ func Transition(ctx *cli.Context) error {
 		prestate.Env.Difficulty = calcDifficulty(chainConfig, env.Number, env.Timestamp,
 			env.ParentTimestamp, env.ParentDifficulty, env.ParentUncleHash)
 	}
+	// Record the state accesses if they or the dependencies are asked for
+	var (
+		accesses *hotcache.MemorySink
+		sink     hotcache.AccessSink
+	)
+	if ctx.String(OutputAccessSetsFlag.Name) != "" || ctx.String(OutputDepGraphFlag.Name) != "" {
+		accesses = hotcache.NewMemorySink()
+		sink = accesses
+	}
 	// Run the test and aggregate the result
-	s, result, err := prestate.Apply(vmConfig, chainConfig, txs, ctx.Int64(RewardFlag.Name), getTracer)
+	s, result, err := prestate.Apply(vmConfig, chainConfig, txs, ctx.Int64(RewardFlag.Name), getTracer, sink)
 	if err != nil {
 		return err
 	}
@@ -288,7 +298,14 @@ func Transition(ctx *cli.Context) error {
 	// Dump the excution result
 	collector := make(Alloc)
 	s.DumpToCollector(collector, nil)
-	return dispatchOutput(ctx, baseDir, result, collector, body)
+	var (
+		accessSets []*AccessSet
+		depGraph   *DepGraph
+	)
+	if accesses != nil {
+		accessSets, depGraph = newAccessSets(accesses.Sets()), newDepGraph(accesses.Sets())
+	}
+	return dispatchOutput(ctx, baseDir, result, collector, body, accessSets, depGraph)
 }
 
 // txWithKey is a helper-struct, to allow us to use the types.Transaction along with
@@ -409,7 +426,7 @@ func saveFile(baseDir, filename string, data interface{}) error {
 
 // dispatchOutput writes the output data to either stderr or stdout, or to the specified
 // files
-func dispatchOutput(ctx *cli.Context, baseDir string, result *ExecutionResult, alloc Alloc, body hexutil.Bytes) error {
+func dispatchOutput(ctx *cli.Context, baseDir string, result *ExecutionResult, alloc Alloc, body hexutil.Bytes, accessSets []*AccessSet, depGraph *DepGraph) error {
 	stdOutObject := make(map[string]interface{})
 	stdErrObject := make(map[string]interface{})
 	dispatch := func(baseDir, fName, name string, obj interface{}) error {
@@ -436,6 +453,12 @@ func dispatchOutput(ctx *cli.Context, baseDir string, result *ExecutionResult, a
 	if err := dispatch(baseDir, ctx.String(OutputBodyFlag.Name), "body", body); err != nil {
 		return err
 	}
+	if err := dispatch(baseDir, ctx.String(OutputAccessSetsFlag.Name), "accesssets", accessSets); err != nil {
+		return err
+	}
+	if err := dispatch(baseDir, ctx.String(OutputDepGraphFlag.Name), "depgraph", depGraph); err != nil {
+		return err
+	}
 	if len(stdOutObject) > 0 {
 		b, err := json.MarshalIndent(stdOutObject, "", "  ")
 		if err != nil {
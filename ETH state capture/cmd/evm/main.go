@@ -132,6 +132,23 @@ var (
 		Value: true,
 		Usage: "enable return data output",
 	}
+	NetworkFlag = &cli.StringFlag{
+		Name:  "network",
+		Value: "mainnet",
+		Usage: "network the replayed blocks belong to (mainnet, goerli, rinkeby, sepolia)",
+	}
+	BlockNumberFlag = &cli.Uint64Flag{
+		Name:  "block",
+		Usage: "only replay the block with this number",
+	}
+	AccessSetsFlag = &cli.BoolFlag{
+		Name:  "accesssets",
+		Usage: "output the access set of every transaction",
+	}
+	TimingsFlag = &cli.BoolFlag{
+		Name:  "timings",
+		Usage: "output the execution times of every transaction",
+	}
 )
 
 var stateTransitionCommand = &cli.Command{
@@ -150,6 +167,8 @@ var stateTransitionCommand = &cli.Command{
 		t8ntool.OutputAllocFlag,
 		t8ntool.OutputResultFlag,
 		t8ntool.OutputBodyFlag,
+		t8ntool.OutputAccessSetsFlag,
+		t8ntool.OutputDepGraphFlag,
 		t8ntool.InputAllocFlag,
 		t8ntool.InputEnvFlag,
 		t8ntool.InputTxsFlag,
@@ -226,6 +245,7 @@ func init() {
 		stateTransitionCommand,
 		transactionCommand,
 		blockBuilderCommand,
+		blockRunnerCommand,
 	}
 }
 
@@ -81,9 +81,11 @@ func (args *t8nInput) get(base string) []string {
 }
 
 type t8nOutput struct {
-	alloc  bool
-	result bool
-	body   bool
+	alloc      bool
+	result     bool
+	body       bool
+	accessSets bool
+	depGraph   bool
 }
 
 func (args *t8nOutput) get() (out []string) {
@@ -102,6 +104,12 @@ func (args *t8nOutput) get() (out []string) {
 	} else {
 		out = append(out, "--output.alloc", "")
 	}
+	if args.accessSets {
+		out = append(out, "--output.accesssets", "stdout")
+	}
+	if args.depGraph {
+		out = append(out, "--output.depgraph", "stdout")
+	}
 	return out
 }
 
@@ -243,6 +251,14 @@ func TestT8n(t *testing.T) {
 			output:      t8nOutput{alloc: false, result: false},
 			expExitCode: 3,
 		},
+		{ // Test access set and dependency graph output
+			base: "./testdata/25",
+			input: t8nInput{
+				"alloc.json", "txs.json", "env.json", "Berlin", "",
+			},
+			output: t8nOutput{accessSets: true, depGraph: true},
+			expOut: "exp.json",
+		},
 	} {
 		args := []string{"t8n"}
 		args = append(args, tc.output.get()...)
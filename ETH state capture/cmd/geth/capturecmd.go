@@ -0,0 +1,378 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/gendataset/fff"
+	"github.com/ethereum/go-ethereum/gendataset/synth"
+	"github.com/ethereum/go-ethereum/hotcache/witness"
+	"github.com/ethereum/go-ethereum/internal/flags"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	cli "github.com/urfave/cli/v2"
+)
+
+var (
+	captureCommand = &cli.Command{
+		Action: captureBlocks,
+		Name:   "capture",
+		Usage:  "Capture per-transaction read/write sets and execution times over a block range",
+		Flags: flags.Merge([]cli.Flag{
+			utils.CaptureStartFlag,
+			utils.CaptureEndFlag,
+			utils.CaptureTmpDBFlag,
+			utils.CaptureTmpConfigFlag,
+			utils.CaptureOutputFlag,
+			utils.CaptureFormatFlag,
+			utils.CaptureStoreFlag,
+			utils.CaptureTokensFlag,
+			utils.CaptureWitnessFlag,
+			utils.CaptureTimingRunsFlag,
+			utils.CaptureBreakdownFlag,
+			utils.CaptureBlocksFlag,
+			utils.CaptureStateDumpFlag,
+			utils.CaptureShardsFlag,
+			utils.CacheFlag,
+			utils.CacheDatabaseFlag,
+		}, utils.DatabasePathFlags),
+		Description: `
+The capture command replays the canonical blocks of the node database given by
+--datadir (and --datadir.ancient) on top of a temporary chain database, which
+has to hold the state of the block preceding --capture.start.
+
+No synced node is needed with --capture.blocks and --capture.statedump. The
+blocks are then read from a chain segment written by 'geth export' (gzipped if
+the file ends in .gz) covering the range and, ideally, the 256 blocks before
+it. An empty temporary database is built from the segment and a dump of the
+state of the block preceding the range, made with 'geth dump --iterative
+--incompletes' (from a node storing preimages) or 'geth snapshot dump'. The
+dumped state is checked against the block's state root.
+
+The access set of
+every transaction is written to <capture.output>.csv (or .rwt in binary format)
+and the execution cost of every transaction to <capture.output>ExecTime.csv:
+the total execution time, its split into EVM, state read and trie hashing time,
+the gas used, the number of executed opcodes and the state it read: the trie
+nodes resolved from the clean cache, the dirty cache and disk, the accounts and
+slots read from the snapshot, and the bytes read in total and from disk.
+
+The execution times measured while recording are inflated by the recording
+itself. With --capture.timingruns N every block is first executed N times from
+its parent state with recording disabled, and the exec time file reports the
+median of those runs (plus the fastest total time) instead.
+
+With --capture.store the access sets are also stored in the temporary database,
+from where a node started on it serves them over debug_getBlockAccessSets.
+
+With --capture.tokens the ERC-20, ERC-721 and ERC-1155 transfer events in the
+receipts are decoded as well. Every transaction is classified as token
+transaction or not in <capture.output>TokenTx.csv, the transfers are written to
+<capture.output>Transfers.csv and the vessel transactions derived from them to
+<capture.output>vessel.csv.
+
+With --capture.witness the stateless witness of every block is written to
+<capture.output>Witness.rlp: the block, every account and storage trie node
+and contract code its execution reads, and the ancestor headers whose hashes
+it reads, enough to execute the block again without a state database. The
+witnesses are recorded in an extra unrecorded execution of every block and
+can be checked with 'geth capture verifywitness'.
+
+With --capture.shards N the range is split into N parts captured concurrently,
+for which the node database has to be that of an archive node. Every part gets
+a temporary chain database of its own, --capture.tmpdb/shard<n>, holding only
+the genesis and the 256 blocks preceding the part, and reads the state of the
+block before it from the archive instead of a prepared state. The parts write
+their outputs with a "_shard<n>" suffix on the prefix, which are merged in block
+order into the regular outputs and removed once all parts are done. The exec
+times of concurrent parts are noisier, consider --capture.timingruns.
+
+The capture can be stopped with Ctrl-C, the outputs are flushed and closed after
+the block in flight has been processed.
+
+Progress is checkpointed to <capture.output>.checkpoint after every block.
+Rerunning the same command resumes after the last checkpointed block, dropping
+any output written past it. Delete the checkpoint to start the range over.`,
+		Subcommands: []*cli.Command{captureVerifyWitnessCommand, captureSyntheticCommand},
+	}
+	captureSyntheticCommand = &cli.Command{
+		Action: captureSynthetic,
+		Name:   "synthetic",
+		Usage:  "Capture a generated chain of token, swap and NFT transactions",
+		Flags: []cli.Flag{
+			utils.CaptureTmpDBFlag,
+			utils.CaptureTmpConfigFlag,
+			utils.CaptureOutputFlag,
+			utils.CaptureStoreFlag,
+			utils.CaptureWitnessFlag,
+			utils.CaptureTimingRunsFlag,
+			utils.CaptureBreakdownFlag,
+			utils.CaptureSynthAccountsFlag,
+			utils.CaptureSynthTokensFlag,
+			utils.CaptureSynthPoolsFlag,
+			utils.CaptureSynthCollectionsFlag,
+			utils.CaptureSynthBlocksFlag,
+			utils.CaptureSynthTxsFlag,
+			utils.CaptureSynthMixFlag,
+			utils.CaptureSynthSeedFlag,
+			utils.CaptureSynthSkewFlag,
+			utils.CaptureSynthHotspotFlag,
+		},
+		Description: `
+The synthetic command captures a chain with a known conflict structure instead
+of mainnet blocks. Its genesis funds --capture.synth.accounts accounts and
+deploys minimal ERC-20 tokens, constant product pools trading two neighbouring
+tokens each and ERC-721 collections, holding the token balances of every
+account and the reserves of the pools. The blocks are generated with
+core.GenerateChain, every transaction being an ether transfer, a token
+transfer, a swap or an NFT mint or transfer, drawn by the weights of
+--capture.synth.mix. Senders, receivers and contracts are picked uniformly or,
+with --capture.synth.skew, Zipf distributed, and --capture.synth.hotspot sends
+that share of the contract calls to the first contract of every kind. The same
+seed always generates the same chain.
+
+The generated blocks go through the regular capture pipeline, see 'geth capture',
+on a temporary chain in --capture.tmpdb or in memory. Besides its outputs, with
+the token transfers always decoded, the access sets merged with the execution
+times are written to <capture.output>transactions.csv and the generated
+transactions, with their kind, contract, sender and receiver, to
+<capture.output>workload.csv as ground truth.`,
+	}
+	captureVerifyWitnessCommand = &cli.Command{
+		Action:    verifyWitnesses,
+		Name:      "verifywitness",
+		Usage:     "Re-execute the blocks of a witness file on their witnesses alone",
+		ArgsUsage: "<witness file>",
+		Flags:     utils.NetworkFlags,
+		Description: `
+The verifywitness command executes every block of a witness file written by
+'geth capture --capture.witness' on the state held by its witness, without any
+database, and checks that it reproduces the gas used and the state root of the
+block header. The chain configuration is the one of the selected network.`,
+	}
+)
+
+func captureBlocks(ctx *cli.Context) error {
+	if !ctx.IsSet(utils.CaptureTmpDBFlag.Name) || !ctx.IsSet(utils.CaptureTmpConfigFlag.Name) {
+		utils.Fatalf("Both --%s and --%s are required", utils.CaptureTmpDBFlag.Name, utils.CaptureTmpConfigFlag.Name)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	if shards := ctx.Int(utils.CaptureShardsFlag.Name); shards > 1 {
+		return captureSharded(ctx, stack, shards)
+	}
+	var blocks fff.BlockSource
+	if path := ctx.String(utils.CaptureBlocksFlag.Name); path != "" {
+		segment, err := fff.OpenRLPBlocks(path)
+		if err != nil {
+			return fmt.Errorf("could not open chain segment: %v", err)
+		}
+		defer segment.Close()
+		blocks = segment
+	} else {
+		sourceDb := utils.MakeChainDatabase(ctx, stack, true)
+		defer sourceDb.Close()
+		blocks = fff.DBBlocks(sourceDb)
+	}
+
+	tmpDb, err := rawdb.NewLevelDBDatabase(ctx.String(utils.CaptureTmpDBFlag.Name), 1024, 256, "", false)
+	if err != nil {
+		return fmt.Errorf("could not open temporary database: %v", err)
+	}
+	defer tmpDb.Close()
+
+	interrupt, stop := captureInterrupt()
+	defer stop()
+
+	cfg := captureConfig(ctx)
+	cfg.StateDump = ctx.String(utils.CaptureStateDumpFlag.Name)
+	return captureResult(cfg, fff.Gendata(cfg, tmpDb, blocks, interrupt))
+}
+
+// captureSharded runs a capture split into shards reading the state from the
+// archive node database.
+func captureSharded(ctx *cli.Context, stack *node.Node, shards int) error {
+	if ctx.IsSet(utils.CaptureBlocksFlag.Name) || ctx.IsSet(utils.CaptureStateDumpFlag.Name) {
+		utils.Fatalf("Sharded captures read the blocks and state from the node database, --%s and --%s are not supported",
+			utils.CaptureBlocksFlag.Name, utils.CaptureStateDumpFlag.Name)
+	}
+	sourceDb := utils.MakeChainDatabase(ctx, stack, true)
+	defer sourceDb.Close()
+
+	interrupt, stop := captureInterrupt()
+	defer stop()
+
+	cfg := captureConfig(ctx)
+	return captureResult(cfg, fff.GendataSharded(cfg, shards, sourceDb, ctx.String(utils.CaptureTmpDBFlag.Name), interrupt))
+}
+
+// captureConfig returns the capture settings shared by all capture modes.
+func captureConfig(ctx *cli.Context) *fff.Config {
+	return &fff.Config{
+		Start:      ctx.Uint64(utils.CaptureStartFlag.Name),
+		End:        ctx.Uint64(utils.CaptureEndFlag.Name),
+		Output:     ctx.String(utils.CaptureOutputFlag.Name),
+		Format:     ctx.String(utils.CaptureFormatFlag.Name),
+		ConfigDir:  ctx.String(utils.CaptureTmpConfigFlag.Name),
+		Store:      ctx.Bool(utils.CaptureStoreFlag.Name),
+		Tokens:     ctx.Bool(utils.CaptureTokensFlag.Name),
+		Witness:    ctx.Bool(utils.CaptureWitnessFlag.Name),
+		TimingRuns: ctx.Int(utils.CaptureTimingRunsFlag.Name),
+		Breakdown:  ctx.Bool(utils.CaptureBreakdownFlag.Name),
+	}
+}
+
+// captureInterrupt watches for Ctrl-C while a capture is running, closing the
+// returned channel to stop it at the next block. The returned function stops
+// watching.
+func captureInterrupt() (<-chan struct{}, func()) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+
+	interrupt := make(chan struct{})
+	go func() {
+		if _, ok := <-sigc; ok {
+			log.Info("Interrupted during capture, stopping at next block")
+			close(interrupt)
+		}
+	}()
+	return interrupt, func() {
+		signal.Stop(sigc)
+		close(sigc)
+	}
+}
+
+// captureResult turns the outcome of a capture into the command's error.
+func captureResult(cfg *fff.Config, err error) error {
+	if err != nil {
+		if errors.Is(err, fff.ErrInterrupted) {
+			return fmt.Errorf("capture of blocks %d-%d incomplete: %w", cfg.Start, cfg.End, err)
+		}
+		return fmt.Errorf("capture failed: %w", err)
+	}
+	return nil
+}
+
+func captureSynthetic(ctx *cli.Context) error {
+	mix, err := synth.ParseMix(ctx.String(utils.CaptureSynthMixFlag.Name))
+	if err != nil {
+		return err
+	}
+	workload := &synth.Workload{
+		Accounts:    ctx.Int(utils.CaptureSynthAccountsFlag.Name),
+		Tokens:      ctx.Int(utils.CaptureSynthTokensFlag.Name),
+		Pools:       ctx.Int(utils.CaptureSynthPoolsFlag.Name),
+		Collections: ctx.Int(utils.CaptureSynthCollectionsFlag.Name),
+		Blocks:      ctx.Int(utils.CaptureSynthBlocksFlag.Name),
+		TxsPerBlock: ctx.Int(utils.CaptureSynthTxsFlag.Name),
+		Mix:         mix,
+		Seed:        ctx.Int64(utils.CaptureSynthSeedFlag.Name),
+		Skew:        ctx.Float64(utils.CaptureSynthSkewFlag.Name),
+		Hotspot:     ctx.Float64(utils.CaptureSynthHotspotFlag.Name),
+	}
+	if err := workload.Validate(); err != nil {
+		return fmt.Errorf("invalid workload: %v", err)
+	}
+	tmpDb := rawdb.NewMemoryDatabase()
+	if path := ctx.String(utils.CaptureTmpDBFlag.Name); path != "" {
+		if tmpDb, err = rawdb.NewLevelDBDatabase(path, 1024, 256, "", false); err != nil {
+			return fmt.Errorf("could not open temporary database: %v", err)
+		}
+	}
+	defer tmpDb.Close()
+
+	cfg := &fff.Config{
+		Output:     ctx.String(utils.CaptureOutputFlag.Name),
+		ConfigDir:  ctx.String(utils.CaptureTmpConfigFlag.Name),
+		Store:      ctx.Bool(utils.CaptureStoreFlag.Name),
+		Witness:    ctx.Bool(utils.CaptureWitnessFlag.Name),
+		TimingRuns: ctx.Int(utils.CaptureTimingRunsFlag.Name),
+		Breakdown:  ctx.Bool(utils.CaptureBreakdownFlag.Name),
+	}
+	interrupt, stop := captureInterrupt()
+	defer stop()
+
+	if err := synth.Capture(cfg, workload, tmpDb, interrupt); err != nil {
+		return fmt.Errorf("synthetic capture failed: %w", err)
+	}
+	return nil
+}
+
+func verifyWitnesses(ctx *cli.Context) error {
+	if ctx.Args().Len() != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	genesis := utils.MakeGenesis(ctx)
+	if genesis == nil {
+		genesis = core.DefaultGenesisBlock()
+	}
+	config := genesis.Config
+
+	var engine consensus.Engine = ethash.NewFaker()
+	if config.Clique != nil {
+		engine = clique.New(config.Clique, rawdb.NewMemoryDatabase())
+	}
+	engine = beacon.New(engine)
+
+	reader, err := witness.OpenReader(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var (
+		start    = time.Now()
+		verified int
+		failed   int
+	)
+	for {
+		w, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid witness after %d blocks: %v", verified+failed, err)
+		}
+		if err := witness.Verify(config, engine, w); err != nil {
+			log.Error("Witness verification failed", "err", err)
+			failed++
+			continue
+		}
+		verified++
+	}
+	log.Info("Verified witnesses", "verified", verified, "failed", failed, "elapsed", common.PrettyDuration(time.Since(start)))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d witnesses failed verification", failed, verified+failed)
+	}
+	return nil
+}
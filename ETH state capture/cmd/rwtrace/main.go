@@ -0,0 +1,194 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// rwtrace converts captured read/write sets between the CSV and the binary
+// rwtrace format.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/hotcache/rwtrace"
+	"github.com/ethereum/go-ethereum/internal/flags"
+	"github.com/urfave/cli/v2"
+)
+
+// Git SHA1 commit hash of the release (set via linker flags)
+var gitCommit = ""
+var gitDate = ""
+
+var app *cli.App
+
+func init() {
+	app = flags.NewApp(gitCommit, gitDate, "a converter for captured read/write set traces")
+	app.Commands = []*cli.Command{
+		commandFromCSV,
+		commandToCSV,
+		commandDump,
+	}
+}
+
+var (
+	execTimeFileFlag = &cli.StringFlag{
+		Name:  "exectime",
+		Usage: "execution time CSV (TxHash, ExecTime(ns)) to merge into the trace",
+	}
+	execTimeFlag = &cli.BoolFlag{
+		Name:  "exectime",
+		Usage: "add the ExecTime(ns) column",
+	}
+
+	commandFromCSV = &cli.Command{
+		Name:      "fromcsv",
+		Usage:     "convert an access set CSV into a trace",
+		ArgsUsage: "<csvfile> <tracefile>",
+		Flags:     []cli.Flag{execTimeFileFlag},
+		Action:    fromCSV,
+		Description: `
+Reads the rows of a captured (or merged) access set CSV, which must be ordered
+by block number, and writes them as a trace. Execution times are taken from the
+ExecTime(ns) column if present, or from the file given by --exectime.`,
+	}
+	commandToCSV = &cli.Command{
+		Name:      "tocsv",
+		Usage:     "convert a trace into an access set CSV",
+		ArgsUsage: "<tracefile> [<csvfile>]",
+		Flags:     []cli.Flag{execTimeFlag},
+		Action:    toCSV,
+		Description: `
+Writes every transaction of the trace as a CSV row in the capture format, to
+stdout if no output file is given.`,
+	}
+	commandDump = &cli.Command{
+		Name:      "dump",
+		Usage:     "print blocks of a trace as JSON",
+		ArgsUsage: "<tracefile> [<number>...]",
+		Action:    dump,
+		Description: `
+Prints the given blocks, or the block numbers held by the trace if none are
+given.`,
+	}
+)
+
+func fromCSV(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return errors.New("need input CSV and output trace file")
+	}
+	var execTimes map[common.Hash]uint64
+	if path := ctx.String(execTimeFileFlag.Name); path != "" {
+		var err error
+		if execTimes, err = readExecTimes(path); err != nil {
+			return err
+		}
+	}
+	in, err := os.Open(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	w, err := rwtrace.Create(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	err = rwtrace.FromCSV(in, w, execTimes)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readExecTimes loads the execution times written by the capture.
+func readExecTimes(path string) (map[common.Hash]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	execTimes, err := rwtrace.ReadExecTimes(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return execTimes, nil
+}
+
+func toCSV(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		return errors.New("need input trace and optional output CSV file")
+	}
+	in, err := os.Open(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if ctx.NArg() == 1 {
+		return rwtrace.ToCSV(in, os.Stdout, ctx.Bool(execTimeFlag.Name))
+	}
+	out, err := os.Create(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	if err := rwtrace.ToCSV(in, out, ctx.Bool(execTimeFlag.Name)); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func dump(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return errors.New("need trace file")
+	}
+	r, err := rwtrace.Open(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if ctx.NArg() == 1 {
+		return enc.Encode(r.Numbers())
+	}
+	for _, arg := range ctx.Args().Slice()[1:] {
+		number, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid block number %q", arg)
+		}
+		block, err := r.Block(number)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", number, err)
+		}
+		if err := enc.Encode(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -593,6 +593,11 @@ var (
 		Usage:    "Record information useful for VM and contract debugging",
 		Category: flags.VMCategory,
 	}
+	VMRecordAccessSetsFlag = &cli.BoolFlag{
+		Name:     "vm.accesssets",
+		Usage:    "Store the state access sets of processed transactions (served by debug_getBlockAccessSets)",
+		Category: flags.VMCategory,
+	}
 
 	// API options.
 	RPCGlobalGasCapFlag = &cli.Uint64Flag{
@@ -977,6 +982,143 @@ var (
 		Value:    metrics.DefaultConfig.InfluxDBOrganization,
 		Category: flags.MetricsCategory,
 	}
+
+	// State capture settings
+	CaptureStartFlag = &cli.Uint64Flag{
+		Name:     "capture.start",
+		Usage:    "First block to capture read/write sets for",
+		Value:    15000000,
+		Category: flags.CaptureCategory,
+	}
+	CaptureEndFlag = &cli.Uint64Flag{
+		Name:     "capture.end",
+		Usage:    "Last block to capture read/write sets for (inclusive)",
+		Value:    15150000,
+		Category: flags.CaptureCategory,
+	}
+	CaptureTmpDBFlag = &flags.DirectoryFlag{
+		Name:     "capture.tmpdb",
+		Usage:    "Temporary leveldb holding the state the captured blocks are replayed on",
+		Category: flags.CaptureCategory,
+	}
+	CaptureTmpConfigFlag = &flags.DirectoryFlag{
+		Name:     "capture.tmpconfig",
+		Usage:    "Directory for the temporary node configuration of the capture chain",
+		Category: flags.CaptureCategory,
+	}
+	CaptureOutputFlag = &cli.StringFlag{
+		Name:     "capture.output",
+		Usage:    "Path prefix of the capture output files",
+		Value:    "EVM_ACCESS",
+		Category: flags.CaptureCategory,
+	}
+	CaptureFormatFlag = &cli.StringFlag{
+		Name:     "capture.format",
+		Usage:    `Access set output format ("csv" or "binary")`,
+		Value:    "csv",
+		Category: flags.CaptureCategory,
+	}
+	CaptureStoreFlag = &cli.BoolFlag{
+		Name:     "capture.store",
+		Usage:    "Also store the access sets in the temporary chain database",
+		Category: flags.CaptureCategory,
+	}
+	CaptureTokensFlag = &cli.BoolFlag{
+		Name:     "capture.tokens",
+		Usage:    "Also write the token transfers and vessel transactions decoded from the receipts",
+		Category: flags.CaptureCategory,
+	}
+	CaptureTimingRunsFlag = &cli.IntFlag{
+		Name:     "capture.timingruns",
+		Usage:    "Number of unrecorded executions of every block to measure the execution times on (0 = measure while recording)",
+		Category: flags.CaptureCategory,
+	}
+	CaptureBreakdownFlag = &cli.BoolFlag{
+		Name:     "capture.breakdown",
+		Usage:    "Also measure the state read and hashing times of every transaction (enables expensive metrics, which slow down execution)",
+		Category: flags.CaptureCategory,
+	}
+	CaptureWitnessFlag = &cli.BoolFlag{
+		Name:     "capture.witness",
+		Usage:    "Also write the stateless witness (trie nodes, codes and ancestor headers) of every block",
+		Category: flags.CaptureCategory,
+	}
+	CaptureBlocksFlag = &cli.StringFlag{
+		Name:     "capture.blocks",
+		Usage:    "Chain segment exported by 'geth export' to read the blocks from instead of the node database",
+		Category: flags.CaptureCategory,
+	}
+	CaptureStateDumpFlag = &cli.StringFlag{
+		Name:     "capture.statedump",
+		Usage:    "State dump of the block preceding capture.start to build an empty temporary database from",
+		Category: flags.CaptureCategory,
+	}
+	CaptureShardsFlag = &cli.IntFlag{
+		Name:     "capture.shards",
+		Usage:    "Number of concurrent captures the range is split into, reading the state from the archive node database",
+		Value:    1,
+		Category: flags.CaptureCategory,
+	}
+	CaptureSynthAccountsFlag = &cli.IntFlag{
+		Name:     "capture.synth.accounts",
+		Usage:    "Number of funded accounts of the synthetic chain",
+		Value:    1000,
+		Category: flags.CaptureCategory,
+	}
+	CaptureSynthTokensFlag = &cli.IntFlag{
+		Name:     "capture.synth.tokens",
+		Usage:    "Number of ERC-20 contracts of the synthetic chain",
+		Value:    10,
+		Category: flags.CaptureCategory,
+	}
+	CaptureSynthPoolsFlag = &cli.IntFlag{
+		Name:     "capture.synth.pools",
+		Usage:    "Number of swap pools of the synthetic chain, each trading two neighbouring tokens",
+		Value:    5,
+		Category: flags.CaptureCategory,
+	}
+	CaptureSynthCollectionsFlag = &cli.IntFlag{
+		Name:     "capture.synth.collections",
+		Usage:    "Number of NFT contracts of the synthetic chain",
+		Value:    5,
+		Category: flags.CaptureCategory,
+	}
+	CaptureSynthBlocksFlag = &cli.IntFlag{
+		Name:     "capture.synth.blocks",
+		Usage:    "Number of blocks of the synthetic chain",
+		Value:    100,
+		Category: flags.CaptureCategory,
+	}
+	CaptureSynthTxsFlag = &cli.IntFlag{
+		Name:     "capture.synth.txs",
+		Usage:    "Number of transactions per block of the synthetic chain",
+		Value:    100,
+		Category: flags.CaptureCategory,
+	}
+	CaptureSynthMixFlag = &cli.StringFlag{
+		Name:     "capture.synth.mix",
+		Usage:    "Relative weights of the synthetic transaction kinds",
+		Value:    "transfer=1,erc20=4,swap=3,nft=2",
+		Category: flags.CaptureCategory,
+	}
+	CaptureSynthSeedFlag = &cli.Int64Flag{
+		Name:     "capture.synth.seed",
+		Usage:    "Seed of the synthetic accounts and transactions",
+		Value:    1,
+		Category: flags.CaptureCategory,
+	}
+	CaptureSynthSkewFlag = &cli.Float64Flag{
+		Name:     "capture.synth.skew",
+		Usage:    "Zipf exponent (> 1) of the synthetic account and contract picks (0 = uniform)",
+		Value:    1.2,
+		Category: flags.CaptureCategory,
+	}
+	CaptureSynthHotspotFlag = &cli.Float64Flag{
+		Name:     "capture.synth.hotspot",
+		Usage:    "Probability that a synthetic contract call goes to the first contract of its kind",
+		Value:    0.1,
+		Category: flags.CaptureCategory,
+	}
 )
 
 var (
@@ -1835,6 +1977,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 		// TODO(fjl): force-enable this in --dev mode
 		cfg.EnablePreimageRecording = ctx.Bool(VMEnableDebugFlag.Name)
 	}
+	if ctx.IsSet(VMRecordAccessSetsFlag.Name) {
+		cfg.RecordAccessSets = ctx.Bool(VMRecordAccessSetsFlag.Name)
+	}
 
 	if ctx.IsSet(RPCGlobalGasCapFlag.Name) {
 		cfg.RPCGasCap = ctx.Uint64(RPCGlobalGasCapFlag.Name)
@@ -229,8 +229,6 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	if cacheConfig == nil {
 		cacheConfig = defaultCacheConfig
 	}
-	fmt.Printf("cacheConfig:%+v\n\n", cacheConfig)
-	fmt.Printf("chainConfig:%+v", chainConfig)
 
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
@@ -427,8 +425,6 @@ func NewBlockChainHot(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *
 	if cacheConfig == nil {
 		cacheConfig = defaultCacheConfig
 	}
-	fmt.Printf("cacheConfig:%+v\n\n", cacheConfig)
-	fmt.Printf("chainConfig:%+v", chainConfig)
 
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
@@ -437,6 +433,7 @@ func NewBlockChainHot(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *
 	txLookupCache, _ := lru.New(txLookupCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 	hotcache_init := hotcache.NewHotcache(cacheConfig.HASize, 10)
+	hotcache_init.Recorder = hotcache_init.NewRWHook()
 
 	bc := &BlockChain{
 
@@ -626,8 +623,6 @@ func NewBlockChainHotNni(db ethdb.Database, cacheConfig *CacheConfig, chainConfi
 		cacheConfig = defaultCacheConfig
 	}
 
-	fmt.Printf("cacheConfig:%+v\n\n", cacheConfig)
-	fmt.Printf("chainConfig:%+v", chainConfig)
 
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
@@ -636,6 +631,7 @@ func NewBlockChainHotNni(db ethdb.Database, cacheConfig *CacheConfig, chainConfi
 	txLookupCache, _ := lru.New(txLookupCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 	hotcache_init := hotcache.NewHotcache(cacheConfig.HASize, 10)
+	hotcache_init.Recorder = hotcache_init.NewRWHook()
 
 	bc := &BlockChain{
 
@@ -939,6 +935,13 @@ func (bc *BlockChain) SetSafe(block *types.Block) {
 	}
 }
 
+// SetAccessSink installs the receiver of the state accesses recorded while
+// processing blocks, nothing is recorded without one. It must be set before
+// any block is inserted.
+func (bc *BlockChain) SetAccessSink(sink hotcache.AccessSink) {
+	bc.hotcache.Recorder.Sink = sink
+}
+
 // setHeadBeyondRoot rewinds the local chain to a new head with the extra condition
 // that the rewind must pass the specified state root. This method is meant to be
 // used when rewinding with snapshots enabled to ensure that we go back further than
@@ -1072,6 +1075,8 @@ func (bc *BlockChain) setHeadBeyondRoot(head uint64, root common.Hash, repair bo
 			rawdb.DeleteBody(db, hash, num)
 			rawdb.DeleteReceipts(db, hash, num)
 		}
+		// Access sets are kept in the active store, also for frozen blocks
+		rawdb.DeleteAccessSets(db, hash, num)
 		// Todo(rjl493456442) txlookup, bloombits, etc
 	}
 	// If SetHead was only called as a chain reparation method, try to skip
@@ -1676,6 +1681,9 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	rawdb.WriteBlock(blockBatch, block)
 	rawdb.WriteReceipts(blockBatch, block.Hash(), block.NumberU64(), receipts)
 	rawdb.WritePreimages(blockBatch, state.Preimages())
+	if w, ok := bc.hotcache.Recorder.Sink.(hotcache.BlockWriter); ok {
+		w.WriteBlock(blockBatch, block.Hash(), block.NumberU64())
+	}
 	if err := blockBatch.Write(); err != nil {
 		log.Crit("Failed to write block into disk", "err", err)
 	}
@@ -1898,7 +1906,6 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 	it := newInsertIterator(chain, results, bc.validator)
 	block, err := it.next()
 	bc.hotcache.Recorder.NowBLKNUM = block.NumberU64()
-	fmt.Println(bc.hotcache.Recorder.NowBLKNUM)
 	// Left-trim all the known blocks that don't need to build snapshot
 	if bc.skipBlock(err, it) {
 		// First block (and state) is known
@@ -2061,8 +2068,6 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 		var err error
 
 		statedb, err = state.New(parent.Root, bc.stateCache, bc.snaps, bc.hotcache.Recorder)
-
-		time.Sleep(1 * time.Second)
 		// statedb.Recorder.TxsWrite = make(map[*common.Address]struct{}, 100000)
 		// statedb.Recorder.TxsRead = make(map[*common.Address]struct{}, 100000)
 
@@ -2100,6 +2105,9 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 
 		//fmt.Println("当前区块命中率", block.NumberU64(), hit_rate)
 		hit_rate_storage := float64(statedb.Hit_storage_num) / float64(statedb.Miss_storage_num+statedb.Hit_storage_num)
+		if math.IsNaN(hit_rate_storage) {
+			hit_rate_storage = 0
+		}
 
 		// 执行完了之后
 		if err != nil {
@@ -2138,10 +2146,6 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 		substart = time.Now()
 		var status WriteStatus
 
-		if math.IsNaN(hit_rate_storage) {
-			hit_rate_storage = 0
-		}
-
 		bc.hotcache.Blk_num++
 
 		if !setHead {
@@ -2177,7 +2181,9 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 			log.Debug("Inserted new block", "number", block.Number(), "hash", block.Hash(),
 				"uncles", len(block.Uncles()), "txs", len(block.Transactions()), "gas", block.GasUsed(),
 				"elapsed", common.PrettyDuration(time.Since(start)),
-				"root", block.Root())
+				"root", block.Root(), "storagehit", hit_rate_storage,
+				"cleannodes", statedb.IO.CleanNodes, "dirtynodes", statedb.IO.DirtyNodes, "disknodes", statedb.IO.DiskNodes,
+				"snapitems", statedb.IO.SnapshotItems, "read", common.StorageSize(statedb.IO.ReadBytes))
 
 			lastCanon = block
 
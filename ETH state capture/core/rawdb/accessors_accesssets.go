@@ -0,0 +1,59 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// The captured access sets of a block are stored as an opaque RLP list, the
+// encoding is owned by the hotcache package which records them. They are kept
+// in the key-value store only, also for blocks moved into the freezer, and are
+// never pruned: they are only deleted together with their block when the chain
+// is rewound past it. Like block bodies, the sets of blocks dropped by a reorg
+// stay in place, keyed by block hash.
+
+// HasAccessSets verifies the existence of the access sets of a block.
+func HasAccessSets(db ethdb.KeyValueReader, hash common.Hash, number uint64) bool {
+	if has, err := db.Has(accessSetsKey(number, hash)); !has || err != nil {
+		return false
+	}
+	return true
+}
+
+// ReadAccessSetsRLP retrieves the access sets of a block in RLP encoding.
+func ReadAccessSetsRLP(db ethdb.KeyValueReader, hash common.Hash, number uint64) rlp.RawValue {
+	data, _ := db.Get(accessSetsKey(number, hash))
+	return data
+}
+
+// WriteAccessSetsRLP stores the RLP encoded access sets of a block.
+func WriteAccessSetsRLP(db ethdb.KeyValueWriter, hash common.Hash, number uint64, data rlp.RawValue) {
+	if err := db.Put(accessSetsKey(number, hash), data); err != nil {
+		log.Crit("Failed to store block access sets", "err", err)
+	}
+}
+
+// DeleteAccessSets removes the access sets of a block.
+func DeleteAccessSets(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
+	if err := db.Delete(accessSetsKey(number, hash)); err != nil {
+		log.Crit("Failed to delete block access sets", "err", err)
+	}
+}
@@ -174,6 +174,7 @@ func (s *stateObject) getTrie(db Database) Trie {
 				s.setError(fmt.Errorf("can't create storage trie: %v", err))
 			}
 		}
+		s.db.trackIO(s.trie)
 	}
 	return s.trie
 }
@@ -255,6 +256,10 @@ func (s *stateObject) GetCommittedState(db Database, key common.Hash) common.Has
 		if metrics.EnabledExpensive {
 			s.db.SnapshotStorageReads += time.Since(start)
 		}
+		if err == nil {
+			s.db.IO.SnapshotItems++
+			s.db.IO.ReadBytes += uint64(len(enc))
+		}
 	}
 	// If the snapshot is unavailable or reading from it fails, load from the database.
 	if s.db.snap == nil || err != nil {
@@ -472,6 +477,7 @@ func (s *stateObject) deepCopy(db *StateDB) *stateObject {
 	stateObject := newObject(db, s.address, s.data)
 	if s.trie != nil {
 		stateObject.trie = db.db.CopyTrie(s.trie)
+		db.trackIO(stateObject.trie)
 	}
 	stateObject.code = s.code
 	stateObject.dirtyStorage = s.dirtyStorage.Copy()
@@ -41,6 +41,7 @@ import (
 type revision struct {
 	id           int
 	journalIndex int
+	recordIndex  int // Number of accesses buffered by the recorder at snapshot time
 }
 
 var (
@@ -77,6 +78,11 @@ type StateDB struct {
 	Hit_storage_num  uint64
 	Miss_storage_num uint64
 	Cache_size       uint64
+
+	// IO counts the trie nodes and snapshot items read by the state and its
+	// tries, see hotcache.IOStats.
+	IO hotcache.IOStats
+
 	// originalRoot is the pre-state root, before any changes were made.
 	// It will be updated when the Commit is called.
 	originalRoot common.Hash
@@ -142,12 +148,22 @@ type StateDB struct {
 	isRecord       bool
 }
 
-// GetRWRecorder implements vm.StateDB.
+// GetRWRecorder implements vm.StateDB. It returns nil while recording is
+// disabled.
 func (s *StateDB) GetRWRecorder() *hotcache.RWRecorder {
-
+	if !s.isRecord {
+		return nil
+	}
 	return s.Recorder
 }
 
+// trackIO makes tr count the nodes it resolves in the I/O stats of the state.
+func (s *StateDB) trackIO(tr Trie) {
+	if tr, ok := tr.(interface{ SetIOStats(*hotcache.IOStats) }); ok {
+		tr.SetIOStats(&s.IO)
+	}
+}
+
 // New creates a new state from a given trie.
 func New(root common.Hash, db Database, snaps *snapshot.Tree, rwRecorder *hotcache.RWRecorder) (*StateDB, error) {
 	tr, err := db.OpenTrie(root)
@@ -181,6 +197,7 @@ func New(root common.Hash, db Database, snaps *snapshot.Tree, rwRecorder *hotcac
 		accessList:          newAccessList(),
 		hasher:              crypto.NewKeccakState(),
 	}
+	sdb.trackIO(tr)
 	if sdb.snaps != nil {
 		if sdb.snap = sdb.snaps.Snapshot(root); sdb.snap != nil {
 			sdb.snapDestructs = make(map[common.Hash]struct{})
@@ -199,10 +216,53 @@ func (s *StateDB) EnableRecord() {
 	s.isRecord = true
 }
 
+// IsRecording reports whether recording is enabled for this state.
+func (s *StateDB) IsRecording() bool {
+	return s.isRecord
+}
+
 func (s *StateDB) GetRecord() *hotcache.RWRecorder {
 	return s.recorder
 }
 
+// recording reports whether accesses are forwarded to a read/write recorder.
+// Callers check it before building the recorded values.
+func (s *StateDB) recording() bool {
+	return s.isRecord && s.Recorder != nil
+}
+
+// recordAccount forwards an account-level access to the attached read/write
+// recorder, unless recording is disabled for this state.
+func (s *StateDB) recordAccount(addr common.Address, kind hotcache.AccessKind, value []byte, isRead bool) {
+	if !s.recording() {
+		return
+	}
+	s.Recorder.RecordAccount(addr, kind, value, isRead)
+}
+
+// bigBytes returns the big-endian bytes of x, treating nil as zero.
+func bigBytes(x *big.Int) []byte {
+	if x == nil {
+		return nil
+	}
+	return x.Bytes()
+}
+
+// recordBalanceChange records a balance mutation as a read-modify-write of the
+// balance. Zero-value changes only touch the account and are recorded as an
+// existence read.
+func (s *StateDB) recordBalanceChange(addr common.Address, amount, prev, post *big.Int) {
+	if !s.recording() {
+		return
+	}
+	if amount == nil || amount.Sign() == 0 {
+		s.recordAccount(addr, hotcache.AccessExistence, nil, true)
+		return
+	}
+	s.recordAccount(addr, hotcache.AccessBalance, bigBytes(prev), true)
+	s.recordAccount(addr, hotcache.AccessBalance, bigBytes(post), false)
+}
+
 // StopPrefetcher terminates a running prefetcher and reports any leftover stats
 // from the gathered metrics.
 func (s *StateDB) StopPrefetcher() {
@@ -296,26 +356,28 @@ func (s *StateDB) SubRefund(gas uint64) {
 // Exist reports whether the given account address exists in the state.
 // Notably this also returns true for suicided accounts.
 func (s *StateDB) Exist(addr common.Address) bool {
-
+	s.recordAccount(addr, hotcache.AccessExistence, nil, true)
 	return s.getStateObject(addr) != nil
 }
 
 // Empty returns whether the state object is either non-existent
 // or empty according to the EIP161 specification (balance = nonce = code = 0)
 func (s *StateDB) Empty(addr common.Address) bool {
-
+	s.recordAccount(addr, hotcache.AccessExistence, nil, true)
 	so := s.getStateObject(addr)
 	return so == nil || so.empty()
 }
 
 // GetBalance retrieves the balance from the given address or 0 if object not found
 func (s *StateDB) GetBalance(addr common.Address) *big.Int {
-
-	stateObject := s.getStateObject(addr)
-	if stateObject != nil {
-		return stateObject.Balance()
+	balance := common.Big0
+	if stateObject := s.getStateObject(addr); stateObject != nil {
+		balance = stateObject.Balance()
+	}
+	if s.recording() {
+		s.recordAccount(addr, hotcache.AccessBalance, bigBytes(balance), true)
 	}
-	return common.Big0
+	return balance
 }
 func (s *StateDB) GetHotState(addr common.Address) {
 	//s.getStateObject_fetch(addr)
@@ -324,13 +386,14 @@ func (s *StateDB) GetHotState(addr common.Address) {
 }
 
 func (s *StateDB) GetNonce(addr common.Address) uint64 {
-
-	stateObject := s.getStateObject(addr)
-	if stateObject != nil {
-		return stateObject.Nonce()
+	var nonce uint64
+	if stateObject := s.getStateObject(addr); stateObject != nil {
+		nonce = stateObject.Nonce()
 	}
-
-	return 0
+	if s.recording() {
+		s.recordAccount(addr, hotcache.AccessNonce, new(big.Int).SetUint64(nonce).Bytes(), true)
+	}
+	return nonce
 }
 
 // TxIndex returns the current transaction index set by Prepare.
@@ -339,7 +402,7 @@ func (s *StateDB) TxIndex() int {
 }
 
 func (s *StateDB) GetCode(addr common.Address) []byte {
-
+	s.recordAccount(addr, hotcache.AccessCode, nil, true)
 	stateObject := s.getStateObject(addr)
 
 	if stateObject != nil {
@@ -349,7 +412,7 @@ func (s *StateDB) GetCode(addr common.Address) []byte {
 }
 
 func (s *StateDB) GetCodeSize(addr common.Address) int {
-
+	s.recordAccount(addr, hotcache.AccessCode, nil, true)
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.CodeSize(s.db)
@@ -358,7 +421,7 @@ func (s *StateDB) GetCodeSize(addr common.Address) int {
 }
 
 func (s *StateDB) GetCodeHash(addr common.Address) common.Hash {
-
+	s.recordAccount(addr, hotcache.AccessCode, nil, true)
 	stateObject := s.getStateObject(addr)
 	if stateObject == nil {
 		return common.Hash{}
@@ -371,8 +434,6 @@ func (s *StateDB) GetState(addr common.Address, hash common.Hash) common.Hash {
 
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
-
-		fmt.Println(addr.String(), hash.String())
 		return stateObject.GetState(s.db, hash)
 	}
 	return common.Hash{}
@@ -467,7 +528,9 @@ func (s *StateDB) AddBalance(addr common.Address, amount *big.Int) {
 	stateObject := s.GetOrNewStateObject(addr)
 
 	if stateObject != nil {
+		prev := stateObject.Balance()
 		stateObject.AddBalance(amount)
+		s.recordBalanceChange(addr, amount, prev, stateObject.Balance())
 	}
 }
 
@@ -476,7 +539,9 @@ func (s *StateDB) SubBalance(addr common.Address, amount *big.Int) {
 	stateObject := s.GetOrNewStateObject(addr)
 
 	if stateObject != nil {
+		prev := stateObject.Balance()
 		stateObject.SubBalance(amount)
+		s.recordBalanceChange(addr, amount, prev, stateObject.Balance())
 	}
 }
 
@@ -485,6 +550,9 @@ func (s *StateDB) SetBalance(addr common.Address, amount *big.Int) {
 
 	if stateObject != nil {
 		stateObject.SetBalance(amount)
+		if s.recording() {
+			s.recordAccount(addr, hotcache.AccessBalance, bigBytes(amount), false)
+		}
 	}
 }
 
@@ -493,6 +561,9 @@ func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
 
 	if stateObject != nil {
 		stateObject.SetNonce(nonce)
+		if s.recording() {
+			s.recordAccount(addr, hotcache.AccessNonce, new(big.Int).SetUint64(nonce).Bytes(), false)
+		}
 	}
 }
 
@@ -500,7 +571,9 @@ func (s *StateDB) SetCode(addr common.Address, code []byte) {
 	stateObject := s.GetOrNewStateObject(addr)
 
 	if stateObject != nil {
-		stateObject.SetCode(crypto.Keccak256Hash(code), code)
+		codeHash := crypto.Keccak256Hash(code)
+		stateObject.SetCode(codeHash, code)
+		s.recordAccount(addr, hotcache.AccessCode, codeHash.Bytes(), false)
 	}
 }
 
@@ -541,6 +614,8 @@ func (s *StateDB) Suicide(addr common.Address) bool {
 	stateObject.markSuicided()
 	stateObject.data.Balance = new(big.Int)
 
+	s.recordAccount(addr, hotcache.AccessExistence, nil, false)
+	s.recordAccount(addr, hotcache.AccessBalance, nil, false)
 	return true
 }
 
@@ -627,9 +702,13 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 			s.SnapshotAccountReads += time.Since(start)
 		}
 		if err == nil {
+			s.IO.SnapshotItems++
 			if acc == nil {
 				return nil
 			}
+			if enc, err := rlp.EncodeToBytes(acc); err == nil {
+				s.IO.ReadBytes += uint64(len(enc))
+			}
 			data = &types.StateAccount{
 				Nonce:    acc.Nonce,
 				Balance:  acc.Balance,
@@ -705,6 +784,7 @@ func (s *StateDB) GetOrNewStateObject(addr common.Address) *stateObject {
 	stateObject := s.getStateObject(addr)
 	if stateObject == nil {
 		stateObject, _ = s.createObject(addr)
+		s.recordAccount(addr, hotcache.AccessExistence, nil, false)
 	}
 	return stateObject
 }
@@ -750,6 +830,7 @@ func (s *StateDB) CreateAccount(addr common.Address) {
 	if prev != nil {
 		newObj.setBalance(prev.data.Balance)
 	}
+	s.recordAccount(addr, hotcache.AccessExistence, nil, false)
 }
 
 func (db *StateDB) ForEachStorage(addr common.Address, cb func(key, value common.Hash) bool) error {
@@ -800,6 +881,7 @@ func (s *StateDB) Copy() *StateDB {
 		journal:             newJournal(),
 		hasher:              crypto.NewKeccakState(),
 	}
+	state.trackIO(state.trie)
 	// Copy the dirty states, logs, and preimages
 	for addr := range s.journal.dirties {
 		// As documented [here](https://github.com/ethereum/go-ethereum/pull/16485#issuecomment-380438527),
@@ -887,7 +969,7 @@ func (s *StateDB) Copy() *StateDB {
 func (s *StateDB) Snapshot() int {
 	id := s.nextRevisionId
 	s.nextRevisionId++
-	s.validRevisions = append(s.validRevisions, revision{id, s.journal.length()})
+	s.validRevisions = append(s.validRevisions, revision{id, s.journal.length(), s.GetRWRecorder().Snapshot()})
 	return id
 }
 
@@ -904,6 +986,7 @@ func (s *StateDB) RevertToSnapshot(revid int) {
 
 	// Replay the journal to undo changes and remove invalidated snapshots
 	s.journal.revert(s, snapshot)
+	s.GetRWRecorder().RevertToSnapshot(s.validRevisions[idx].recordIndex)
 	s.validRevisions = s.validRevisions[:idx]
 }
 
@@ -995,6 +1078,7 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	if prefetcher != nil {
 		if trie := prefetcher.trie(common.Hash{}, s.originalRoot); trie != nil {
 			s.trie = trie
+			s.trackIO(trie)
 		}
 	}
 	usedAddrs := make([][]byte, 0, len(s.stateObjectsPending))
@@ -74,6 +74,7 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	}
 	blockContext := NewEVMBlockContext(header, p.bc, nil)
 	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, p.config, cfg)
+	recorder := statedb.GetRWRecorder()
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
 
@@ -82,31 +83,54 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 			return nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
 		}
 		statedb.Prepare(tx.Hash(), i)
+		recorder.BeginTx(blockNumber.Uint64(), i, tx)
+		reads, hashes := stateTimes(statedb)
+		io := statedb.IO
 		time_now := time.Now()
 		receipt, err := applyTransaction(msg, p.config, nil, gp, statedb, blockNumber, blockHash, tx, usedGas, vmenv)
 		time_during := time.Since(time_now)
-		p.bc.hotcache.Recorder.TxExecTime <- hotcache.ExecTime{tx.Hash(), time_during}
+		cost := hotcache.ExecTime{Addr: tx.Hash(), Timedur: time_during, OpCount: vmenv.OpCount()}
+		if receipt != nil {
+			cost.GasUsed = receipt.GasUsed
+		}
+		readsAfter, hashesAfter := stateTimes(statedb)
+		cost.StateRead, cost.Hashing = readsAfter-reads, hashesAfter-hashes
+		cost.EVM = time_during - cost.StateRead - cost.Hashing
+		cost.IO = statedb.IO.Sub(io)
+		p.bc.hotcache.Recorder.ReportExecTime(cost)
 		if err != nil {
 			return nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
 		}
+		// Only the accesses of committed call frames are left as writes by now
+		recorder.EndTx(receipt)
 		receipts = append(receipts, receipt)
 		allLogs = append(allLogs, receipt.Logs...)
 
 	}
-	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
+	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards).
+	// Rewards are not part of any transaction footprint, keep them out of the recorder.
+	wasRecording := statedb.IsRecording()
+	statedb.DisableRecord()
 	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), block.Uncles())
+	if wasRecording {
+		statedb.EnableRecord()
+	}
+	recorder.EndBlock(blockNumber.Uint64(), blockHash)
 
 	return receipts, allLogs, *usedGas, nil
 }
 
+// stateTimes returns the time statedb spent so far on loading state items and
+// on updating and hashing the tries. Both are only tracked if expensive metrics
+// are enabled.
+func stateTimes(statedb *state.StateDB) (reads, hashes time.Duration) {
+	reads = statedb.AccountReads + statedb.StorageReads + statedb.SnapshotAccountReads + statedb.SnapshotStorageReads
+	hashes = statedb.AccountUpdates + statedb.StorageUpdates + statedb.AccountHashes + statedb.StorageHashes
+	return reads, hashes
+}
+
 func applyTransaction(msg types.Message, config *params.ChainConfig, author *common.Address, gp *GasPool, statedb *state.StateDB, blockNumber *big.Int, blockHash common.Hash, tx *types.Transaction, usedGas *uint64, evm *vm.EVM) (*types.Receipt, error) {
 	// Create a new context to be used in the EVM environment.
-
-	statedb.Recorder.NowTxHash = tx.Hash()
-	if tx.To() != nil {
-		statedb.Recorder.NowTxToAddress = *tx.To()
-
-	}
 	txContext := NewEVMTxContext(msg)
 	evm.Reset(txContext, statedb)
 
@@ -121,6 +121,8 @@ type EVM struct {
 	// available gas is calculated in gasCall* according to the 63/64 rule and later
 	// applied in opCall*.
 	callGasTemp uint64
+	// opCount is the number of opcodes executed since the last Reset.
+	opCount uint64
 }
 
 // NewEVM returns a new EVM. The returned EVM is not thread safe and should
@@ -143,6 +145,13 @@ func NewEVM(blockCtx BlockContext, txCtx TxContext, statedb StateDB, chainConfig
 func (evm *EVM) Reset(txCtx TxContext, statedb StateDB) {
 	evm.TxContext = txCtx
 	evm.StateDB = statedb
+	evm.opCount = 0
+}
+
+// OpCount returns the number of opcodes executed, across all call frames, since
+// the EVM was created or last reset.
+func (evm *EVM) OpCount() uint64 {
+	return evm.opCount
 }
 
 // Cancel cancels any running EVM operation. This may be called concurrently and
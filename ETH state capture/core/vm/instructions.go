@@ -21,7 +21,6 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/hotcache"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/holiman/uint256"
 	"golang.org/x/crypto/sha3"
@@ -523,21 +522,12 @@ func opMstore8(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]
 
 func opSload(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
 	loc := scope.Stack.peek()
+	key := *loc
 	hash := common.Hash(loc.Bytes32())
 	val := interpreter.evm.StateDB.GetState(scope.Contract.Address(), hash)
 	loc.SetBytes(val.Bytes())
 
-	rwRecorder := interpreter.evm.StateDB.GetRWRecorder()
-	addr := scope.Contract.Address()
-	rwRecorder.RWChan <- &hotcache.RWS{
-		NowTxHash:  rwRecorder.NowTxHash,
-		Address:    &addr,
-		BlkNum:     rwRecorder.NowBLKNUM,
-		NowBLKNUM:  rwRecorder.NowBLKNUM,
-		Slot_key:   *loc,
-		Slot_value: val.Bytes(),
-		IsRead:     true,
-	}
+	interpreter.evm.StateDB.GetRWRecorder().RecordStorage(scope.Contract.Address(), key, val.Bytes(), val.Bytes(), true)
 	return nil, nil
 }
 
@@ -548,21 +538,16 @@ func opSstore(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]b
 	}
 	loc := scope.Stack.pop()
 	val := scope.Stack.pop()
+	if rwRecorder := interpreter.evm.StateDB.GetRWRecorder(); rwRecorder.Enabled() {
+		// Capture the value being overwritten so no-op stores can be told apart
+		addr := scope.Contract.Address()
+		prev := interpreter.evm.StateDB.GetState(addr, loc.Bytes32())
+		interpreter.evm.StateDB.SetState(addr, loc.Bytes32(), val.Bytes32())
+		rwRecorder.RecordStorage(addr, loc, prev.Bytes(), common.Hash(val.Bytes32()).Bytes(), false)
+		return nil, nil
+	}
 	interpreter.evm.StateDB.SetState(scope.Contract.Address(),
 		loc.Bytes32(), val.Bytes32())
-
-	rwRecorder := interpreter.evm.StateDB.GetRWRecorder()
-	addr := scope.Contract.Address()
-
-	rwRecorder.RWChan <- &hotcache.RWS{
-		NowTxHash:  rwRecorder.NowTxHash,
-		NowBLKNUM:  rwRecorder.NowBLKNUM,
-		Address:    &addr,
-		BlkNum:     rwRecorder.NowBLKNUM,
-		Slot_key:   loc,
-		Slot_value: val.Bytes(),
-		IsRead:     false,
-	}
 	return nil, nil
 }
 
@@ -235,6 +235,7 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 			logged = true
 		}
 		// execute the operation
+		in.evm.opCount++
 		res, err = operation.execute(&pc, in, callContext)
 		if err != nil {
 			break
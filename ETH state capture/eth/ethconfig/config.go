@@ -190,6 +190,9 @@ type Config struct {
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
+	// Enables storing the state access sets of every processed transaction
+	RecordAccessSets bool
+
 	// Miscellaneous options
 	DocRoot string `toml:"-"`
 
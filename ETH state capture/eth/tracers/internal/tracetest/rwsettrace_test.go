@@ -0,0 +1,198 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/hotcache"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// rwsetTrace is the result of an rwsetTracer run.
+type rwsetTrace struct {
+	TransactionHash  common.Hash      `json:"transactionHash"`
+	TransactionIndex hexutil.Uint64   `json:"transactionIndex"`
+	Status           hexutil.Uint64   `json:"status"`
+	GasUsed          hexutil.Uint64   `json:"gasUsed"`
+	Invoked          []common.Address `json:"invoked"`
+	Reads            []string         `json:"reads"`
+	Writes           []string         `json:"writes"`
+	SilentWrites     []string         `json:"silentWrites"`
+	Reverted         []string         `json:"reverted"`
+}
+
+// rwsetTracerTest defines a single test to check the rwset tracer against.
+type rwsetTracerTest struct {
+	Genesis *core.Genesis `json:"genesis"`
+	Context *callContext  `json:"context"`
+	Input   string        `json:"input"`
+	Result  *rwsetTrace   `json:"result"`
+}
+
+// TestRWSetTracer checks the read/write sets rebuilt by the rwsetTracer from
+// the execution events against the expected ones, and against the access set
+// recorded by the instrumented state of the capture for the same transaction.
+func TestRWSetTracer(t *testing.T) {
+	files, err := os.ReadDir(filepath.Join("testdata", "rwset_tracer"))
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		file := file // capture range variable
+		t.Run(camel(strings.TrimSuffix(file.Name(), ".json")), func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				test = new(rwsetTracerTest)
+				tx   = new(types.Transaction)
+			)
+			if blob, err := os.ReadFile(filepath.Join("testdata", "rwset_tracer", file.Name())); err != nil {
+				t.Fatalf("failed to read testcase: %v", err)
+			} else if err := json.Unmarshal(blob, test); err != nil {
+				t.Fatalf("failed to parse testcase: %v", err)
+			}
+			if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+				t.Fatalf("failed to parse testcase input: %v", err)
+			}
+			traced := traceRWSet(t, test, tx)
+			if !reflect.DeepEqual(traced, test.Result) {
+				have, _ := json.MarshalIndent(traced, "", " ")
+				want, _ := json.MarshalIndent(test.Result, "", " ")
+				t.Fatalf("trace mismatch: \nhave %s\nwant %s", have, want)
+			}
+			recorded := recordRWSet(t, test, tx)
+			if !reflect.DeepEqual(traced, recorded) {
+				have, _ := json.MarshalIndent(traced, "", " ")
+				want, _ := json.MarshalIndent(recorded, "", " ")
+				t.Fatalf("trace differs from recorded access set: \nhave %s\nwant %s", have, want)
+			}
+		})
+	}
+}
+
+// applyRWSetTest executes the transaction of the test on a fresh copy of its
+// prestate, attaching the recorder to the state and the tracer to the EVM if
+// given.
+func applyRWSetTest(t *testing.T, test *rwsetTracerTest, tx *types.Transaction, recorder *hotcache.RWRecorder, tracer tracers.Tracer) *core.ExecutionResult {
+	var (
+		signer    = types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+		origin, _ = signer.Sender(tx)
+		txContext = vm.TxContext{
+			Origin:   origin,
+			GasPrice: tx.GasPrice(),
+		}
+		context = vm.BlockContext{
+			CanTransfer: core.CanTransfer,
+			Transfer:    core.Transfer,
+			Coinbase:    test.Context.Miner,
+			BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+			Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+			Difficulty:  (*big.Int)(test.Context.Difficulty),
+			GasLimit:    uint64(test.Context.GasLimit),
+		}
+		_, prestate = tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc, false)
+	)
+	statedb, err := state.New(prestate.IntermediateRoot(false), prestate.Database(), nil, recorder)
+	if err != nil {
+		t.Fatalf("failed to open prestate: %v", err)
+	}
+	statedb.Prepare(tx.Hash(), 0)
+	cfg := vm.Config{}
+	if tracer != nil {
+		cfg = vm.Config{Debug: true, Tracer: tracer}
+	}
+	evm := vm.NewEVM(context, txContext, statedb, test.Genesis.Config, cfg)
+	msg, err := tx.AsMessage(signer, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction: %v", err)
+	}
+	result, err := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas())).TransitionDb()
+	if err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	return result
+}
+
+// traceRWSet returns the read/write set rebuilt by the rwsetTracer.
+func traceRWSet(t *testing.T, test *rwsetTracerTest, tx *types.Transaction) *rwsetTrace {
+	tracer, err := tracers.New("rwsetTracer", &tracers.Context{TxHash: tx.Hash()}, nil)
+	if err != nil {
+		t.Fatalf("failed to create rwset tracer: %v", err)
+	}
+	applyRWSetTest(t, test, tx, nil, tracer)
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	ret := new(rwsetTrace)
+	if err := json.Unmarshal(res, ret); err != nil {
+		t.Fatalf("failed to unmarshal trace result: %v", err)
+	}
+	return ret
+}
+
+// recordRWSet returns the access set recorded by the capture, in the form of
+// the tracer result.
+func recordRWSet(t *testing.T, test *rwsetTracerTest, tx *types.Transaction) *rwsetTrace {
+	var (
+		sink     = hotcache.NewMemorySink()
+		recorder = &hotcache.RWRecorder{Sink: sink}
+	)
+	recorder.BeginTx(uint64(test.Context.Number), 0, tx)
+	result := applyRWSetTest(t, test, tx, recorder, nil)
+	receipt := &types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: result.UsedGas}
+	if result.Failed() {
+		receipt.Status = types.ReceiptStatusFailed
+	}
+	recorder.EndTx(receipt)
+	set := sink.Sets()[0]
+
+	invoked := set.Invoked
+	if invoked == nil {
+		invoked = []common.Address{}
+	}
+	return &rwsetTrace{
+		TransactionHash:  set.TxHash,
+		TransactionIndex: hexutil.Uint64(set.TxIndex),
+		Status:           hexutil.Uint64(set.Status),
+		GasUsed:          hexutil.Uint64(set.GasUsed),
+		Invoked:          invoked,
+		Reads:            hotcache.KeyStrings(set.Reads),
+		Writes:           hotcache.KeyStrings(set.Writes),
+		SilentWrites:     hotcache.KeyStrings(set.SilentWrites),
+		Reverted:         hotcache.KeyStrings(set.Reverted),
+	}
+}
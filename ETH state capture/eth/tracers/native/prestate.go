@@ -41,20 +41,48 @@ type account struct {
 	Storage map[common.Hash]common.Hash `json:"storage"`
 }
 
+// diffAccount is an account in diff mode, holding only the changed fields.
+// The nonce is a pointer so that a changed zero nonce is still output, the
+// hex balances are never empty once set.
+type diffAccount struct {
+	Balance string                      `json:"balance,omitempty"`
+	Nonce   *uint64                     `json:"nonce,omitempty"`
+	Code    string                      `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
 type prestateTracer struct {
 	env       *vm.EVM
 	prestate  prestate
+	pre       map[common.Address]*diffAccount // Changed fields before the tx, only in diff mode
+	post      map[common.Address]*diffAccount // Changed fields after the tx, only in diff mode
+	config    prestateTracerConfig
 	create    bool
 	to        common.Address
 	gasLimit  uint64 // Amount of gas bought for the whole tx
 	interrupt uint32 // Atomic flag to signal execution interruption
 	reason    error  // Textual reason for the interruption
+	created   map[common.Address]bool
 }
 
-func newPrestateTracer(ctx *tracers.Context, _ json.RawMessage) (tracers.Tracer, error) {
+type prestateTracerConfig struct {
+	DiffMode bool `json:"diffMode"` // If true, return the changed fields before and after the tx
+}
+
+func newPrestateTracer(ctx *tracers.Context, cfg json.RawMessage) (tracers.Tracer, error) {
+	var config prestateTracerConfig
+	if cfg != nil {
+		if err := json.Unmarshal(cfg, &config); err != nil {
+			return nil, err
+		}
+	}
 	// First callframe contains tx context info
 	// and is populated on start and end.
-	return &prestateTracer{prestate: prestate{}}, nil
+	return &prestateTracer{
+		prestate: prestate{},
+		config:   config,
+		created:  make(map[common.Address]bool),
+	}, nil
 }
 
 // CaptureStart implements the EVMLogger interface to initialize the tracing operation.
@@ -65,6 +93,10 @@ func (t *prestateTracer) CaptureStart(env *vm.EVM, from common.Address, to commo
 
 	t.lookupAccount(from)
 	t.lookupAccount(to)
+	if t.config.DiffMode {
+		// The fee payment is a change of the transaction as well
+		t.lookupAccount(env.Context.Coinbase)
+	}
 
 	// The recipient balance includes the value transferred.
 	toBal := hexutil.MustDecodeBig(t.prestate[to].Balance)
@@ -79,10 +111,17 @@ func (t *prestateTracer) CaptureStart(env *vm.EVM, from common.Address, to commo
 	fromBal.Add(fromBal, new(big.Int).Add(value, consumedGas))
 	t.prestate[from].Balance = hexutil.EncodeBig(fromBal)
 	t.prestate[from].Nonce--
+
+	if create {
+		t.created[to] = true
+	}
 }
 
 // CaptureEnd is called after the call finishes to finalize the tracing.
 func (t *prestateTracer) CaptureEnd(output []byte, gasUsed uint64, _ time.Duration, err error) {
+	if t.config.DiffMode {
+		return // Created accounts are sorted out once the tx is done
+	}
 	if t.create {
 		// Exclude created contract.
 		delete(t.prestate, t.to)
@@ -107,14 +146,18 @@ func (t *prestateTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64,
 	case op == vm.CREATE:
 		addr := scope.Contract.Address()
 		nonce := t.env.StateDB.GetNonce(addr)
-		t.lookupAccount(crypto.CreateAddress(addr, nonce))
+		created := crypto.CreateAddress(addr, nonce)
+		t.lookupAccount(created)
+		t.created[created] = true
 	case stackLen >= 4 && op == vm.CREATE2:
 		offset := stackData[stackLen-2]
 		size := stackData[stackLen-3]
 		init := scope.Memory.GetCopy(int64(offset.Uint64()), int64(size.Uint64()))
 		inithash := crypto.Keccak256(init)
 		salt := stackData[stackLen-4]
-		t.lookupAccount(crypto.CreateAddress2(scope.Contract.Address(), salt.Bytes32(), inithash))
+		created := crypto.CreateAddress2(scope.Contract.Address(), salt.Bytes32(), inithash)
+		t.lookupAccount(created)
+		t.created[created] = true
 	}
 }
 
@@ -135,12 +178,82 @@ func (t *prestateTracer) CaptureTxStart(gasLimit uint64) {
 	t.gasLimit = gasLimit
 }
 
-func (t *prestateTracer) CaptureTxEnd(restGas uint64) {}
+// CaptureTxEnd computes the state diff in diff mode. Every touched account is
+// compared with its final state, and only the fields and storage slots that
+// changed are kept, along with their values before and after the tx. Touched
+// accounts without changes are omitted altogether. Accounts destructed by the
+// tx appear in full in the pre-state and not at all in the post-state,
+// accounts created by it appear in the post-state only, unless the address
+// held something before.
+func (t *prestateTracer) CaptureTxEnd(restGas uint64) {
+	if !t.config.DiffMode || t.env == nil {
+		return
+	}
+	t.pre = make(map[common.Address]*diffAccount)
+	t.post = make(map[common.Address]*diffAccount)
+	for addr, acc := range t.prestate {
+		existed := !t.created[addr] || acc.exists()
+		if t.env.StateDB.HasSuicided(addr) {
+			if existed {
+				nonce := acc.Nonce
+				t.pre[addr] = &diffAccount{Balance: acc.Balance, Nonce: &nonce, Code: acc.Code, Storage: nonEmptySlots(acc.Storage)}
+			}
+			continue
+		}
+		var (
+			pre      = &diffAccount{Storage: make(map[common.Hash]common.Hash)}
+			post     = &diffAccount{Storage: make(map[common.Hash]common.Hash)}
+			modified bool
+		)
+		if balance := bigToHex(t.env.StateDB.GetBalance(addr)); balance != acc.Balance {
+			pre.Balance, post.Balance, modified = acc.Balance, balance, true
+		}
+		if nonce := t.env.StateDB.GetNonce(addr); nonce != acc.Nonce {
+			prev := acc.Nonce
+			pre.Nonce, post.Nonce, modified = &prev, &nonce, true
+		}
+		if code := bytesToHex(t.env.StateDB.GetCode(addr)); code != acc.Code {
+			pre.Code, post.Code, modified = acc.Code, code, true
+		}
+		for key, val := range acc.Storage {
+			newVal := t.env.StateDB.GetState(addr, key)
+			if val == newVal {
+				continue
+			}
+			modified = true
+			// Empty slots are left out, as in the pre-state mode
+			if val != (common.Hash{}) {
+				pre.Storage[key] = val
+			}
+			if newVal != (common.Hash{}) {
+				post.Storage[key] = newVal
+			}
+		}
+		if !modified {
+			continue
+		}
+		if existed {
+			t.pre[addr] = pre
+		}
+		t.post[addr] = post
+	}
+}
 
 // GetResult returns the json-encoded nested list of call traces, and any
 // error arising from the encoding or forceful termination (via `Stop`).
 func (t *prestateTracer) GetResult() (json.RawMessage, error) {
-	res, err := json.Marshal(t.prestate)
+	var (
+		res []byte
+		err error
+	)
+	if t.config.DiffMode {
+		res, err = json.Marshal(struct {
+			Pre  map[common.Address]*diffAccount `json:"pre"`
+			Post map[common.Address]*diffAccount `json:"post"`
+		}{t.pre, t.post})
+	} else {
+		res, err = json.Marshal(t.prestate)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -153,6 +266,22 @@ func (t *prestateTracer) Stop(err error) {
 	atomic.StoreUint32(&t.interrupt, 1)
 }
 
+// exists reports whether the account held anything before the tx.
+func (a *account) exists() bool {
+	return a.Nonce > 0 || a.Code != "0x" || len(nonEmptySlots(a.Storage)) > 0 || a.Balance != "0x0"
+}
+
+// nonEmptySlots returns the storage slots holding a value.
+func nonEmptySlots(storage map[common.Hash]common.Hash) map[common.Hash]common.Hash {
+	slots := make(map[common.Hash]common.Hash)
+	for key, val := range storage {
+		if val != (common.Hash{}) {
+			slots[key] = val
+		}
+	}
+	return slots
+}
+
 // lookupAccount fetches details of an account and adds it to the prestate
 // if it doesn't exist there.
 func (t *prestateTracer) lookupAccount(addr common.Address) {
@@ -0,0 +1,435 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/hotcache"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+func init() {
+	register("rwsetTracer", newRWSetTracer)
+}
+
+// rwsetResult is the read/write set of a transaction, in the form served by
+// debug_getTransactionAccessSet. State keys are rendered as in the captured
+// CSV files.
+type rwsetResult struct {
+	TransactionHash  common.Hash      `json:"transactionHash"`
+	TransactionIndex hexutil.Uint64   `json:"transactionIndex"`
+	Status           hexutil.Uint64   `json:"status"`
+	GasUsed          hexutil.Uint64   `json:"gasUsed"`
+	Invoked          []common.Address `json:"invoked"`
+	Reads            []string         `json:"reads"`
+	Writes           []string         `json:"writes"`
+	SilentWrites     []string         `json:"silentWrites"`
+	Reverted         []string         `json:"reverted"`
+}
+
+// rwsetFrame is an open call frame of the traced transaction.
+type rwsetFrame struct {
+	typ  vm.OpCode
+	addr common.Address // Callee, or the address of a created contract
+	mark int            // Number of accesses buffered when the frame was entered
+}
+
+// rwsetTracer rebuilds the read/write set of a transaction from the execution
+// events of an unmodified EVM. Storage accesses are taken from SLOAD and
+// SSTORE, account accesses from the account opcodes, the call frames and the
+// state transition (nonce and gas purchase of the sender, fee payment to the
+// coinbase), in the order the state is accessed. Accesses of reverted frames
+// are demoted the same way as in the capture, and the stream is folded by the
+// capture's own aggregation, so that silent writes and first-access order
+// match the recorded access sets.
+//
+// Whether an account existed before a call or selfdestruct is looked up when
+// the opcode is reached. The callee of the transaction and the coinbase are
+// only seen after value and fee were paid to them; they are taken as created
+// if they hold exactly the amount paid and neither nonce nor code, as empty
+// accounts are cleared since EIP-161.
+type rwsetTracer struct {
+	env       *vm.EVM
+	ctx       *tracers.Context
+	rules     params.Rules
+	from      common.Address
+	accesses  []hotcache.RWS
+	frames    []rwsetFrame
+	target    common.Address // Callee of the pending call or selfdestruct opcode
+	existed   bool           // Whether target existed when the opcode was reached
+	gasLimit  uint64
+	gasUsed   uint64
+	failed    bool
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+func newRWSetTracer(ctx *tracers.Context, _ json.RawMessage) (tracers.Tracer, error) {
+	return &rwsetTracer{ctx: ctx}, nil
+}
+
+// storage buffers a storage slot access. prev is the value of the slot before
+// the access, value the one read or stored.
+func (t *rwsetTracer) storage(addr common.Address, slot common.Hash, prev, value common.Hash, isRead bool) {
+	t.accesses = append(t.accesses, hotcache.RWS{
+		Address:    &addr,
+		Kind:       hotcache.AccessStorage,
+		Slot_key:   *new(uint256.Int).SetBytes32(slot[:]),
+		Slot_value: value.Bytes(),
+		Prev_value: prev.Bytes(),
+		IsRead:     isRead,
+	})
+}
+
+// account buffers an account-level access.
+func (t *rwsetTracer) account(addr common.Address, kind hotcache.AccessKind, isRead bool) {
+	t.accesses = append(t.accesses, hotcache.RWS{Address: &addr, Kind: kind, IsRead: isRead})
+}
+
+// modify buffers a read-modify-write of an account field.
+func (t *rwsetTracer) modify(addr common.Address, kind hotcache.AccessKind) {
+	t.account(addr, kind, true)
+	t.account(addr, kind, false)
+}
+
+// balance buffers the accesses of adding amount to or subtracting it from the
+// balance of addr, which is created first if it doesn't exist. Zero amounts
+// only touch the account.
+func (t *rwsetTracer) balance(addr common.Address, amount *big.Int, exists bool) {
+	if !exists {
+		t.account(addr, hotcache.AccessExistence, false)
+	}
+	if amount == nil || amount.Sign() == 0 {
+		t.account(addr, hotcache.AccessExistence, true)
+		return
+	}
+	t.modify(addr, hotcache.AccessBalance)
+}
+
+// transfer buffers the accesses of a value transfer between existing accounts.
+func (t *rwsetTracer) transfer(from, to common.Address, value *big.Int) {
+	t.balance(from, value, true)
+	t.balance(to, value, true)
+}
+
+// precompile reports whether addr is a precompiled contract, which has no code
+// to load.
+func (t *rwsetTracer) precompile(addr common.Address) bool {
+	for _, p := range vm.ActivePrecompiles(t.rules) {
+		if p == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// fresh reports whether addr, seen after amount was paid to it, was created by
+// the payment.
+func (t *rwsetTracer) fresh(addr common.Address, amount *big.Int) bool {
+	db := t.env.StateDB
+	if amount == nil {
+		amount = new(big.Int)
+	}
+	return db.GetNonce(addr) == 0 && db.GetCodeSize(addr) == 0 && db.GetBalance(addr).Cmp(amount) == 0
+}
+
+// existedBefore reports whether the callee of a call or selfdestruct existed
+// when the opcode was reached.
+func (t *rwsetTracer) existedBefore(addr common.Address) bool {
+	if addr != t.target {
+		return true
+	}
+	return t.existed
+}
+
+// enter opens a call frame, buffering the accesses made on entering it. The
+// accesses made before the state snapshot of the frame is taken precede the
+// frame, they are kept if it fails.
+func (t *rwsetTracer) enter(typ vm.OpCode, from, to common.Address, value *big.Int, existed bool) {
+	frame := func() {
+		t.frames = append(t.frames, rwsetFrame{typ: typ, addr: to, mark: len(t.accesses)})
+	}
+	switch typ {
+	case vm.CREATE, vm.CREATE2:
+		if typ == vm.CREATE {
+			t.account(from, hotcache.AccessNonce, true) // Address derivation
+		}
+		t.account(from, hotcache.AccessBalance, true)
+		t.modify(from, hotcache.AccessNonce)
+		// Collision check of the new address
+		t.account(to, hotcache.AccessCode, true)
+		t.account(to, hotcache.AccessNonce, true)
+		frame()
+		t.account(to, hotcache.AccessExistence, false)
+		if t.rules.IsEIP158 {
+			t.account(to, hotcache.AccessNonce, false)
+		}
+		t.transfer(from, to, value)
+	case vm.CALL:
+		if value != nil && value.Sign() != 0 {
+			t.account(from, hotcache.AccessBalance, true)
+		}
+		frame()
+		t.account(to, hotcache.AccessExistence, true)
+		if !existed {
+			if !t.precompile(to) && t.rules.IsEIP158 && (value == nil || value.Sign() == 0) {
+				return // Calls to missing accounts are no-ops
+			}
+			t.account(to, hotcache.AccessExistence, false)
+		}
+		t.transfer(from, to, value)
+		if !t.precompile(to) {
+			t.account(to, hotcache.AccessCode, true)
+		}
+	case vm.CALLCODE:
+		// Value is checked but stays with the caller
+		t.account(from, hotcache.AccessBalance, true)
+		frame()
+		if !t.precompile(to) {
+			t.account(to, hotcache.AccessCode, true)
+		}
+	case vm.DELEGATECALL:
+		frame()
+		if !t.precompile(to) {
+			t.account(to, hotcache.AccessCode, true)
+		}
+	case vm.STATICCALL:
+		frame()
+		t.balance(to, nil, existed) // Touched with a zero transfer
+		if !t.precompile(to) {
+			t.account(to, hotcache.AccessCode, true)
+		}
+	case vm.SELFDESTRUCT:
+		frame()
+		t.account(from, hotcache.AccessBalance, true)
+		t.balance(to, value, existed)
+		t.account(from, hotcache.AccessExistence, false)
+		t.account(from, hotcache.AccessBalance, false)
+	}
+}
+
+// exit closes the innermost call frame. Writes of a failed frame never reach
+// the state, its accesses are tagged as reverted and demoted to reads.
+func (t *rwsetTracer) exit(err error) {
+	if len(t.frames) == 0 {
+		return
+	}
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+
+	if err != nil {
+		for i := frame.mark; i < len(t.accesses); i++ {
+			rw := &t.accesses[i]
+			rw.Reverted = true
+			rw.IsRead = true
+		}
+		return
+	}
+	if frame.typ == vm.CREATE || frame.typ == vm.CREATE2 {
+		t.account(frame.addr, hotcache.AccessCode, false)
+	}
+}
+
+// CaptureStart implements the EVMLogger interface to initialize the tracing operation.
+func (t *rwsetTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+	t.from = from
+	t.rules = env.ChainConfig().Rules(env.Context.BlockNumber, env.Context.Random != nil)
+
+	// Nonce and code checks and gas purchase of the sender are never reverted
+	t.account(from, hotcache.AccessNonce, true)
+	t.account(from, hotcache.AccessCode, true)
+	t.account(from, hotcache.AccessBalance, true)
+	t.balance(from, new(big.Int).Mul(new(big.Int).SetUint64(t.gasLimit), t.gasPrice()), true)
+	if create {
+		t.enter(vm.CREATE, from, to, value, false)
+		return
+	}
+	t.modify(from, hotcache.AccessNonce)
+
+	existed := env.StateDB.Exist(to)
+	if existed && (!t.rules.IsEIP158 || (value != nil && value.Sign() != 0) || t.precompile(to)) {
+		existed = !t.fresh(to, value)
+	}
+	t.enter(vm.CALL, from, to, value, existed)
+}
+
+// gasPrice returns the price paid per unit of gas.
+func (t *rwsetTracer) gasPrice() *big.Int {
+	if t.env.TxContext.GasPrice == nil {
+		return new(big.Int)
+	}
+	return t.env.TxContext.GasPrice
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *rwsetTracer) CaptureEnd(output []byte, gasUsed uint64, _ time.Duration, err error) {
+	t.failed = err != nil
+	t.exit(err)
+}
+
+// CaptureState implements the EVMLogger interface to trace a single step of VM execution.
+func (t *rwsetTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if err != nil || atomic.LoadUint32(&t.interrupt) > 0 {
+		return
+	}
+	stackData := scope.Stack.Data()
+	stackLen := len(stackData)
+	switch {
+	case stackLen >= 1 && op == vm.SLOAD:
+		addr, slot := scope.Contract.Address(), common.Hash(stackData[stackLen-1].Bytes32())
+		value := t.env.StateDB.GetState(addr, slot)
+		t.storage(addr, slot, value, value, true)
+	case stackLen >= 2 && op == vm.SSTORE:
+		addr, slot := scope.Contract.Address(), common.Hash(stackData[stackLen-1].Bytes32())
+		t.storage(addr, slot, t.env.StateDB.GetState(addr, slot), common.Hash(stackData[stackLen-2].Bytes32()), false)
+	case op == vm.SELFBALANCE:
+		t.account(scope.Contract.Address(), hotcache.AccessBalance, true)
+	case stackLen >= 1 && op == vm.BALANCE:
+		t.account(common.Address(stackData[stackLen-1].Bytes20()), hotcache.AccessBalance, true)
+	case stackLen >= 1 && (op == vm.EXTCODESIZE || op == vm.EXTCODECOPY):
+		t.account(common.Address(stackData[stackLen-1].Bytes20()), hotcache.AccessCode, true)
+	case stackLen >= 1 && op == vm.EXTCODEHASH:
+		addr := common.Address(stackData[stackLen-1].Bytes20())
+		t.account(addr, hotcache.AccessExistence, true)
+		if !t.env.StateDB.Empty(addr) {
+			t.account(addr, hotcache.AccessCode, true)
+		}
+	case stackLen >= 3 && op == vm.CALL:
+		// The gas of value transfers depends on whether the callee exists
+		t.target = common.Address(stackData[stackLen-2].Bytes20())
+		t.existed = t.env.StateDB.Exist(t.target)
+		if !t.rules.IsEIP158 || !stackData[stackLen-3].IsZero() {
+			t.account(t.target, hotcache.AccessExistence, true)
+		}
+	case stackLen >= 2 && op == vm.STATICCALL:
+		t.target = common.Address(stackData[stackLen-2].Bytes20())
+		t.existed = t.env.StateDB.Exist(t.target)
+	case stackLen >= 1 && op == vm.SELFDESTRUCT:
+		t.target = common.Address(stackData[stackLen-1].Bytes20())
+		t.existed = t.env.StateDB.Exist(t.target)
+		if t.rules.IsEIP150 {
+			t.account(t.target, hotcache.AccessExistence, true)
+			if t.rules.IsEIP158 && t.env.StateDB.Empty(t.target) {
+				t.account(scope.Contract.Address(), hotcache.AccessBalance, true)
+			}
+		}
+	}
+}
+
+// CaptureFault implements the EVMLogger interface to trace an execution fault.
+func (t *rwsetTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, _ *vm.ScopeContext, depth int, err error) {
+}
+
+// CaptureEnter is called when EVM enters a new scope (via call, create or selfdestruct).
+func (t *rwsetTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.enter(typ, from, to, value, t.existedBefore(to))
+}
+
+// CaptureExit is called when EVM exits a scope, even if the scope didn't
+// execute any code.
+func (t *rwsetTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.exit(err)
+}
+
+func (t *rwsetTracer) CaptureTxStart(gasLimit uint64) {
+	t.gasLimit = gasLimit
+}
+
+// CaptureTxEnd records the refund to the sender and the fee payment to the
+// coinbase.
+func (t *rwsetTracer) CaptureTxEnd(restGas uint64) {
+	t.gasUsed = t.gasLimit - restGas
+	if t.env == nil {
+		return
+	}
+	t.balance(t.from, new(big.Int).Mul(new(big.Int).SetUint64(restGas), t.gasPrice()), true)
+
+	tip := new(big.Int).Set(t.gasPrice())
+	if t.env.Context.BaseFee != nil {
+		tip.Sub(tip, t.env.Context.BaseFee)
+	}
+	fee := tip.Mul(tip, new(big.Int).SetUint64(t.gasUsed))
+	coinbase := t.env.Context.Coinbase
+	t.balance(coinbase, fee, coinbase == t.from || !t.fresh(coinbase, fee))
+}
+
+// GetResult returns the json-encoded read/write set of the transaction, and
+// any error arising from the encoding or forceful termination (via `Stop`).
+func (t *rwsetTracer) GetResult() (json.RawMessage, error) {
+	var (
+		sink    = hotcache.NewMemorySink()
+		receipt = &types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: t.gasUsed}
+		txHash  common.Hash
+		txIndex int
+	)
+	if t.failed {
+		receipt.Status = types.ReceiptStatusFailed
+	}
+	if t.ctx != nil {
+		txHash, txIndex = t.ctx.TxHash, t.ctx.TxIndex
+	}
+	sink.BeginTx(0, txIndex, txHash)
+	for i := range t.accesses {
+		sink.Access(&t.accesses[i])
+	}
+	sink.EndTx(receipt)
+	set := sink.Sets()[0]
+
+	keys := func(keys []hotcache.StateKey) []string {
+		strs := make([]string, len(keys))
+		for i, key := range keys {
+			strs[i] = key.String()
+		}
+		return strs
+	}
+	invoked := set.Invoked
+	if invoked == nil {
+		invoked = []common.Address{}
+	}
+	res, err := json.Marshal(&rwsetResult{
+		TransactionHash:  set.TxHash,
+		TransactionIndex: hexutil.Uint64(set.TxIndex),
+		Status:           hexutil.Uint64(set.Status),
+		GasUsed:          hexutil.Uint64(set.GasUsed),
+		Invoked:          invoked,
+		Reads:            keys(set.Reads),
+		Writes:           keys(set.Writes),
+		SilentWrites:     keys(set.SilentWrites),
+		Reverted:         keys(set.Reverted),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(res), t.reason
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *rwsetTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
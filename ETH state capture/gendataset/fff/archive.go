@@ -0,0 +1,66 @@
+package fff
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// stateOverlay is a temporary chain database that reads the trie nodes and
+// contract codes it lacks from an archive database. Everything written, the
+// state of the captured blocks included, stays in the temporary database, and
+// the chain data of the archive is never seen, so the temporary chain only
+// knows the blocks written into it.
+type stateOverlay struct {
+	ethdb.Database
+	archive ethdb.KeyValueReader
+}
+
+func newStateOverlay(db ethdb.Database, archive ethdb.KeyValueReader) *stateOverlay {
+	return &stateOverlay{Database: db, archive: archive}
+}
+
+// isStateKey reports whether key is the key of a trie node or contract code.
+func isStateKey(key []byte) bool {
+	if len(key) == common.HashLength {
+		return true
+	}
+	ok, _ := rawdb.IsCodeKey(key)
+	return ok
+}
+
+// Has implements ethdb.KeyValueReader.
+func (db *stateOverlay) Has(key []byte) (bool, error) {
+	if ok, err := db.Database.Has(key); ok || err != nil || !isStateKey(key) {
+		return ok, err
+	}
+	return db.archive.Has(key)
+}
+
+// Get implements ethdb.KeyValueReader.
+func (db *stateOverlay) Get(key []byte) ([]byte, error) {
+	blob, err := db.Database.Get(key)
+	if err == nil || !isStateKey(key) {
+		return blob, err
+	}
+	if ok, _ := db.archive.Has(key); !ok {
+		return nil, err
+	}
+	return db.archive.Get(key)
+}
+
+// prepareFromArchive turns db, holding nothing but the genesis block, into a
+// chain whose head is block start-1 of the block source, whose state is read
+// from archive. See prepareChain for the blocks written.
+func prepareFromArchive(db ethdb.Database, config *params.ChainConfig, blocks BlockSource, start uint64, archive ethdb.KeyValueReader) error {
+	return prepareChain(db, config, blocks, start, "archive", func(parent *types.Block) error {
+		if ok, _ := archive.Has(parent.Root().Bytes()); !ok {
+			return fmt.Errorf("state %x of block %d missing from source database, is it an archive node?", parent.Root(), parent.NumberU64())
+		}
+		return nil
+	})
+}
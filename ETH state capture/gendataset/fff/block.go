@@ -1,15 +1,18 @@
 package fff
 
 import (
-	"bytes"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -17,6 +20,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/hotcache"
+	"github.com/ethereum/go-ethereum/hotcache/witness"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/node"
@@ -34,8 +38,6 @@ const (
 	TriesInMemory       = 128
 )
 
-var emptyHash = common.Hash{}
-
 type ethstatsConfig struct {
 	URL string `toml:",omitempty"`
 }
@@ -57,18 +59,6 @@ func defaultNodeConfig() node.Config {
 	return cfg
 }
 
-func removeDuplicate(arr []string) []string {
-	resArr := make([]string, 0)
-	tmpMap := make(map[string]interface{})
-	for _, val := range arr {
-		if _, ok := tmpMap[val]; !ok {
-			resArr = append(resArr, val)
-			tmpMap[val] = nil
-		}
-	}
-	return resArr
-}
-
 func makeConfigNode(cfgDataDir string) (*node.Node, gethConfig) {
 	// Load defaults.
 	cfg := gethConfig{
@@ -92,116 +82,299 @@ func makeConfigNode(cfgDataDir string) (*node.Node, gethConfig) {
 	return stack, cfg
 }
 
-func writeTestLogs(bc *core.BlockChain, filename string, hotcache_ *hotcache.Hotcache) {
-	file, err := os.Create(filename + ".csv")
-	if err != nil {
-		fmt.Println(err)
-	}
+// Config holds the settings of a capture run.
+type Config struct {
+	Start     uint64 // First block to capture
+	End       uint64 // Last block to capture (inclusive)
+	Output    string // Path prefix of the output files
+	Format    string // Access set output format, "csv" or "binary"
+	ConfigDir string // Directory of the temporary node configuration
+	Store     bool   // Also store the access sets in the temporary chain database
+	Tokens    bool   // Also write the token transfers and vessel transactions
+	Witness   bool   // Also write the stateless witness of every block
+	StateDump string // State dump of block Start-1 to build the temporary chain from
+
+	// Archive is the database of an archive node holding the state of block
+	// Start-1, read by the temporary chain instead of a state it holds itself.
+	// The temporary database then only needs the genesis, the ancestors of
+	// Start are copied from the block source.
+	Archive ethdb.KeyValueReader
+
+	// TrieCache is the size in megabytes of both the clean and the dirty trie
+	// cache of the temporary chain, 2048 if zero.
+	TrieCache int
+
+	// Genesis replaces the mainnet genesis of the temporary chain, e.g. for
+	// generated chains. Block seals are not verified on such chains.
+	Genesis *core.Genesis
+
+	// TimingRuns is the number of times every block is executed without access
+	// recording to measure the execution times, before it is executed once more
+	// to record the access sets. If zero, the execution times are measured in
+	// the recording pass.
+	TimingRuns int
+
+	// Breakdown enables metrics.EnabledExpensive for the duration of the
+	// capture, which the state read and hashing times of the execution costs
+	// are only measured with. It adds to the measured execution times.
+	Breakdown bool
+}
 
-	writer := csv.NewWriter(file)
-	writer.Comma = ','
-	defer writer.Flush()
-	headline := []string{"BlockNumber", "TxHash", "InvokeAddress", "ReadStateSlot", "WriteStateSlot"}
-	writer.Write(headline)
-	t := time.NewTicker(5 * time.Second)
-	var nowTxHash common.Hash
-	var InvokeAddressList []string
-	var ReadSlotList []string
-	var WriteSlotList []string
+// ErrInterrupted is returned by Gendata if the run was interrupted before the
+// whole block range was captured.
+var ErrInterrupted = errors.New("capture interrupted")
 
-	for {
-		select {
+// captureSink is an access sink backed by an output file.
+type captureSink interface {
+	hotcache.AccessSink
+	Offset() (int64, error)
+	Close() error
+}
 
-		case RW := <-hotcache_.Recorder.RWChan:
-			{
-
-				if nowTxHash == emptyHash {
-					nowTxHash = RW.NowTxHash
-				}
-				if nowTxHash != RW.NowTxHash {
-					InvokeAddressList = removeDuplicate(InvokeAddressList)
-					ReadSlotList = removeDuplicate(ReadSlotList)
-					WriteSlotList = removeDuplicate(WriteSlotList)
-
-					var InvokeAddressString bytes.Buffer
-					for _, v := range InvokeAddressList {
-						InvokeAddressString.WriteString(v + "~")
-					}
-					var ReadAddressString bytes.Buffer
-					for _, v := range ReadSlotList {
-						ReadAddressString.WriteString(v + "~")
-					}
-					var WriteAddressString bytes.Buffer
-					for _, v := range WriteSlotList {
-						WriteAddressString.WriteString(v + "~")
-					}
-					data := []string{strconv.FormatUint(RW.NowBLKNUM, 10), RW.NowTxHash.String(), InvokeAddressString.String(), ReadAddressString.String(), WriteAddressString.String()}
-					writer.Write(data)
-
-					nowTxHash = RW.NowTxHash
-					InvokeAddressList = nil
-					ReadSlotList = nil
-					WriteSlotList = nil
-				}
-				InvokeAddressList = append(InvokeAddressList, RW.Address.String())
-				if RW.IsRead {
-					ReadSlotList = append(ReadSlotList, RW.Address.Hex()+RW.Slot_key.String())
-				} else {
-					WriteSlotList = append(WriteSlotList, RW.Address.Hex()+RW.Slot_key.String())
-				}
+// newCaptureSink creates the access set output file, or reopens it truncated
+// to offset when resuming from a checkpoint.
+func newCaptureSink(format string, prefix string, resume *checkpoint) (captureSink, error) {
+	switch format {
+	case "", "csv":
+		if resume != nil {
+			return hotcache.OpenCSVSink(prefix+".csv", resume.AccessOffset)
+		}
+		return hotcache.NewCSVSink(prefix + ".csv")
+	case "binary":
+		if resume != nil {
+			return hotcache.OpenTraceSink(prefix+".rwt", resume.AccessOffset)
+		}
+		return hotcache.NewTraceSink(prefix + ".rwt")
+	default:
+		return nil, fmt.Errorf("unknown access set format %q", format)
+	}
+}
 
-			}
+// execTimeHeader holds the columns of the execution time file. The cost
+// breakdown follows the total execution time, so that readers only interested
+// in the latter can keep using the first two columns. The state reads close
+// the row, see hotcache.IOStats.
+var execTimeHeader = []string{"TxHash", "ExecTime(ns)", "EVMTime(ns)", "StateReadTime(ns)", "HashTime(ns)", "GasUsed", "OpCount", "MinExecTime(ns)", "Runs",
+	"CleanNodes", "DirtyNodes", "DiskNodes", "SnapshotItems", "ReadBytes", "DiskBytes"}
+
+// execTimeWriter writes the per-transaction execution costs reported by the
+// recorder into the <prefix>ExecTime.csv file.
+type execTimeWriter struct {
+	file   *os.File
+	writer *csv.Writer
+}
 
-		case <-t.C:
-			{
-				writer.Flush()
-				log.Info("Flushed into disk!")
+func newExecTimeWriter(prefix string, resume *checkpoint) (*execTimeWriter, error) {
+	path := prefix + "ExecTime.csv"
+	if resume != nil {
+		file, err := os.OpenFile(path, os.O_RDWR, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := file.Stat(); err != nil || info.Size() < resume.ExecTimeOffset {
+			file.Close()
+			if err == nil {
+				err = fmt.Errorf("%s is shorter than offset %d", path, resume.ExecTimeOffset)
 			}
+			return nil, err
+		}
+		// Files of older captures lack the cost breakdown, don't mix the two
+		header, err := csv.NewReader(file).Read()
+		if err == nil && strings.Join(header, ",") != strings.Join(execTimeHeader, ",") {
+			err = fmt.Errorf("%s has columns %v, remove the checkpoint to start over", path, header)
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := file.Truncate(resume.ExecTimeOffset); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if _, err := file.Seek(resume.ExecTimeOffset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &execTimeWriter{file: file, writer: csv.NewWriter(file)}, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(file)
+	if err := writer.Write(execTimeHeader); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &execTimeWriter{file: file, writer: writer}, nil
+}
 
+// drain writes every execution time queued so far and flushes the file.
+func (w *execTimeWriter) drain(times chan hotcache.ExecTime) error {
+	for {
+		select {
+		case et := <-times:
+			w.write(txTiming{ExecTime: et, Min: et.Timedur})
+		default:
+			w.writer.Flush()
+			return w.writer.Error()
 		}
 	}
 }
 
-func writeTestLogsExecTime(bc *core.BlockChain, filename string, hotcache_ *hotcache.Hotcache) {
-	file, err := os.Create(filename + "ExecTime.csv")
-	if err != nil {
-		fmt.Println(err)
+// writeAll writes the given execution costs and flushes the file.
+func (w *execTimeWriter) writeAll(timings []txTiming) error {
+	for _, t := range timings {
+		w.write(t)
 	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
 
-	writer := csv.NewWriter(file)
-	writer.Comma = ','
-	defer writer.Flush()
-	headline := []string{"TxHash", "ExecTime(ns)"}
-	writer.Write(headline)
-	t := time.NewTicker(5 * time.Second)
+func (w *execTimeWriter) write(t txTiming) {
+	w.writer.Write([]string{
+		t.Addr.Hex(),
+		strconv.FormatInt(t.Timedur.Nanoseconds(), 10),
+		strconv.FormatInt(t.EVM.Nanoseconds(), 10),
+		strconv.FormatInt(t.StateRead.Nanoseconds(), 10),
+		strconv.FormatInt(t.Hashing.Nanoseconds(), 10),
+		strconv.FormatUint(t.GasUsed, 10),
+		strconv.FormatUint(t.OpCount, 10),
+		strconv.FormatInt(t.Min.Nanoseconds(), 10),
+		strconv.Itoa(t.Runs),
+		strconv.FormatUint(t.IO.CleanNodes, 10),
+		strconv.FormatUint(t.IO.DirtyNodes, 10),
+		strconv.FormatUint(t.IO.DiskNodes, 10),
+		strconv.FormatUint(t.IO.SnapshotItems, 10),
+		strconv.FormatUint(t.IO.ReadBytes, 10),
+		strconv.FormatUint(t.IO.DiskBytes, 10),
+	})
+}
 
+// discard drops every execution time queued so far.
+func (w *execTimeWriter) discard(times chan hotcache.ExecTime) {
 	for {
 		select {
+		case <-times:
+		default:
+			return
+		}
+	}
+}
 
-		case RW := <-hotcache_.Recorder.TxExecTime:
-			{
+// Offset flushes and syncs the file and returns its size.
+func (w *execTimeWriter) Offset() (int64, error) {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return 0, err
+	}
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+	return w.file.Seek(0, io.SeekCurrent)
+}
 
-				data := []string{RW.Addr.Hex(), strconv.FormatInt(RW.Timedur.Nanoseconds(), 10)}
-				writer.Write(data)
+func (w *execTimeWriter) Close() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
 
-			}
+// Gendata replays the blocks [cfg.Start, cfg.End] of the block source on top
+// of the temporary chain in writeTmp_db, which must hold the state of block
+// cfg.Start-1 or be built from cfg.StateDump or cfg.Archive, and writes the
+// access set and execution time of every transaction. Outputs are flushed at
+// block boundaries and closed before returning, also when interrupt is
+// closed, in which case ErrInterrupted is returned once the block in flight
+// has been processed.
+//
+// After every block a checkpoint is written next to the outputs. If one from
+// a run with the same range and format exists, the outputs are truncated to
+// the checkpointed offsets and the capture continues after its last block. The
+// temporary chain is rewound to that block, and blocks whose state was lost
+// (e.g. when the previous run was killed) are replayed without recording.
+func Gendata(cfg *Config, writeTmp_db ethdb.Database, blocks BlockSource, interrupt <-chan struct{}) (err error) {
+	if cfg.Start == 0 || cfg.End < cfg.Start {
+		return fmt.Errorf("invalid block range %d-%d", cfg.Start, cfg.End)
+	}
+	if cfg.TimingRuns < 0 {
+		return fmt.Errorf("invalid number of timing runs %d", cfg.TimingRuns)
+	}
+	cpPath := checkpointPath(cfg.Output)
+	resume, err := readCheckpoint(cpPath)
+	if err != nil {
+		return err
+	}
+	first := cfg.Start
+	if resume != nil {
+		if !resume.matches(cfg) {
+			return fmt.Errorf("checkpoint %s belongs to capture of blocks %d-%d (%s, %d timing runs, tokens %t, witness %t, breakdown %t), remove it to start over",
+				cpPath, resume.Start, resume.End, resume.Format, resume.Runs, resume.Tokens, resume.Witness, resume.Breakdown)
+		}
+		if block, err := blocks.Block(resume.LastBlock); err != nil {
+			return err
+		} else if block == nil || block.Hash() != resume.LastHash {
+			return fmt.Errorf("checkpointed block %d %x not in block source", resume.LastBlock, resume.LastHash)
+		}
+		if resume.LastBlock >= cfg.End {
+			log.Info("Capture already complete", "checkpoint", cpPath)
+			return nil
+		}
+		first = resume.LastBlock + 1
+		log.Info("Resuming capture", "number", first, "checkpoint", cpPath)
+	}
+	if cfg.StateDump != "" && cfg.Archive != nil {
+		return errors.New("state dump and archive database are mutually exclusive")
+	}
+	if cfg.Archive != nil {
+		writeTmp_db = newStateOverlay(writeTmp_db, cfg.Archive)
+	}
+	stack, config := makeConfigNode(cfg.ConfigDir)
+	defer stack.Close()
 
-		case <-t.C:
-			{
-				writer.Flush()
-				log.Info("Flushed into disk Exectime!")
-			}
+	if cfg.TrieCache > 0 {
+		config.Eth.TrieCleanCache, config.Eth.TrieDirtyCache = cfg.TrieCache, cfg.TrieCache
+	}
 
-		}
+	if cfg.Genesis != nil {
+		config.Eth.Genesis = cfg.Genesis
+		config.Eth.NetworkId = cfg.Genesis.Config.ChainID.Uint64()
+		config.Eth.Ethash.PowMode = ethash.ModeFake
 	}
-}
 
-func Gendata(startC uint64, endC uint64, writeTmp_db *ethdb.Database, read_db *ethdb.Database, filename string, cfgDataDir string) {
-	stack, config := makeConfigNode(cfgDataDir)
+	// The state read and hashing times of the cost breakdown are only tracked
+	// by the StateDB with expensive metrics enabled. Sharded captures enable
+	// them once for all shards.
+	if cfg.Breakdown && !metrics.EnabledExpensive {
+		metrics.EnabledExpensive = true
+		defer func() { metrics.EnabledExpensive = false }()
+	}
 
-	chainConfig, _, _ := core.SetupGenesisBlockWithOverride(*writeTmp_db, config.Eth.Genesis, config.Eth.OverrideTerminalTotalDifficulty, config.Eth.OverrideTerminalTotalDifficultyPassed)
+	chainConfig, _, err := core.SetupGenesisBlockWithOverride(writeTmp_db, config.Eth.Genesis, config.Eth.OverrideTerminalTotalDifficulty, config.Eth.OverrideTerminalTotalDifficultyPassed)
+	if err != nil {
+		return err
+	}
+	switch {
+	case cfg.StateDump != "":
+		if err := prepareFromDump(writeTmp_db, chainConfig, blocks, cfg.Start, cfg.StateDump); err != nil {
+			return err
+		}
+	case cfg.Archive != nil:
+		if err := prepareFromArchive(writeTmp_db, chainConfig, blocks, cfg.Start, cfg.Archive); err != nil {
+			return err
+		}
+	}
+	// The chain is opened at the block preceding the capture, unless the
+	// temporary database never got that far
+	startFrom := first - 1
+	if head := rawdb.ReadHeadBlock(writeTmp_db); head != nil && head.NumberU64() < startFrom {
+		startFrom = head.NumberU64()
+	}
 	cacheConfig := &core.CacheConfig{
-		Start_from:          startC - 1,
+		Start_from:          startFrom,
 		TrieCleanLimit:      config.Eth.TrieCleanCache,
 		TrieCleanJournal:    stack.ResolvePath(config.Eth.TrieCleanCacheJournal),
 		TrieCleanRejournal:  config.Eth.TrieCleanCacheRejournal,
@@ -218,34 +391,196 @@ func Gendata(startC uint64, endC uint64, writeTmp_db *ethdb.Database, read_db *e
 		EnablePreimageRecording: config.Eth.EnablePreimageRecording,
 	}
 
-	bc, ffff, err := core.NewBlockChainHotNni(*writeTmp_db, cacheConfig, chainConfig, ethconfig.CreateConsensusEngine(stack, chainConfig, &config.Eth.Ethash, config.Eth.Miner.Notify,
-		config.Eth.Miner.Noverify, *writeTmp_db), vmConfig, func(header *types.Header) bool { return false }, &config.Eth.TxLookupLimit)
-
+	bc, ffff, err := core.NewBlockChainHotNni(writeTmp_db, cacheConfig, chainConfig, ethconfig.CreateConsensusEngine(stack, chainConfig, &config.Eth.Ethash, config.Eth.Miner.Notify,
+		config.Eth.Miner.Noverify, writeTmp_db), vmConfig, func(header *types.Header) bool { return false }, &config.Eth.TxLookupLimit)
 	if err != nil {
-		log.Error("create blockchain err : %v", 1, err)
+		return fmt.Errorf("create blockchain: %w", err)
 	}
-	var chain_segment types.Blocks
+	defer bc.Stop()
 
-	start_all := time.Now()
-
-	go writeTestLogs(bc, filename, ffff)
-	go writeTestLogsExecTime(bc, filename, ffff)
+	// Blocks past the checkpoint may have been imported by the previous run,
+	// rewind so that they get executed again.
+	if head := bc.CurrentBlock().NumberU64(); head >= first {
+		if err := bc.SetHead(first - 1); err != nil {
+			return fmt.Errorf("rewind temporary chain to %d: %w", first-1, err)
+		}
+	}
+	sink, err := newCaptureSink(cfg.Format, cfg.Output, resume)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := sink.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
-	for index := startC; index <= endC; index++ {
+	execTimes, err := newExecTimeWriter(cfg.Output, resume)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := execTimes.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	// Replay the blocks between the temporary chain's head and the capture
+	// start, their accesses are either already captured or out of range
+	if head := bc.CurrentBlock().NumberU64(); head+1 < first {
+		log.Info("Replaying blocks without capture", "from", head+1, "to", first-1)
+		for index := head + 1; index < first; index++ {
+			select {
+			case <-interrupt:
+				return ErrInterrupted
+			default:
+			}
+			block, err := blocks.Block(index)
+			if err != nil {
+				return err
+			}
+			if block == nil {
+				return fmt.Errorf("block %d missing from block source", index)
+			}
+			if _, err := bc.InsertChain(types.Blocks{block}); err != nil {
+				return fmt.Errorf("insert block %d: %w", index, err)
+			}
+			execTimes.discard(ffff.Recorder.TxExecTime)
+		}
+	}
+	var tokens *hotcache.TokenSink
+	if cfg.Tokens {
+		if resume != nil {
+			tokens, err = hotcache.OpenTokenSink(cfg.Output, resume.TokenOffsets)
+		} else {
+			tokens, err = hotcache.NewTokenSink(cfg.Output)
+		}
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := tokens.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+	var witnesses *witness.Writer
+	if cfg.Witness {
+		if resume != nil {
+			witnesses, err = witness.OpenWriter(witnessPath(cfg.Output), resume.WitnessOffset)
+		} else {
+			witnesses, err = witness.NewWriter(witnessPath(cfg.Output))
+		}
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := witnesses.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+	sinks := hotcache.MultiSink{sink}
+	if cfg.Store {
+		sinks = append(sinks, hotcache.NewDBSink())
+	}
+	if tokens != nil {
+		sinks = append(sinks, tokens)
+	}
+	if len(sinks) == 1 {
+		bc.SetAccessSink(sink)
+	} else {
+		bc.SetAccessSink(sinks)
+	}
 
-		blockHash := rawdb.ReadCanonicalHash(*read_db, index)
-		block := rawdb.ReadBlock(*read_db, blockHash, index)
-		chain_segment = append(chain_segment, block)
+	var (
+		start_all = time.Now()
+		lastLog   = time.Now()
+		total     = cfg.End - first + 1
+		cp        = &checkpoint{Start: cfg.Start, End: cfg.End, Format: cfg.Format, Runs: cfg.TimingRuns, Tokens: cfg.Tokens, Witness: cfg.Witness, Breakdown: cfg.Breakdown}
+	)
+	if cp.Format == "" {
+		cp.Format = "csv"
+	}
+	for index := first; index <= cfg.End; index++ {
+		select {
+		case <-interrupt:
+			log.Warn("Capture interrupted", "last", index-1)
+			return ErrInterrupted
+		default:
+		}
+		block, err := blocks.Block(index)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return fmt.Errorf("block %d missing from block source", index)
+		}
+		// Time the block first, the recording pass runs on the same parent
+		// state but its execution times are skewed by the instrumentation
+		var timings []txTiming
+		if cfg.TimingRuns > 0 {
+			if timings, err = timeBlock(bc, block, cfg.TimingRuns, ffff.Recorder.TxExecTime); err != nil {
+				return err
+			}
+		}
 		ffff.Recorder.NowBLKNUM = block.NumberU64()
-		if _, err := bc.InsertChain(chain_segment); err != nil {
-			log.Error("ERR insert chain")
+		dropped := ffff.Recorder.DroppedExecTimes()
+		if _, err := bc.InsertChain(types.Blocks{block}); err != nil {
+			return fmt.Errorf("insert block %d: %w", index, err)
 		}
-
-		chain_segment = nil
-
-		if index%100 == 0 {
-			log.Info("Prcessed", "blk num", index, "total timeused", time.Since(start_all).Seconds())
+		if cfg.TimingRuns > 0 {
+			execTimes.discard(ffff.Recorder.TxExecTime)
+			err = execTimes.writeAll(timings)
+		} else if n := ffff.Recorder.DroppedExecTimes() - dropped; n > 0 {
+			err = fmt.Errorf("execution times of %d transactions of block %d dropped", n, index)
+		} else {
+			err = execTimes.drain(ffff.Recorder.TxExecTime)
+		}
+		if err != nil {
+			return err
+		}
+		// The witness pass runs on the parent state again once the block is
+		// recorded, so that the caches it warms don't skew the recorded
+		// execution times and state reads
+		if witnesses != nil {
+			w, err := witnessBlock(bc, block, ffff.Recorder.TxExecTime)
+			if err != nil {
+				return err
+			}
+			if err := witnesses.Write(w); err != nil {
+				return err
+			}
+		}
+		cp.LastBlock, cp.LastHash = index, block.Hash()
+		if cp.AccessOffset, err = sink.Offset(); err != nil {
+			return err
+		}
+		if cp.ExecTimeOffset, err = execTimes.Offset(); err != nil {
+			return err
+		}
+		if tokens != nil {
+			if cp.TokenOffsets, err = tokens.Offsets(); err != nil {
+				return err
+			}
+		}
+		if witnesses != nil {
+			if cp.WitnessOffset, err = witnesses.Offset(); err != nil {
+				return err
+			}
+		}
+		if err := cp.write(cpPath); err != nil {
+			return fmt.Errorf("write checkpoint: %w", err)
 		}
 
+		if done := index - first + 1; done == total || time.Since(lastLog) > 8*time.Second {
+			elapsed := time.Since(start_all)
+			eta := time.Duration(float64(elapsed) / float64(done) * float64(total-done))
+			log.Info("Capturing blocks", "number", index, "done", done, "total", total,
+				"elapsed", common.PrettyDuration(elapsed), "eta", common.PrettyDuration(eta))
+			lastLog = time.Now()
+		}
 	}
+	log.Info("Capture finished", "blocks", total, "elapsed", common.PrettyDuration(time.Since(start_all)))
+	return nil
 }
@@ -0,0 +1,90 @@
+package fff
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// checkpoint records the progress of a capture run. It is rewritten after
+// every block, once all outputs of that block have been flushed and synced to
+// disk, so a restarted run can drop whatever was written past it and carry on.
+type checkpoint struct {
+	Start   uint64 `json:"start"`
+	End     uint64 `json:"end"`
+	Format  string `json:"format"`
+	Runs    int    `json:"timingRuns"`
+	Tokens  bool   `json:"tokens"`
+	Witness bool   `json:"witness"`
+
+	Breakdown bool `json:"breakdown"`
+
+	LastBlock uint64      `json:"lastBlock"` // Last block whose outputs are complete
+	LastHash  common.Hash `json:"lastHash"`
+
+	AccessOffset   int64 `json:"accessOffset"`   // Size of the access set file after LastBlock
+	ExecTimeOffset int64 `json:"execTimeOffset"` // Size of the exec time file after LastBlock
+
+	TokenOffsets  []int64 `json:"tokenOffsets,omitempty"`  // Sizes of the token files after LastBlock
+	WitnessOffset int64   `json:"witnessOffset,omitempty"` // Size of the witness file after LastBlock
+}
+
+func checkpointPath(prefix string) string {
+	return prefix + ".checkpoint"
+}
+
+// readCheckpoint loads the checkpoint at path, returning nil if there is none.
+func readCheckpoint(path string) (*checkpoint, error) {
+	blob, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp := new(checkpoint)
+	if err := json.Unmarshal(blob, cp); err != nil {
+		return nil, fmt.Errorf("corrupt checkpoint %s: %v", path, err)
+	}
+	return cp, nil
+}
+
+// matches reports whether the checkpoint was written by a run with the same
+// range, output format, timing mode, cost breakdown and outputs as cfg.
+func (cp *checkpoint) matches(cfg *Config) bool {
+	format := cfg.Format
+	if format == "" {
+		format = "csv"
+	}
+	return cp.Start == cfg.Start && cp.End == cfg.End && cp.Format == format && cp.Runs == cfg.TimingRuns && cp.Tokens == cfg.Tokens &&
+		cp.Witness == cfg.Witness && cp.Breakdown == cfg.Breakdown
+}
+
+// write atomically replaces the checkpoint at path: the new content is synced
+// to a temporary file first and then renamed over the old one.
+func (cp *checkpoint) write(path string) error {
+	blob, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(blob); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,299 @@
+package fff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/hotcache"
+	"github.com/ethereum/go-ethereum/hotcache/rwtrace"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// shardPrefix returns the output prefix of shard i of a capture.
+func shardPrefix(prefix string, i int) string {
+	return fmt.Sprintf("%s_shard%d", prefix, i)
+}
+
+// splitRange divides [start, end] into n contiguous ranges of nearly equal
+// size, fewer if the range holds less than n blocks.
+func splitRange(start, end uint64, n int) [][2]uint64 {
+	total := end - start + 1
+	if uint64(n) > total {
+		n = int(total)
+	}
+	ranges := make([][2]uint64, 0, n)
+	for i := 0; i < n; i++ {
+		first := start + total*uint64(i)/uint64(n)
+		last := start + total*uint64(i+1)/uint64(n) - 1
+		ranges = append(ranges, [2]uint64{first, last})
+	}
+	return ranges
+}
+
+// outputPaths returns the paths of the files written by a capture with the
+// given prefix and settings, the checkpoint excluded.
+func outputPaths(cfg *Config, prefix string) []string {
+	paths := []string{prefix + ".csv", prefix + "ExecTime.csv"}
+	if cfg.Format == "binary" {
+		paths[0] = prefix + ".rwt"
+	}
+	if cfg.Tokens {
+		tokens := hotcache.TokenSinkPaths(prefix)
+		paths = append(paths, tokens[:]...)
+	}
+	if cfg.Witness {
+		paths = append(paths, witnessPath(prefix))
+	}
+	return paths
+}
+
+// GendataSharded captures the range of cfg in up to shards concurrent runs of
+// Gendata over contiguous parts of it, reading the blocks and the state of the
+// block preceding every part from the archive database source. Every shard has
+// a temporary chain database of its own in tmpDir, holding nothing but the
+// chain it built, and writes its outputs next to those of cfg with a "_shard<n>"
+// suffix on the prefix. Once all shards are done, their outputs are merged in
+// block order into the outputs of cfg and removed, and a checkpoint covering
+// the whole range is written.
+//
+// Shards are checkpointed and resumed like a single capture. An interrupt
+// stops all shards, as does the failure of one. The execution times measured
+// by concurrent shards compete for the same cores and caches, so they are best
+// taken with TimingRuns and are still noisier than those of a single capture.
+func GendataSharded(cfg *Config, shards int, source ethdb.Database, tmpDir string, interrupt <-chan struct{}) error {
+	switch {
+	case cfg.Start == 0 || cfg.End < cfg.Start:
+		return fmt.Errorf("invalid block range %d-%d", cfg.Start, cfg.End)
+	case shards < 1:
+		return fmt.Errorf("invalid number of shards %d", shards)
+	case cfg.StateDump != "":
+		return errors.New("sharded captures read the state from the archive database")
+	case cfg.Store:
+		return errors.New("sharded captures can't store the access sets")
+	}
+	cpPath := checkpointPath(cfg.Output)
+	if cp, err := readCheckpoint(cpPath); err != nil {
+		return err
+	} else if cp != nil && cp.matches(cfg) && cp.LastBlock >= cfg.End {
+		log.Info("Capture already complete", "checkpoint", cpPath)
+		return nil
+	}
+	var (
+		ranges  = splitRange(cfg.Start, cfg.End, shards)
+		configs = make([]*Config, len(ranges))
+		errs    = make([]error, len(ranges))
+		cache   = 2048 / len(ranges)
+	)
+	if cache < 128 {
+		cache = 128
+	}
+	for i, r := range ranges {
+		scfg := *cfg
+		scfg.Start, scfg.End = r[0], r[1]
+		scfg.Output = shardPrefix(cfg.Output, i)
+		scfg.Archive = source
+		scfg.TrieCache = cache
+		if cfg.ConfigDir != "" {
+			scfg.ConfigDir = filepath.Join(cfg.ConfigDir, fmt.Sprintf("shard%d", i))
+		}
+		configs[i] = &scfg
+	}
+	// Stop every shard on interrupt or on the first failure
+	var (
+		stop     = make(chan struct{})
+		stopOnce sync.Once
+		halt     = func() { stopOnce.Do(func() { close(stop) }) }
+		done     = make(chan struct{})
+		wg       sync.WaitGroup
+	)
+	go func() {
+		select {
+		case <-interrupt:
+			halt()
+		case <-done:
+		}
+	}()
+	// Set once here, shards only check it
+	if cfg.Breakdown && !metrics.EnabledExpensive {
+		metrics.EnabledExpensive = true
+		defer func() { metrics.EnabledExpensive = false }()
+	}
+
+	log.Info("Starting sharded capture", "start", cfg.Start, "end", cfg.End, "shards", len(ranges))
+	for i := range configs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if errs[i] = captureShard(configs[i], source, filepath.Join(tmpDir, fmt.Sprintf("shard%d", i)), stop); errs[i] != nil && !errors.Is(errs[i], ErrInterrupted) {
+				log.Error("Capture shard failed", "shard", i, "start", configs[i].Start, "end", configs[i].End, "err", errs[i])
+				halt()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(done)
+
+	interrupted := false
+	for i, err := range errs {
+		switch {
+		case errors.Is(err, ErrInterrupted):
+			interrupted = true
+		case err != nil:
+			return fmt.Errorf("shard %d (blocks %d-%d): %w", i, configs[i].Start, configs[i].End, err)
+		}
+	}
+	if interrupted {
+		return ErrInterrupted
+	}
+	return mergeShards(cfg, configs, source)
+}
+
+// captureShard runs a shard on its temporary database at path.
+func captureShard(cfg *Config, source ethdb.Database, path string, interrupt <-chan struct{}) error {
+	db, err := rawdb.NewLevelDBDatabase(path, 256, 256, "", false)
+	if err != nil {
+		return fmt.Errorf("open temporary database: %w", err)
+	}
+	defer db.Close()
+
+	return Gendata(cfg, db, DBBlocks(source), interrupt)
+}
+
+// mergeShards concatenates the outputs of the shards into the outputs of cfg,
+// writes the checkpoint of the complete capture and removes the outputs and
+// checkpoints of the shards.
+func mergeShards(cfg *Config, shards []*Config, source ethdb.Database) error {
+	var (
+		outputs = outputPaths(cfg, cfg.Output)
+		parts   = make([][]string, len(outputs))
+	)
+	for _, shard := range shards {
+		for i, path := range outputPaths(cfg, shard.Output) {
+			parts[i] = append(parts[i], path)
+		}
+	}
+	// The access sets are followed by the exec times, then the token files and
+	// the witness file, as laid out by outputPaths
+	sizes := make([]int64, len(outputs))
+	for i, out := range outputs {
+		var err error
+		switch {
+		case i == 0 && cfg.Format == "binary":
+			err = mergeTraces(out, parts[i])
+		case cfg.Witness && i == len(outputs)-1:
+			err = mergeFiles(out, parts[i], false)
+		default:
+			err = mergeFiles(out, parts[i], true)
+		}
+		if err != nil {
+			return fmt.Errorf("merge %s: %w", out, err)
+		}
+		info, err := os.Stat(out)
+		if err != nil {
+			return err
+		}
+		sizes[i] = info.Size()
+	}
+	cp := &checkpoint{
+		Start: cfg.Start, End: cfg.End, Format: cfg.Format, Runs: cfg.TimingRuns, Tokens: cfg.Tokens, Witness: cfg.Witness, Breakdown: cfg.Breakdown,
+		LastBlock: cfg.End, LastHash: rawdb.ReadCanonicalHash(source, cfg.End),
+		AccessOffset: sizes[0], ExecTimeOffset: sizes[1],
+	}
+	if cp.Format == "" {
+		cp.Format = "csv"
+	}
+	if cfg.Tokens {
+		cp.TokenOffsets = sizes[2:5]
+	}
+	if cfg.Witness {
+		cp.WitnessOffset = sizes[len(sizes)-1]
+	}
+	if err := cp.write(checkpointPath(cfg.Output)); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	for _, shard := range shards {
+		for _, path := range append(outputPaths(cfg, shard.Output), checkpointPath(shard.Output)) {
+			if err := os.Remove(path); err != nil {
+				log.Warn("Failed to remove shard output", "path", path, "err", err)
+			}
+		}
+	}
+	log.Info("Merged capture shards", "shards", len(shards), "output", cfg.Output)
+	return nil
+}
+
+// mergeFiles concatenates the files at paths into out, keeping only the first
+// line of the first file if they start with a header line.
+func mergeFiles(out string, paths []string, header bool) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for i, path := range paths {
+		if err = appendFile(writer, path, header && i > 0); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// appendFile copies the file at path to w, without its first line if
+// skipHeader is set.
+func appendFile(w io.Writer, path string, skipHeader bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if skipHeader {
+		if _, err := reader.ReadString('\n'); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+// mergeTraces re-encodes the blocks of the traces at paths into a new trace
+// at out, as the dictionaries of the traces differ.
+func mergeTraces(out string, paths []string) error {
+	w, err := rwtrace.Create(out)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err = streamTrace(path, w.WriteBlock); err != nil {
+			break
+		}
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func streamTrace(path string, fn func(*rwtrace.Block) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return rwtrace.Stream(bufio.NewReader(file), fn)
+}
@@ -0,0 +1,117 @@
+package fff_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/gendataset/fff"
+	"github.com/ethereum/go-ethereum/gendataset/synth"
+)
+
+// archiveChain imports a synthetic chain into a database keeping the state of
+// every block.
+func archiveChain(t *testing.T, w *synth.Workload) (*core.Genesis, ethdb.Database) {
+	genesis, blocks, _, err := w.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		db          = rawdb.NewMemoryDatabase()
+		txLookup    uint64
+		cacheConfig = &core.CacheConfig{TrieCleanLimit: 16, TrieDirtyDisabled: true, HASize: 1}
+	)
+	genesis.MustCommit(db)
+	bc, hc, err := core.NewBlockChainHotNni(db, cacheConfig, genesis.Config, ethash.NewFaker(), vm.Config{}, nil, &txLookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Stop()
+	for _, block := range blocks {
+		if _, err := bc.InsertChain([]*types.Block{block}); err != nil {
+			t.Fatal(err)
+		}
+		for range block.Transactions() {
+			<-hc.Recorder.TxExecTime
+		}
+		// The chain doesn't flush archive state itself
+		if err := bc.StateCache().TrieDB().Commit(block.Root(), false, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return genesis, db
+}
+
+func TestGendataSharded(t *testing.T) {
+	w := synth.Workload{
+		Accounts:    10,
+		Tokens:      2,
+		Pools:       1,
+		Collections: 1,
+		Blocks:      9,
+		TxsPerBlock: 8,
+		Mix:         synth.Mix{Transfer: 1, ERC20: 1, Swap: 1, NFT: 1},
+		Seed:        3,
+		Skew:        1.5,
+		Hotspot:     0.5,
+	}
+	genesis, source := archiveChain(t, &w)
+
+	dir := t.TempDir()
+	single := &fff.Config{Start: 1, End: uint64(w.Blocks), Output: filepath.Join(dir, "single"), Tokens: true, Genesis: genesis, Archive: source}
+	if err := fff.Gendata(single, rawdb.NewMemoryDatabase(), fff.DBBlocks(source), nil); err != nil {
+		t.Fatal(err)
+	}
+	sharded := &fff.Config{Start: 1, End: uint64(w.Blocks), Output: filepath.Join(dir, "sharded"), Tokens: true, Genesis: genesis}
+	if err := fff.GendataSharded(sharded, 4, source, filepath.Join(dir, "tmp"), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, suffix := range []string{".csv", "TokenTx.csv", "Transfers.csv", "vessel.csv"} {
+		want, err := os.ReadFile(single.Output + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := os.ReadFile(sharded.Output + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("sharded %s differs from single capture", suffix)
+		}
+	}
+	// Execution times differ, the transactions must not
+	times := func(path string) []string {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		records, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes := make([]string, len(records))
+		for i, record := range records {
+			hashes[i] = record[0]
+		}
+		return hashes
+	}
+	if have, want := times(sharded.Output+"ExecTime.csv"), times(single.Output+"ExecTime.csv"); len(have) != w.Blocks*w.TxsPerBlock+1 || len(have) != len(want) {
+		t.Errorf("sharded exec times hold %d rows, single capture %d", len(have), len(want))
+	}
+	if matches, _ := filepath.Glob(sharded.Output + "_shard*"); len(matches) != 0 {
+		t.Errorf("shard outputs left behind: %v", matches)
+	}
+	// The merged checkpoint marks the capture complete
+	if err := fff.GendataSharded(sharded, 4, source, filepath.Join(dir, "tmp"), nil); err != nil {
+		t.Fatal(err)
+	}
+}
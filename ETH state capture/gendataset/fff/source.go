@@ -0,0 +1,137 @@
+package fff
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// BlockSource provides the canonical blocks replayed by the capture.
+type BlockSource interface {
+	// Block returns the canonical block with the given number, or nil if the
+	// source doesn't hold it.
+	Block(number uint64) (*types.Block, error)
+}
+
+// dbBlocks reads the canonical blocks of a node database.
+type dbBlocks struct {
+	db ethdb.Reader
+}
+
+// DBBlocks returns a block source reading the canonical chain of db.
+func DBBlocks(db ethdb.Reader) BlockSource {
+	return dbBlocks{db: db}
+}
+
+// Block implements BlockSource.
+func (s dbBlocks) Block(number uint64) (*types.Block, error) {
+	hash := rawdb.ReadCanonicalHash(s.db, number)
+	if hash == (common.Hash{}) {
+		return nil, nil
+	}
+	return rawdb.ReadBlock(s.db, hash, number), nil
+}
+
+// memoryBlocks serves a contiguous list of blocks held in memory.
+type memoryBlocks []*types.Block
+
+// MemoryBlocks returns a block source serving blocks, which have to be
+// consecutive, e.g. a chain made by core.GenerateChain.
+func MemoryBlocks(blocks []*types.Block) BlockSource {
+	return memoryBlocks(blocks)
+}
+
+// Block implements BlockSource.
+func (s memoryBlocks) Block(number uint64) (*types.Block, error) {
+	if len(s) == 0 || number < s[0].NumberU64() {
+		return nil, nil
+	}
+	if i := number - s[0].NumberU64(); i < uint64(len(s)) {
+		return s[i], nil
+	}
+	return nil, nil
+}
+
+// RLPBlocks reads a chain segment exported by `geth export`, gzip compressed
+// if the file name ends in ".gz". The blocks have to be in ascending order and
+// are decoded one at a time as the capture advances, looking up a block before
+// the last one decoded restarts from the beginning of the file.
+type RLPBlocks struct {
+	path   string
+	file   *os.File
+	stream *rlp.Stream
+	next   *types.Block // Last decoded block, not yet passed by a lookup
+	done   bool         // Whether the stream is exhausted
+}
+
+// OpenRLPBlocks opens an exported chain segment.
+func OpenRLPBlocks(path string) (*RLPBlocks, error) {
+	s := &RLPBlocks{path: path}
+	if err := s.rewind(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// rewind (re)opens the file and positions the stream at its first block.
+func (s *RLPBlocks) rewind() error {
+	if s.file != nil {
+		s.file.Close()
+	}
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader = file
+	if strings.HasSuffix(s.path, ".gz") {
+		if reader, err = gzip.NewReader(file); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	s.file, s.stream = file, rlp.NewStream(reader, 0)
+	s.next, s.done = nil, false
+	return nil
+}
+
+// Block implements BlockSource.
+func (s *RLPBlocks) Block(number uint64) (*types.Block, error) {
+	if (s.next != nil && s.next.NumberU64() > number) || (s.next == nil && s.done) {
+		if err := s.rewind(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if s.next == nil {
+			block := new(types.Block)
+			if err := s.stream.Decode(block); err != nil {
+				if errors.Is(err, io.EOF) {
+					s.done = true
+					return nil, nil
+				}
+				return nil, err
+			}
+			s.next = block
+		}
+		switch n := s.next.NumberU64(); {
+		case n == number:
+			return s.next, nil
+		case n > number:
+			return nil, nil // Gap in the export
+		}
+		s.next = nil
+	}
+}
+
+// Close closes the underlying file.
+func (s *RLPBlocks) Close() error {
+	return s.file.Close()
+}
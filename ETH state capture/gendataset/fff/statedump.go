@@ -0,0 +1,299 @@
+package fff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// ancestorBlocks is the number of blocks preceding the capture that are copied
+// from the block source when the temporary chain is built from a state dump.
+// They are needed by BLOCKHASH and the uncle validation, not for their state.
+const ancestorBlocks = 256
+
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// prepareFromDump turns db, holding nothing but the genesis block, into a chain
+// whose head is block start-1 of the block source, with the state loaded from
+// the dump of that block. See prepareChain for the blocks written.
+func prepareFromDump(db ethdb.Database, config *params.ChainConfig, blocks BlockSource, start uint64, dump string) error {
+	return prepareChain(db, config, blocks, start, "dump", func(parent *types.Block) error {
+		root, err := loadStateDump(db, dump)
+		if err != nil {
+			return err
+		}
+		if root != parent.Root() {
+			return fmt.Errorf("state dump root %x does not match block %d root %x", root, parent.NumberU64(), parent.Root())
+		}
+		return nil
+	})
+}
+
+// prepareChain turns db, holding nothing but the genesis block, into a chain
+// whose head is block start-1 of the block source, after loadState provided
+// the state of that block. Up to ancestorBlocks preceding blocks are written
+// as well, without their state. Nothing is done if db is already at start-1
+// or beyond, e.g. when a capture is resumed.
+//
+// The total difficulty of the written blocks is derived from their own
+// difficulties, on top of the terminal total difficulty after the merge. It is
+// only exact if the segment reaches back to genesis, which matters neither for
+// pre-merge replays nor for post-merge ones, but the capture must not cross the
+// merge when started from a pre-merge state.
+func prepareChain(db ethdb.Database, config *params.ChainConfig, blocks BlockSource, start uint64, kind string, loadState func(parent *types.Block) error) error {
+	parentNumber := start - 1
+	if head := rawdb.ReadHeadBlock(db); head != nil && head.NumberU64() >= parentNumber {
+		log.Info("Temporary chain already past state "+kind, "head", head.NumberU64(), kind, parentNumber)
+		return nil
+	}
+	// Collect the contiguous blocks preceding the capture
+	var (
+		from      uint64 = 1
+		ancestors []*types.Block
+	)
+	if parentNumber > ancestorBlocks {
+		from = parentNumber - ancestorBlocks + 1
+	}
+	for number := from; number <= parentNumber; number++ {
+		block, err := blocks.Block(number)
+		if err != nil {
+			return err
+		}
+		if block == nil || (len(ancestors) > 0 && block.ParentHash() != ancestors[len(ancestors)-1].Hash()) {
+			ancestors = ancestors[:0]
+		}
+		if block != nil {
+			ancestors = append(ancestors, block)
+		}
+	}
+	parent := rawdb.ReadBlock(db, rawdb.ReadCanonicalHash(db, 0), 0)
+	if parentNumber > 0 {
+		if len(ancestors) == 0 || ancestors[len(ancestors)-1].NumberU64() != parentNumber {
+			return fmt.Errorf("block %d missing from block source", parentNumber)
+		}
+		parent = ancestors[len(ancestors)-1]
+	}
+	if uint64(len(ancestors)) < ancestorBlocks && uint64(len(ancestors)) < parentNumber {
+		log.Warn("Block source lacks ancestors, BLOCKHASH may fail", "have", len(ancestors), "want", ancestorBlocks)
+	}
+	if err := loadState(parent); err != nil {
+		return err
+	}
+	// Link the blocks into a canonical chain
+	td := new(big.Int)
+	if len(ancestors) > 0 {
+		switch first := ancestors[0]; {
+		case first.NumberU64() == 1:
+			td.Set(rawdb.ReadTd(db, first.ParentHash(), 0))
+		case first.Difficulty().Sign() == 0 && config.TerminalTotalDifficulty != nil:
+			td.Set(config.TerminalTotalDifficulty)
+		default:
+			log.Warn("Approximating total difficulty of pre-merge segment", "from", first.NumberU64())
+		}
+	}
+	batch := db.NewBatch()
+	for _, block := range ancestors {
+		td.Add(td, block.Difficulty())
+		rawdb.WriteBlock(batch, block)
+		rawdb.WriteTd(batch, block.Hash(), block.NumberU64(), td)
+		rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
+	}
+	rawdb.WriteHeadHeaderHash(batch, parent.Hash())
+	rawdb.WriteHeadFastBlockHash(batch, parent.Hash())
+	rawdb.WriteHeadBlockHash(batch, parent.Hash())
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Built temporary chain from state "+kind, "head", parentNumber, "ancestors", len(ancestors), "root", parent.Root())
+	return nil
+}
+
+// storageEncoding tells how the storage entries of a state dump are keyed.
+type storageEncoding int
+
+const (
+	storagePreimages storageEncoding = iota // Slot keys and raw values, as dumped from the trie
+	storageHashed                           // Hashed slot keys and RLP values, as dumped from the snapshot
+)
+
+// loadStateDump writes the state held by a dump into db and returns its root.
+// Both the output of `geth dump` (in full or --iterative form) and of `geth
+// snapshot dump` are accepted. Accounts are keyed by their secure key, so the
+// dumps need not contain address preimages, but trie dumps must have been made
+// with slot preimages for the storage to be rebuilt. Every storage root is
+// checked against the dumped account, and line-by-line dumps must list the
+// accounts in key order, as geth writes them.
+func loadStateDump(db ethdb.KeyValueWriter, path string) (common.Hash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(file))
+	var head struct {
+		Root     string                               `json:"root"`
+		Accounts map[common.Address]state.DumpAccount `json:"accounts"`
+	}
+	if err := dec.Decode(&head); err != nil {
+		return common.Hash{}, fmt.Errorf("invalid state dump %s: %v", path, err)
+	}
+	var (
+		accounts = trie.NewStackTrie(db)
+		encoding = storagePreimages
+		lastKey  []byte
+		count    int
+	)
+	add := func(account *state.DumpAccount) error {
+		key := []byte(account.SecureKey)
+		if len(key) != common.HashLength {
+			if account.Address == nil {
+				return errors.New("account without address or key")
+			}
+			key = crypto.Keccak256(account.Address[:])
+		}
+		if lastKey != nil && bytes.Compare(key, lastKey) <= 0 {
+			return fmt.Errorf("account %x out of order", key)
+		}
+		lastKey = key
+
+		blob, err := dumpedAccountRLP(db, common.BytesToHash(key), account, &encoding)
+		if err != nil {
+			return fmt.Errorf("account %x: %v", key, err)
+		}
+		if count++; count%100000 == 0 {
+			log.Info("Loading state dump", "accounts", count)
+		}
+		return accounts.TryUpdate(key, blob)
+	}
+	if head.Accounts != nil {
+		// Full dumps are keyed by address, sort them by secure key first
+		list := make([]state.DumpAccount, 0, len(head.Accounts))
+		for addr, account := range head.Accounts {
+			if len(account.SecureKey) != common.HashLength {
+				addr := addr
+				account.Address = &addr
+				account.SecureKey = crypto.Keccak256(addr[:])
+			}
+			list = append(list, account)
+		}
+		sort.Slice(list, func(i, j int) bool { return bytes.Compare(list[i].SecureKey, list[j].SecureKey) < 0 })
+		for i := range list {
+			if err := add(&list[i]); err != nil {
+				return common.Hash{}, err
+			}
+		}
+	} else {
+		for {
+			account := new(state.DumpAccount)
+			if err := dec.Decode(account); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return common.Hash{}, fmt.Errorf("invalid state dump %s: %v", path, err)
+			}
+			if err := add(account); err != nil {
+				return common.Hash{}, err
+			}
+		}
+	}
+	root, err := accounts.Commit()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if want := common.HexToHash(head.Root); head.Root != "" && root != want {
+		return common.Hash{}, fmt.Errorf("state dump %s has root %x, rebuilt %x", path, want, root)
+	}
+	log.Info("Loaded state dump", "accounts", count, "root", root)
+	return root, nil
+}
+
+// dumpedAccountRLP writes the code and storage trie of a dumped account into
+// db and returns the account's RLP encoding. The storage encoding of the dump
+// is detected on the first account with storage.
+func dumpedAccountRLP(db ethdb.KeyValueWriter, key common.Hash, account *state.DumpAccount, encoding *storageEncoding) ([]byte, error) {
+	balance, ok := new(big.Int).SetString(account.Balance, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid balance %q", account.Balance)
+	}
+	codeHash := common.BytesToHash(account.CodeHash)
+	if codeHash != emptyCodeHash {
+		if crypto.Keccak256Hash(account.Code) != codeHash {
+			return nil, errors.New("code missing from dump")
+		}
+		rawdb.WriteCode(db, codeHash, account.Code)
+	}
+	root := common.BytesToHash(account.Root)
+	if root != types.EmptyRootHash {
+		if len(account.Storage) == 0 {
+			return nil, errors.New("storage missing from dump")
+		}
+		// Try the encoding of the previous accounts first
+		found := false
+		for _, enc := range []storageEncoding{*encoding, 1 - *encoding} {
+			if hash, err := buildStorage(nil, key, account.Storage, enc); err == nil && hash == root {
+				*encoding, found = enc, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("storage does not match root %x, was the dump made without preimages?", root)
+		}
+		if _, err := buildStorage(db, key, account.Storage, *encoding); err != nil {
+			return nil, err
+		}
+	}
+	return rlp.EncodeToBytes(&types.StateAccount{
+		Nonce:    account.Nonce,
+		Balance:  balance,
+		Root:     root,
+		CodeHash: codeHash[:],
+	})
+}
+
+// buildStorage builds the storage trie of an account from its dumped slots,
+// writing the nodes into db unless it is nil, and returns its root.
+func buildStorage(db ethdb.KeyValueWriter, owner common.Hash, storage map[common.Hash]string, encoding storageEncoding) (common.Hash, error) {
+	type slot struct{ key, value []byte }
+	slots := make([]slot, 0, len(storage))
+	for key, value := range storage {
+		raw := common.FromHex(value)
+		if encoding == storageHashed {
+			slots = append(slots, slot{key.Bytes(), raw})
+			continue
+		}
+		blob, err := rlp.EncodeToBytes(common.TrimLeftZeroes(raw))
+		if err != nil {
+			return common.Hash{}, err
+		}
+		slots = append(slots, slot{crypto.Keccak256(key[:]), blob})
+	}
+	sort.Slice(slots, func(i, j int) bool { return bytes.Compare(slots[i].key, slots[j].key) < 0 })
+
+	st := trie.NewStackTrieWithOwner(db, owner)
+	for _, s := range slots {
+		if err := st.TryUpdate(s.key, s.value); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	if db == nil {
+		return st.Hash(), nil
+	}
+	return st.Commit()
+}
@@ -0,0 +1,88 @@
+package fff
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/hotcache"
+)
+
+// txTiming is the execution cost of a transaction as written to the exec time
+// file. In timing mode the durations are the medians over Runs executions of
+// the block without access recording, otherwise they are measured once, in
+// the recording pass, and Runs is zero. The state reads are those of the first
+// run, the only one starting from caches not yet warmed by the block.
+type txTiming struct {
+	hotcache.ExecTime
+	Min  time.Duration // Fastest total execution time
+	Runs int
+}
+
+// timeBlock executes block runs times on top of its parent state with access
+// recording disabled, and returns the execution costs of its transactions in
+// block order. Every run starts from a fresh copy of the parent state, nothing
+// is written to the chain.
+func timeBlock(bc *core.BlockChain, block *types.Block, runs int, costs chan hotcache.ExecTime) ([]txTiming, error) {
+	parent := bc.GetHeaderByHash(block.ParentHash())
+	if parent == nil {
+		return nil, fmt.Errorf("parent of block %d missing", block.NumberU64())
+	}
+	txs := block.Transactions()
+	samples := make([][]hotcache.ExecTime, len(txs))
+	for run := 0; run < runs; run++ {
+		// A state without recorder never reaches the access sink
+		statedb, err := bc.StateAt(parent.Root)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, _, err := bc.Processor().Process(block, statedb, *bc.GetVMConfig()); err != nil {
+			return nil, fmt.Errorf("timing run %d of block %d: %w", run, block.NumberU64(), err)
+		}
+		for i := range txs {
+			select {
+			case cost := <-costs:
+				if cost.Addr != txs[i].Hash() {
+					return nil, fmt.Errorf("timing run %d of block %d: unexpected cost of tx %x", run, block.NumberU64(), cost.Addr)
+				}
+				samples[i] = append(samples[i], cost)
+			default:
+				return nil, fmt.Errorf("timing run %d of block %d: missing cost of tx %x", run, block.NumberU64(), txs[i].Hash())
+			}
+		}
+	}
+	timings := make([]txTiming, len(txs))
+	for i, runs := range samples {
+		timings[i] = medianCost(runs)
+	}
+	return timings, nil
+}
+
+// medianCost folds the costs of several executions of a transaction into the
+// median of every duration and the minimum total execution time.
+func medianCost(runs []hotcache.ExecTime) txTiming {
+	median := func(field func(*hotcache.ExecTime) time.Duration) time.Duration {
+		values := make([]time.Duration, len(runs))
+		for i := range runs {
+			values[i] = field(&runs[i])
+		}
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		if n := len(values); n%2 == 0 {
+			return (values[n/2-1] + values[n/2]) / 2
+		}
+		return values[len(values)/2]
+	}
+	t := txTiming{ExecTime: runs[0], Min: runs[0].Timedur, Runs: len(runs)}
+	for _, run := range runs[1:] {
+		if run.Timedur < t.Min {
+			t.Min = run.Timedur
+		}
+	}
+	t.Timedur = median(func(c *hotcache.ExecTime) time.Duration { return c.Timedur })
+	t.EVM = median(func(c *hotcache.ExecTime) time.Duration { return c.EVM })
+	t.StateRead = median(func(c *hotcache.ExecTime) time.Duration { return c.StateRead })
+	t.Hashing = median(func(c *hotcache.ExecTime) time.Duration { return c.Hashing })
+	return t
+}
@@ -0,0 +1,58 @@
+package fff
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/hotcache"
+	"github.com/ethereum/go-ethereum/hotcache/witness"
+)
+
+// witnessPath returns the path of the witness file of a capture.
+func witnessPath(prefix string) string {
+	return prefix + "Witness.rlp"
+}
+
+// witnessBlock executes block on top of its parent state with access recording
+// disabled, and returns the witness of the execution: every trie node resolved
+// from the chain's trie database, every contract code read and the ancestors
+// whose hashes were read. Nothing is written to the chain, the execution costs
+// sent by the processor are dropped.
+func witnessBlock(bc *core.BlockChain, block *types.Block, costs chan hotcache.ExecTime) (*witness.Witness, error) {
+	parent := bc.GetHeaderByHash(block.ParentHash())
+	if parent == nil {
+		return nil, fmt.Errorf("parent of block %d missing", block.NumberU64())
+	}
+	var (
+		recorder = witness.NewRecorder()
+		triedb   = bc.StateCache().TrieDB()
+	)
+	triedb.SetNodeRecorder(recorder.AddNode)
+	defer triedb.SetNodeRecorder(nil)
+
+	// Snapshot reads would bypass the tries, open the state without them
+	statedb, err := state.New(parent.Root, recorder.Database(bc.StateCache()), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	vmConfig := *bc.GetVMConfig()
+	vmConfig.Debug, vmConfig.Tracer = true, recorder
+
+	_, _, _, err = bc.Processor().Process(block, statedb, vmConfig)
+	for range block.Transactions() {
+		select {
+		case <-costs:
+		default:
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("witness run of block %d: %w", block.NumberU64(), err)
+	}
+	// Hashing the post state resolves the nodes needed to update the tries
+	if root := statedb.IntermediateRoot(bc.Config().IsEIP158(block.Number())); root != block.Root() {
+		return nil, fmt.Errorf("witness run of block %d: state root %x, header has %x", block.NumberU64(), root, block.Root())
+	}
+	return recorder.Witness(block, bc)
+}
@@ -0,0 +1,60 @@
+package fff_test
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/gendataset/fff"
+	"github.com/ethereum/go-ethereum/gendataset/synth"
+	"github.com/ethereum/go-ethereum/hotcache/witness"
+)
+
+// Tests that the witnesses written after the recording pass of every block
+// still hold all the state the block reads.
+func TestGendataWitness(t *testing.T) {
+	w := synth.Workload{
+		Accounts:    10,
+		Tokens:      2,
+		Pools:       1,
+		Collections: 1,
+		Blocks:      5,
+		TxsPerBlock: 8,
+		Mix:         synth.Mix{Transfer: 1, ERC20: 1, Swap: 1, NFT: 1},
+		Seed:        5,
+		Skew:        1.5,
+		Hotspot:     0.5,
+	}
+	genesis, source := archiveChain(t, &w)
+
+	cfg := &fff.Config{Start: 1, End: uint64(w.Blocks), Output: filepath.Join(t.TempDir(), "capture"), Witness: true, Genesis: genesis, Archive: source}
+	if err := fff.Gendata(cfg, rawdb.NewMemoryDatabase(), fff.DBBlocks(source), nil); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := witness.OpenReader(cfg.Output + "Witness.rlp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	for number := uint64(1); ; number++ {
+		wit, err := reader.Next()
+		if err == io.EOF {
+			if number != cfg.End+1 {
+				t.Fatalf("witnesses end at block %d, want %d", number-1, cfg.End)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wit.Block.NumberU64() != number {
+			t.Fatalf("witness of block %d, want %d", wit.Block.NumberU64(), number)
+		}
+		if err := witness.Verify(genesis.Config, ethash.NewFaker(), wit); err != nil {
+			t.Errorf("witness of block %d: %v", number, err)
+		}
+	}
+}
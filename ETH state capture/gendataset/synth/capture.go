@@ -0,0 +1,94 @@
+package synth
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/gendataset/fff"
+	"github.com/ethereum/go-ethereum/hotcache/rwtrace"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Capture generates the chain of workload w and captures all of its blocks on
+// top of the generated genesis into db, which has to be empty or hold a
+// previous capture of the same workload. Besides the outputs of fff.Gendata,
+// which always include the token transfers, it writes the ground truth of the
+// workload to <cfg.Output>workload.csv, the genesis to <cfg.Output>genesis.json
+// and the access sets merged with the execution times to
+// <cfg.Output>transactions.csv. The block range and genesis of cfg are set from
+// the workload, only the CSV format is supported.
+func Capture(cfg *fff.Config, w *Workload, db ethdb.Database, interrupt <-chan struct{}) error {
+	if cfg.Format != "" && cfg.Format != "csv" {
+		return fmt.Errorf("synthetic capture needs the csv format, not %q", cfg.Format)
+	}
+	genesis, blocks, txs, err := w.Generate()
+	if err != nil {
+		return err
+	}
+	log.Info("Generated synthetic chain", "blocks", len(blocks), "txs", len(txs), "genesis", blocks[0].ParentHash())
+
+	cfg.Genesis, cfg.Start, cfg.End, cfg.Tokens = genesis, 1, uint64(len(blocks)), true
+	if err := WriteWorkload(cfg.Output, txs); err != nil {
+		return err
+	}
+	if err := writeGenesis(cfg.Output, genesis); err != nil {
+		return err
+	}
+	if err := fff.Gendata(cfg, db, fff.MemoryBlocks(blocks), interrupt); err != nil {
+		return err
+	}
+	return mergeTransactions(cfg.Output)
+}
+
+// writeGenesis writes the genesis to <prefix>genesis.json, for the tools
+// executing the captured blocks with the chain configuration of the workload.
+func writeGenesis(prefix string, genesis *core.Genesis) error {
+	blob, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(prefix+"genesis.json", blob, 0644)
+}
+
+// mergeTransactions joins the access sets and execution times of a capture
+// into <prefix>transactions.csv, the input of the transaction execution.
+func mergeTransactions(prefix string) error {
+	timesFile, err := os.Open(prefix + "ExecTime.csv")
+	if err != nil {
+		return err
+	}
+	execTimes, err := rwtrace.ReadExecTimes(timesFile)
+	timesFile.Close()
+	if err != nil {
+		return fmt.Errorf("%sExecTime.csv: %v", prefix, err)
+	}
+	in, err := os.Open(prefix + ".csv")
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(prefix + "transactions.csv")
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(out)
+	writer.Write(append(rwtrace.CSVHeader[:len(rwtrace.CSVHeader):len(rwtrace.CSVHeader)], rwtrace.ExecTimeColumn))
+
+	err = rwtrace.ReadCSV(in, func(number uint64, tx *rwtrace.Tx) error {
+		return writer.Write(append(rwtrace.CSVRecord(number, tx), strconv.FormatUint(execTimes[tx.Hash], 10)))
+	})
+	if err == nil {
+		writer.Flush()
+		err = writer.Error()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,474 @@
+package synth
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The contracts deployed in the synthetic genesis are minimal versions of the
+// ERC-20, Uniswap V2 style pool and ERC-721 contracts found on mainnet. They
+// only implement the calls issued by the workload, but lay out their storage
+// and emit their events the way the real ones do, so that the captured access
+// sets and decoded transfers look alike. None of them checks allowances.
+
+var (
+	transferSig     = selector("transfer(address,uint256)")
+	transferFromSig = selector("transferFrom(address,address,uint256)")
+	swapSig         = selector("swap(uint256,bool)")
+	mintSig         = selector("mint()")
+
+	transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	swapTopic     = crypto.Keccak256Hash([]byte("Swap(address,uint256,uint256)"))
+)
+
+// erc20Source is the token contract. Balances are stored at
+// keccak256(owner . 0) like in a Solidity mapping declared first. Besides
+// transfer(to, amount) it accepts transferFrom(from, to, amount) from anyone,
+// which the pools use to move the tokens of a swap.
+const erc20Source = `
+;; Memory: 0x80 from, 0xa0 to, 0xc0 amount
+    push 0
+    calldataload
+    push 0xe0
+    shr
+    dup1
+    push {transfer}
+    eq
+    jumpi @transfer
+    push {transferFrom}
+    eq
+    jumpi @transferfrom
+    push 0
+    dup1
+    revert
+transfer:
+    caller
+    push 0x80
+    mstore
+    push 0x04
+    calldataload
+    push 0xa0
+    mstore
+    push 0x24
+    calldataload
+    push 0xc0
+    mstore
+    jump @move
+transferfrom:
+    push 0x04
+    calldataload
+    push 0x80
+    mstore
+    push 0x24
+    calldataload
+    push 0xa0
+    mstore
+    push 0x44
+    calldataload
+    push 0xc0
+    mstore
+move:
+;; balances[from] -= amount, reverting if short
+    push 0x80
+    mload
+    push 0
+    mstore
+    push 0
+    push 0x20
+    mstore
+    push 0x40
+    push 0
+    keccak256
+    dup1
+    sload
+    dup1
+    push 0xc0
+    mload
+    gt
+    jumpi @fail
+    push 0xc0
+    mload
+    swap1
+    sub
+    swap1
+    sstore
+;; balances[to] += amount
+    push 0xa0
+    mload
+    push 0
+    mstore
+    push 0x40
+    push 0
+    keccak256
+    dup1
+    sload
+    push 0xc0
+    mload
+    add
+    swap1
+    sstore
+;; Transfer(from, to, amount)
+    push 0xc0
+    mload
+    push 0
+    mstore
+    push 0xa0
+    mload
+    push 0x80
+    mload
+    push {transferTopic}
+    push 0x20
+    push 0
+    log3
+    push 1
+    push 0
+    mstore
+    push 0x20
+    push 0
+    return
+fail:
+    push 0
+    dup1
+    revert
+`
+
+// poolSource is the constant product pool of a token pair. Slots 0 and 1 hold
+// the token addresses, slots 2 and 3 their reserves, which always match the
+// balances of the pool in the token contracts. swap(amountIn, zeroForOne)
+// pulls amountIn of one token from the caller and pays out the other.
+const poolSource = `
+;; Memory: 0x80 index in, 0xa0 index out, 0xc0 amount in, 0xe0 reserve in,
+;; 0x100 reserve out, 0x120 amount out, 0x200 token call
+    push 0
+    calldataload
+    push 0xe0
+    shr
+    push {swap}
+    eq
+    jumpi @swap
+    push 0
+    dup1
+    revert
+swap:
+    push 0x04
+    calldataload
+    push 0xc0
+    mstore
+    push 0x24
+    calldataload
+    iszero
+    push 0x80
+    mstore
+    push 0x80
+    mload
+    push 1
+    sub
+    push 0xa0
+    mstore
+    push 0x80
+    mload
+    push 2
+    add
+    sload
+    push 0xe0
+    mstore
+    push 0xa0
+    mload
+    push 2
+    add
+    sload
+    push 0x100
+    mstore
+;; amountOut = amountIn * reserveOut / (reserveIn + amountIn)
+    push 0xc0
+    mload
+    push 0xe0
+    mload
+    add
+    push 0x100
+    mload
+    push 0xc0
+    mload
+    mul
+    div
+    push 0x120
+    mstore
+    push 0xc0
+    mload
+    push 0xe0
+    mload
+    add
+    push 0x80
+    mload
+    push 2
+    add
+    sstore
+    push 0x120
+    mload
+    push 0x100
+    mload
+    sub
+    push 0xa0
+    mload
+    push 2
+    add
+    sstore
+;; tokenIn.transferFrom(caller, pool, amountIn)
+    push {transferFromWord}
+    push 0x200
+    mstore
+    caller
+    push 0x204
+    mstore
+    address
+    push 0x224
+    mstore
+    push 0xc0
+    mload
+    push 0x244
+    mstore
+    push 0
+    push 0
+    push 0x64
+    push 0x200
+    push 0
+    push 0x80
+    mload
+    sload
+    gas
+    call
+    iszero
+    jumpi @fail
+;; tokenOut.transferFrom(pool, caller, amountOut)
+    address
+    push 0x204
+    mstore
+    caller
+    push 0x224
+    mstore
+    push 0x120
+    mload
+    push 0x244
+    mstore
+    push 0
+    push 0
+    push 0x64
+    push 0x200
+    push 0
+    push 0xa0
+    mload
+    sload
+    gas
+    call
+    iszero
+    jumpi @fail
+;; Swap(sender, amountIn, amountOut)
+    push 0xc0
+    mload
+    push 0
+    mstore
+    push 0x120
+    mload
+    push 0x20
+    mstore
+    caller
+    push {swapTopic}
+    push 0x40
+    push 0
+    log2
+    stop
+fail:
+    push 0
+    dup1
+    revert
+`
+
+// nftSource is the ERC-721 collection. Owners are stored at keccak256(id . 0),
+// balances at keccak256(owner . 1) and the number of minted tokens, which is
+// also the id of the next one, in slot 2. mint() gives the next token to the
+// caller, transferFrom(from, to, id) only succeeds if the caller is from and
+// owns the token.
+const nftSource = `
+;; Memory: 0x80 from, 0xa0 to, 0xc0 id
+    push 0
+    calldataload
+    push 0xe0
+    shr
+    dup1
+    push {mint}
+    eq
+    jumpi @mint
+    push {transferFrom}
+    eq
+    jumpi @transferfrom
+    push 0
+    dup1
+    revert
+mint:
+    push 2
+    sload
+    dup1
+    push 1
+    add
+    push 2
+    sstore
+    push 0xc0
+    mstore
+    push 0
+    push 0x80
+    mstore
+    caller
+    push 0xa0
+    mstore
+    jump @move
+transferfrom:
+    push 0x04
+    calldataload
+    push 0x80
+    mstore
+    push 0x24
+    calldataload
+    push 0xa0
+    mstore
+    push 0x44
+    calldataload
+    push 0xc0
+    mstore
+    push 0x80
+    mload
+    caller
+    eq
+    iszero
+    jumpi @fail
+    push 0xc0
+    mload
+    push 0
+    mstore
+    push 0
+    push 0x20
+    mstore
+    push 0x40
+    push 0
+    keccak256
+    sload
+    push 0x80
+    mload
+    eq
+    iszero
+    jumpi @fail
+;; balances[from]--
+    push 0x80
+    mload
+    push 0
+    mstore
+    push 1
+    push 0x20
+    mstore
+    push 0x40
+    push 0
+    keccak256
+    push 1
+    dup2
+    sload
+    sub
+    swap1
+    sstore
+move:
+;; owners[id] = to
+    push 0xa0
+    mload
+    push 0xc0
+    mload
+    push 0
+    mstore
+    push 0
+    push 0x20
+    mstore
+    push 0x40
+    push 0
+    keccak256
+    sstore
+;; balances[to]++
+    push 0xa0
+    mload
+    push 0
+    mstore
+    push 1
+    push 0x20
+    mstore
+    push 0x40
+    push 0
+    keccak256
+    dup1
+    sload
+    push 1
+    add
+    swap1
+    sstore
+;; Transfer(from, to, id)
+    push 0xc0
+    mload
+    push 0xa0
+    mload
+    push 0x80
+    mload
+    push {transferTopic}
+    push 0
+    push 0
+    log4
+    stop
+fail:
+    push 0
+    dup1
+    revert
+`
+
+var (
+	erc20Code = compile(erc20Source)
+	poolCode  = compile(poolSource)
+	nftCode   = compile(nftSource)
+)
+
+// compile assembles one of the contract sources, filling in the selectors and
+// event topics.
+func compile(source string) []byte {
+	source = strings.NewReplacer(
+		"{transfer}", selectorHex(transferSig),
+		"{transferFrom}", selectorHex(transferFromSig),
+		"{transferFromWord}", "0x"+new(big.Int).Lsh(new(big.Int).SetUint64(uint64(transferFromSig)), 224).Text(16),
+		"{swap}", selectorHex(swapSig),
+		"{mint}", selectorHex(mintSig),
+		"{transferTopic}", transferTopic.Hex(),
+		"{swapTopic}", swapTopic.Hex(),
+	).Replace(source)
+
+	compiler := asm.NewCompiler(false)
+	compiler.Feed(asm.Lex([]byte(source), false))
+	code, errs := compiler.Compile()
+	if len(errs) > 0 {
+		panic(fmt.Sprintf("invalid contract source: %v", errs))
+	}
+	return common.FromHex(code)
+}
+
+// selectorHex formats a selector as the number pushed by the assembly.
+func selectorHex(v uint32) string {
+	return fmt.Sprintf("0x%08x", v)
+}
+
+// selector returns the function selector of a signature.
+func selector(signature string) uint32 {
+	hash := crypto.Keccak256([]byte(signature))
+	return uint32(hash[0])<<24 | uint32(hash[1])<<16 | uint32(hash[2])<<8 | uint32(hash[3])
+}
+
+// mappingSlot returns the storage slot of key in the Solidity mapping at slot
+// index.
+func mappingSlot(key common.Hash, index uint64) common.Hash {
+	return crypto.Keccak256Hash(key.Bytes(), common.BigToHash(new(big.Int).SetUint64(index)).Bytes())
+}
@@ -0,0 +1,509 @@
+// Package synth generates synthetic chains whose transactions exercise token,
+// pool and NFT contracts with a configurable conflict structure. The chains
+// are captured by the regular pipeline of package fff, the workload file
+// written next to the capture records what every transaction was meant to
+// touch, as ground truth for the conflicts found in the access sets.
+package synth
+
+import (
+	"crypto/ecdsa"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Kinds of generated transactions.
+const (
+	KindTransfer = "transfer" // Ether transfer between two accounts
+	KindERC20    = "erc20"    // Token transfer between two accounts
+	KindSwap     = "swap"     // Swap on a pool, moving both of its tokens
+	KindMint     = "mint"     // Mint of the next token of a collection
+	KindNFT      = "nft"      // Transfer of an owned token of a collection
+)
+
+// Mix holds the relative weights of the generated transaction kinds. NFT
+// transactions mint a token if the sender owns none of the collection.
+type Mix struct {
+	Transfer float64
+	ERC20    float64
+	Swap     float64
+	NFT      float64
+}
+
+// ParseMix parses weights given as comma separated kind=weight pairs, e.g.
+// "transfer=1,erc20=4,swap=3,nft=2". Kinds left out get no weight.
+func ParseMix(s string) (Mix, error) {
+	var mix Mix
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return Mix{}, fmt.Errorf("invalid weight %q", pair)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil {
+			return Mix{}, fmt.Errorf("invalid weight %q: %v", pair, err)
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case KindTransfer:
+			mix.Transfer = weight
+		case KindERC20:
+			mix.ERC20 = weight
+		case KindSwap:
+			mix.Swap = weight
+		case KindNFT:
+			mix.NFT = weight
+		default:
+			return Mix{}, fmt.Errorf("unknown transaction kind %q", kv[0])
+		}
+	}
+	return mix, nil
+}
+
+// String returns the weights in the format read by ParseMix.
+func (m Mix) String() string {
+	return fmt.Sprintf("%s=%v,%s=%v,%s=%v,%s=%v", KindTransfer, m.Transfer, KindERC20, m.ERC20, KindSwap, m.Swap, KindNFT, m.NFT)
+}
+
+// Workload describes a synthetic chain.
+type Workload struct {
+	Accounts    int // Number of funded externally owned accounts
+	Tokens      int // Number of ERC-20 contracts
+	Pools       int // Number of pools, each trading two neighbouring tokens
+	Collections int // Number of NFT contracts
+	Blocks      int // Number of generated blocks
+	TxsPerBlock int // Number of transactions per block
+	Mix         Mix
+	Seed        int64
+
+	// Skew is the exponent of the Zipf distribution accounts and contracts
+	// are picked from, which has to be greater than 1. Zero picks uniformly.
+	Skew float64
+
+	// Hotspot is the probability that a token, pool or NFT transaction goes
+	// to the first contract of its kind, on top of the skewed picks.
+	Hotspot float64
+}
+
+// DefaultWorkload is a small, moderately contended chain.
+var DefaultWorkload = Workload{
+	Accounts:    1000,
+	Tokens:      10,
+	Pools:       5,
+	Collections: 5,
+	Blocks:      100,
+	TxsPerBlock: 100,
+	Mix:         Mix{Transfer: 1, ERC20: 4, Swap: 3, NFT: 2},
+	Seed:        1,
+	Skew:        1.2,
+	Hotspot:     0.1,
+}
+
+const (
+	txGas       = 200000  // Gas limit of contract calls, a swap takes about 70k
+	blockGasCap = 3000000 // Minimum block gas limit of the generated chain
+)
+
+var (
+	// ChainID is the chain id of the generated chains.
+	ChainID = big.NewInt(1337)
+
+	accountFunds = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))
+	tokenFunds   = new(big.Int).Exp(big.NewInt(10), big.NewInt(24), nil)
+	poolReserve  = new(big.Int).Exp(big.NewInt(10), big.NewInt(24), nil)
+)
+
+// Validate checks the workload parameters.
+func (w *Workload) Validate() error {
+	switch {
+	case w.Accounts < 2:
+		return errors.New("need at least two accounts")
+	case w.Blocks < 1 || w.TxsPerBlock < 1:
+		return fmt.Errorf("invalid chain size %d blocks of %d transactions", w.Blocks, w.TxsPerBlock)
+	case w.Tokens < 0 || w.Pools < 0 || w.Collections < 0:
+		return errors.New("negative number of contracts")
+	case w.Pools > 0 && w.Tokens < 2:
+		return errors.New("pools need at least two tokens")
+	case w.Skew != 0 && w.Skew <= 1:
+		return fmt.Errorf("skew %v not greater than 1", w.Skew)
+	case w.Hotspot < 0 || w.Hotspot > 1:
+		return fmt.Errorf("hotspot probability %v out of range", w.Hotspot)
+	case w.Mix.Transfer < 0 || w.Mix.ERC20 < 0 || w.Mix.Swap < 0 || w.Mix.NFT < 0:
+		return errors.New("negative transaction weight")
+	}
+	var (
+		weights = w.weights()
+		total   float64
+	)
+	for _, weight := range weights {
+		total += weight
+	}
+	if total == 0 {
+		return errors.New("no transaction kind enabled for the deployed contracts")
+	}
+	return nil
+}
+
+// weights returns the weights of the transfer, ERC-20, swap and NFT kinds,
+// dropping those lacking contracts.
+func (w *Workload) weights() [4]float64 {
+	weights := [4]float64{w.Mix.Transfer, w.Mix.ERC20, w.Mix.Swap, w.Mix.NFT}
+	if w.Tokens == 0 {
+		weights[1] = 0
+	}
+	if w.Pools == 0 {
+		weights[2] = 0
+	}
+	if w.Collections == 0 {
+		weights[3] = 0
+	}
+	return weights
+}
+
+// Contract addresses are fixed, every kind has its own range.
+func tokenAddress(i int) common.Address      { return contractAddress(0x10000, i) }
+func poolAddress(i int) common.Address       { return contractAddress(0x20000, i) }
+func collectionAddress(i int) common.Address { return contractAddress(0x30000, i) }
+
+func contractAddress(base, i int) common.Address {
+	return common.BigToAddress(big.NewInt(int64(base + i)))
+}
+
+// poolTokens returns the tokens traded by pool i.
+func (w *Workload) poolTokens(i int) (int, int) {
+	return i % w.Tokens, (i + 1) % w.Tokens
+}
+
+// accountKeys derives the keys of the accounts from the seed.
+func (w *Workload) accountKeys() ([]*ecdsa.PrivateKey, []common.Address) {
+	var (
+		keys  = make([]*ecdsa.PrivateKey, w.Accounts)
+		addrs = make([]common.Address, w.Accounts)
+	)
+	for i := range keys {
+		seed := crypto.Keccak256([]byte(fmt.Sprintf("synth-%d-%d", w.Seed, i)))
+		key, err := crypto.ToECDSA(seed)
+		if err != nil {
+			panic(err) // A hash is a valid key with overwhelming probability
+		}
+		keys[i], addrs[i] = key, crypto.PubkeyToAddress(key.PublicKey)
+	}
+	return keys, addrs
+}
+
+// Genesis returns the genesis of the workload's chain: the funded accounts,
+// the tokens holding a balance of every account and pool, and the pools and
+// collections.
+func (w *Workload) Genesis() *core.Genesis {
+	config := *params.AllEthashProtocolChanges
+	config.ChainID = ChainID
+
+	gasLimit := uint64(w.TxsPerBlock) * txGas
+	if gasLimit < blockGasCap {
+		gasLimit = blockGasCap
+	}
+	genesis := &core.Genesis{
+		Config:     &config,
+		GasLimit:   gasLimit,
+		Difficulty: big.NewInt(0x20000),
+		Alloc:      make(core.GenesisAlloc),
+	}
+	_, accounts := w.accountKeys()
+	for _, addr := range accounts {
+		genesis.Alloc[addr] = core.GenesisAccount{Balance: accountFunds}
+	}
+	for i := 0; i < w.Tokens; i++ {
+		storage := make(map[common.Hash]common.Hash)
+		for _, addr := range accounts {
+			storage[mappingSlot(addr.Hash(), 0)] = common.BigToHash(tokenFunds)
+		}
+		for j := 0; j < w.Pools; j++ {
+			if t0, t1 := w.poolTokens(j); t0 == i || t1 == i {
+				storage[mappingSlot(poolAddress(j).Hash(), 0)] = common.BigToHash(poolReserve)
+			}
+		}
+		genesis.Alloc[tokenAddress(i)] = core.GenesisAccount{Balance: common.Big0, Code: erc20Code, Storage: storage}
+	}
+	for i := 0; i < w.Pools; i++ {
+		t0, t1 := w.poolTokens(i)
+		genesis.Alloc[poolAddress(i)] = core.GenesisAccount{
+			Balance: common.Big0,
+			Code:    poolCode,
+			Storage: map[common.Hash]common.Hash{
+				common.BigToHash(common.Big0): tokenAddress(t0).Hash(),
+				common.BigToHash(common.Big1): tokenAddress(t1).Hash(),
+				common.BigToHash(common.Big2): common.BigToHash(poolReserve),
+				common.BigToHash(common.Big3): common.BigToHash(poolReserve),
+			},
+		}
+	}
+	for i := 0; i < w.Collections; i++ {
+		genesis.Alloc[collectionAddress(i)] = core.GenesisAccount{Balance: common.Big0, Code: nftCode}
+	}
+	return genesis
+}
+
+// Tx is the ground truth of a generated transaction.
+type Tx struct {
+	Hash     common.Hash
+	Block    uint64
+	Index    int
+	Kind     string
+	Contract common.Address // Token, pool or collection, zero for transfers
+	From     common.Address
+	To       common.Address // Receiver of the ether, tokens or NFT, the sender for swaps and mints
+}
+
+// picker draws indices in [0, n), uniformly or Zipf distributed.
+type picker struct {
+	rng  *rand.Rand
+	zipf *rand.Zipf
+	n    int
+}
+
+func newPicker(rng *rand.Rand, skew float64, n int) *picker {
+	p := &picker{rng: rng, n: n}
+	if skew != 0 && n > 1 {
+		p.zipf = rand.NewZipf(rng, skew, 1, uint64(n-1))
+	}
+	return p
+}
+
+func (p *picker) pick() int {
+	if p.zipf != nil {
+		return int(p.zipf.Uint64())
+	}
+	return p.rng.Intn(p.n)
+}
+
+// generator draws the transactions of the workload and keeps track of the
+// NFT ownership needed to issue valid transfers.
+type generator struct {
+	w        *Workload
+	rng      *rand.Rand
+	keys     []*ecdsa.PrivateKey
+	accounts []common.Address
+	signer   types.Signer
+
+	senders, receivers   *picker
+	tokens, pools, colls *picker
+	owned                []map[int][]*big.Int // Tokens of every collection by owner index
+	weights              [4]float64
+	total                float64
+}
+
+func newGenerator(w *Workload, config *params.ChainConfig) *generator {
+	keys, accounts := w.accountKeys()
+	rng := rand.New(rand.NewSource(w.Seed))
+	g := &generator{
+		w:         w,
+		rng:       rng,
+		keys:      keys,
+		accounts:  accounts,
+		signer:    types.LatestSigner(config),
+		senders:   newPicker(rng, w.Skew, w.Accounts),
+		receivers: newPicker(rng, w.Skew, w.Accounts),
+		tokens:    newPicker(rng, w.Skew, w.Tokens),
+		pools:     newPicker(rng, w.Skew, w.Pools),
+		colls:     newPicker(rng, w.Skew, w.Collections),
+		owned:     make([]map[int][]*big.Int, w.Collections),
+		weights:   w.weights(),
+	}
+	for i := range g.owned {
+		g.owned[i] = make(map[int][]*big.Int)
+	}
+	for _, weight := range g.weights {
+		g.total += weight
+	}
+	return g
+}
+
+// kind draws the index of a transaction kind by weight, skipping disabled ones.
+func (g *generator) kind() int {
+	var (
+		r    = g.rng.Float64() * g.total
+		last int
+	)
+	for kind, weight := range g.weights {
+		if weight == 0 {
+			continue
+		}
+		if r < weight {
+			return kind
+		}
+		r, last = r-weight, kind
+	}
+	return last // Rounding error on the last enabled kind
+}
+
+// contract picks a contract index, favouring the hotspot.
+func (g *generator) contract(p *picker) int {
+	if g.w.Hotspot > 0 && g.rng.Float64() < g.w.Hotspot {
+		return 0
+	}
+	return p.pick()
+}
+
+// receiver picks an account other than sender.
+func (g *generator) receiver(sender int) int {
+	for {
+		if to := g.receivers.pick(); to != sender {
+			return to
+		}
+	}
+}
+
+// next generates the transaction at index of block b.
+func (g *generator) next(b *core.BlockGen, index int) (*types.Transaction, *Tx) {
+	var (
+		sender = g.senders.pick()
+		from   = g.accounts[sender]
+		tx     = &Tx{Block: b.Number().Uint64(), Index: index, From: from}
+		to     common.Address
+		value  = common.Big0
+		gas    = uint64(txGas)
+		data   []byte
+	)
+	switch g.kind() {
+	case 0:
+		tx.Kind, tx.To = KindTransfer, g.accounts[g.receiver(sender)]
+		to, value, gas = tx.To, big.NewInt(1+g.rng.Int63n(1000)), params.TxGas
+
+	case 1:
+		tx.Kind, tx.Contract, tx.To = KindERC20, tokenAddress(g.contract(g.tokens)), g.accounts[g.receiver(sender)]
+		to, data = tx.Contract, call(transferSig, tx.To.Hash(), common.BigToHash(amount(g.rng)))
+
+	case 2:
+		zeroForOne := common.Big0
+		if g.rng.Intn(2) == 0 {
+			zeroForOne = common.Big1
+		}
+		tx.Kind, tx.Contract, tx.To = KindSwap, poolAddress(g.contract(g.pools)), from
+		to, data = tx.Contract, call(swapSig, common.BigToHash(amount(g.rng)), common.BigToHash(zeroForOne))
+
+	default:
+		coll := g.contract(g.colls)
+		tx.Contract, to = collectionAddress(coll), collectionAddress(coll)
+		if ids := g.owned[coll][sender]; len(ids) > 0 {
+			var (
+				i        = g.rng.Intn(len(ids))
+				id       = ids[i]
+				receiver = g.receiver(sender)
+			)
+			ids[i] = ids[len(ids)-1]
+			g.owned[coll][sender] = ids[:len(ids)-1]
+			g.owned[coll][receiver] = append(g.owned[coll][receiver], id)
+
+			tx.Kind, tx.To = KindNFT, g.accounts[receiver]
+			data = call(transferFromSig, from.Hash(), tx.To.Hash(), common.BigToHash(id))
+		} else {
+			// The id is the number of tokens minted before, as the contract counts
+			var minted int64
+			for _, ids := range g.owned[coll] {
+				minted += int64(len(ids))
+			}
+			g.owned[coll][sender] = append(g.owned[coll][sender], big.NewInt(minted))
+
+			tx.Kind, tx.To = KindMint, from
+			data = call(mintSig)
+		}
+	}
+	signed, err := types.SignTx(types.NewTransaction(b.TxNonce(from), to, value, gas, b.BaseFee(), data), g.signer, g.keys[sender])
+	if err != nil {
+		panic(err)
+	}
+	tx.Hash = signed.Hash()
+	return signed, tx
+}
+
+// amount returns a token amount small enough for the funded balances and
+// reserves to last any workload.
+func amount(rng *rand.Rand) *big.Int {
+	return new(big.Int).Mul(big.NewInt(1+rng.Int63n(1000)), big.NewInt(params.GWei))
+}
+
+// call encodes a call of the function with the given selector.
+func call(selector uint32, args ...common.Hash) []byte {
+	data := []byte{byte(selector >> 24), byte(selector >> 16), byte(selector >> 8), byte(selector)}
+	for _, arg := range args {
+		data = append(data, arg.Bytes()...)
+	}
+	return data
+}
+
+// Generate builds the chain of the workload on top of its genesis. Every
+// generated transaction succeeds, the returned ground truth holds them in
+// chain order.
+func (w *Workload) Generate() (*core.Genesis, []*types.Block, []*Tx, error) {
+	if err := w.Validate(); err != nil {
+		return nil, nil, nil, err
+	}
+	var (
+		genesis = w.Genesis()
+		db      = rawdb.NewMemoryDatabase()
+		gen     = newGenerator(w, genesis.Config)
+		txs     = make([]*Tx, 0, w.Blocks*w.TxsPerBlock)
+	)
+	blocks, receipts := core.GenerateChain(genesis.Config, genesis.MustCommit(db), ethash.NewFaker(), db, w.Blocks, func(i int, b *core.BlockGen) {
+		for j := 0; j < w.TxsPerBlock; j++ {
+			signed, tx := gen.next(b, j)
+			b.AddTx(signed)
+			txs = append(txs, tx)
+		}
+	})
+	for _, block := range receipts {
+		for _, receipt := range block {
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				return nil, nil, nil, fmt.Errorf("transaction %x of block %d failed", receipt.TxHash, receipt.BlockNumber)
+			}
+		}
+	}
+	return genesis, blocks, txs, nil
+}
+
+// WorkloadHeader holds the columns of the workload file.
+var WorkloadHeader = []string{"BlockNumber", "TxHash", "Index", "Kind", "Contract", "From", "To"}
+
+// WriteWorkload writes the ground truth of the generated transactions to
+// <prefix>workload.csv.
+func WriteWorkload(prefix string, txs []*Tx) error {
+	file, err := os.Create(prefix + "workload.csv")
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	writer.Write(WorkloadHeader)
+	for _, tx := range txs {
+		contract := ""
+		if tx.Contract != (common.Address{}) {
+			contract = tx.Contract.Hex()
+		}
+		writer.Write([]string{
+			strconv.FormatUint(tx.Block, 10),
+			tx.Hash.Hex(),
+			strconv.Itoa(tx.Index),
+			tx.Kind,
+			contract,
+			tx.From.Hex(),
+			tx.To.Hex(),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
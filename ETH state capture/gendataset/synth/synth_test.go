@@ -0,0 +1,150 @@
+package synth
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/gendataset/fff"
+	"github.com/ethereum/go-ethereum/hotcache"
+)
+
+var testWorkload = Workload{
+	Accounts:    20,
+	Tokens:      3,
+	Pools:       2,
+	Collections: 2,
+	Blocks:      4,
+	TxsPerBlock: 25,
+	Mix:         Mix{Transfer: 1, ERC20: 1, Swap: 1, NFT: 1},
+	Seed:        7,
+	Skew:        1.5,
+	Hotspot:     0.3,
+}
+
+func TestGenerate(t *testing.T) {
+	w := testWorkload
+	_, blocks, txs, err := w.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != w.Blocks || len(txs) != w.Blocks*w.TxsPerBlock {
+		t.Fatalf("have %d blocks and %d txs, want %d and %d", len(blocks), len(txs), w.Blocks, w.Blocks*w.TxsPerBlock)
+	}
+	kinds := make(map[string]int)
+	for i, tx := range txs {
+		block := blocks[tx.Block-1]
+		if have := block.Transactions()[tx.Index].Hash(); have != tx.Hash {
+			t.Fatalf("tx %d: hash %x, block holds %x", i, tx.Hash, have)
+		}
+		kinds[tx.Kind]++
+	}
+	for _, kind := range []string{KindTransfer, KindERC20, KindSwap, KindMint, KindNFT} {
+		if kinds[kind] == 0 {
+			t.Errorf("no %s transactions generated: %v", kind, kinds)
+		}
+	}
+	// Generation is deterministic
+	_, again, _, err := w.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[len(again)-1].Hash() != blocks[len(blocks)-1].Hash() {
+		t.Error("same workload generated different chains")
+	}
+}
+
+func TestCapture(t *testing.T) {
+	var (
+		w      = testWorkload
+		prefix = filepath.Join(t.TempDir(), "synth_")
+		cfg    = &fff.Config{Output: prefix}
+	)
+	if err := Capture(cfg, &w, rawdb.NewMemoryDatabase(), nil); err != nil {
+		t.Fatal(err)
+	}
+	truth := readCSV(t, prefix+"workload.csv")
+	transactions := readCSV(t, prefix+"transactions.csv")
+	if len(transactions) != len(truth) {
+		t.Fatalf("captured %d transactions, generated %d", len(transactions)-1, len(truth)-1)
+	}
+	// The access sets of token transfers hold the balances of both parties
+	for i, row := range truth[1:] {
+		if row[3] != KindERC20 {
+			continue
+		}
+		captured := transactions[i+1]
+		if captured[1] != row[1] {
+			t.Fatalf("row %d: captured %s, generated %s", i, captured[1], row[1])
+		}
+		for _, party := range row[5:7] {
+			slot := mappingSlot(common.HexToAddress(party).Hash(), 0).Big().Text(16)
+			if !strings.Contains(captured[4], row[4]+"0x"+slot) {
+				t.Errorf("tx %s: balance slot of %s missing from writes %s", row[1], party, captured[4])
+			}
+		}
+	}
+	// The transactions resolve their state from the tries
+	var nodes uint64
+	times := readCSV(t, prefix+"ExecTime.csv")
+	for _, row := range times[1:] {
+		for _, col := range row[9:12] {
+			n, err := strconv.ParseUint(col, 10, 64)
+			if err != nil {
+				t.Fatalf("tx %s: bad node count %q", row[0], col)
+			}
+			nodes += n
+		}
+	}
+	if len(times[0]) != 15 || nodes == 0 {
+		t.Errorf("exec times with columns %v report %d trie nodes read", times[0], nodes)
+	}
+	// The genesis file yields the genesis the chain was captured on
+	blob, err := os.ReadFile(prefix + "genesis.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var genesis core.Genesis
+	if err := json.Unmarshal(blob, &genesis); err != nil {
+		t.Fatal(err)
+	}
+	if genesis.Config.ChainID.Cmp(ChainID) != 0 {
+		t.Errorf("genesis file has chain id %v, want %v", genesis.Config.ChainID, ChainID)
+	}
+	if have, want := genesis.ToBlock().Hash(), w.Genesis().ToBlock().Hash(); have != want {
+		t.Errorf("genesis file yields genesis %x, want %x", have, want)
+	}
+	// Every swap moves both tokens of its pool
+	moves := make(map[string]int)
+	for _, row := range readCSV(t, hotcache.TokenSinkPaths(prefix)[2])[1:] {
+		moves[row[1]]++
+	}
+	for _, row := range truth[1:] {
+		if row[3] == KindSwap && moves[row[1]] != 2 {
+			t.Errorf("swap %s: %d vessel transactions, want 2", row[1], moves[row[1]])
+		}
+	}
+}
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
@@ -1,16 +1,86 @@
 package hotcache
 
 import (
+	"bytes"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/holiman/uint256"
 )
 
 type void struct{}
+
+// ExecTime is the execution cost of a transaction. The state read and hashing
+// times are only measured with metrics.EnabledExpensive, and are zero
+// otherwise. From Byzantium on the tries are hashed once per block instead of
+// after every transaction, so Hashing is normally zero as well.
 type ExecTime struct {
-	Addr    common.Hash
-	Timedur time.Duration
+	Addr      common.Hash   // Transaction hash
+	Timedur   time.Duration // Wall time of applying the transaction
+	EVM       time.Duration // Timedur minus StateRead and Hashing
+	StateRead time.Duration // Account and storage loads, from snapshot or trie
+	Hashing   time.Duration // Trie updates and hashing
+	GasUsed   uint64
+	OpCount   uint64  // Opcodes executed, across all call frames
+	IO        IOStats // State reads of the transaction, by source
+}
+
+// IOStats counts the state a transaction read below the state objects, by
+// where it was found: trie nodes from the clean cache, the dirty cache or the
+// disk, and accounts and storage slots from the snapshot. Only nodes resolved
+// from the trie database are counted: nodes a trie already holds in memory,
+// such as those resolved by an earlier transaction of the block or by the
+// concurrent trie prefetcher the trie was taken over from, are not.
+type IOStats struct {
+	CleanNodes    uint64
+	DirtyNodes    uint64
+	DiskNodes     uint64
+	SnapshotItems uint64
+	ReadBytes     uint64 // Encoded size of everything counted above
+	DiskBytes     uint64 // Encoded size of the nodes read from disk
+}
+
+// Sub returns the reads counted in s but not in o.
+func (s IOStats) Sub(o IOStats) IOStats {
+	return IOStats{
+		CleanNodes:    s.CleanNodes - o.CleanNodes,
+		DirtyNodes:    s.DirtyNodes - o.DirtyNodes,
+		DiskNodes:     s.DiskNodes - o.DiskNodes,
+		SnapshotItems: s.SnapshotItems - o.SnapshotItems,
+		ReadBytes:     s.ReadBytes - o.ReadBytes,
+		DiskBytes:     s.DiskBytes - o.DiskBytes,
+	}
+}
+
+// AccessKind identifies which part of an account a recorded access touched.
+type AccessKind uint8
+
+const (
+	AccessStorage   AccessKind = iota // Contract storage slot (SLOAD/SSTORE)
+	AccessBalance                     // Account balance
+	AccessNonce                       // Account nonce
+	AccessCode                        // Account code, code hash or code size
+	AccessExistence                   // Account existence, creation or self-destruct
+)
+
+func (k AccessKind) String() string {
+	switch k {
+	case AccessStorage:
+		return "storage"
+	case AccessBalance:
+		return "balance"
+	case AccessNonce:
+		return "nonce"
+	case AccessCode:
+		return "code"
+	case AccessExistence:
+		return "existence"
+	default:
+		return "kind" + strconv.Itoa(int(k))
+	}
 }
 
 type RWRecorder struct {
@@ -20,22 +90,49 @@ type RWRecorder struct {
 
 	txIndex int
 
-	RWChan         chan *RWS
+	Sink           AccessSink // Receiver of the captured accesses, nothing is recorded if nil
 	TxExecTime     chan ExecTime
 	NowBLKNUM      uint64
 	NowTxHash      common.Hash
 	NowTxToAddress common.Address
+
+	// Accesses of the running transaction, held back until EndTx so that
+	// writes of reverted call frames can be demoted before they are emitted.
+	// The buffer is reused across transactions.
+	pending []RWS
+
+	droppedExecTimes uint64 // Costs not queued as TxExecTime was full, accessed atomically
 }
 type RWS struct {
 	Address    *common.Address
 	BlkNum     uint64
+	Kind       AccessKind
 	Slot_key   uint256.Int
-	Slot_value []byte
+	Slot_value []byte // Value read, or value written by a store
+	Prev_value []byte // Value held by the slot before the access
 	IsRead     bool
+	Silent     bool // Store writing back the value the slot already held
+	Reverted   bool // Access made in a call frame that was reverted
 	NowTxHash  common.Hash
 	NowBLKNUM  uint64
 }
 
+// StateKey returns the state item touched by the access.
+func (rw *RWS) StateKey() StateKey {
+	key := StateKey{Address: *rw.Address, Kind: rw.Kind}
+	if rw.Kind == AccessStorage {
+		key.Slot = rw.Slot_key.Bytes32()
+	}
+	return key
+}
+
+// Key returns the state item identifier used in the captured read/write sets.
+// Storage accesses are keyed by address and slot, account-level accesses by
+// address and access kind, e.g. "0x...:balance".
+func (rw *RWS) Key() string {
+	return rw.StateKey().String()
+}
+
 func (h *RWRecorder) AddTxID(hash common.Hash, txIndex int) {
 	h.txID = hash
 	h.txIndex = txIndex
@@ -45,13 +142,142 @@ func (h *RWRecorder) GetTxID() common.Hash {
 	return h.txID
 }
 
+// Enabled reports whether accesses are being recorded.
+func (h *RWRecorder) Enabled() bool {
+	return h != nil && h.Sink != nil
+}
+
+// BeginTx starts buffering the accesses of a new transaction, dropping
+// anything left over from a transaction that was never ended.
+func (h *RWRecorder) BeginTx(blockNumber uint64, txIndex int, tx *types.Transaction) {
+	if h == nil {
+		return
+	}
+	h.NowBLKNUM = blockNumber
+	h.NowTxHash = tx.Hash()
+	if to := tx.To(); to != nil {
+		h.NowTxToAddress = *to
+	} else {
+		h.NowTxToAddress = common.Address{}
+	}
+	h.AddTxID(h.NowTxHash, txIndex)
+	h.pending = h.pending[:0]
+
+	if h.Sink != nil {
+		h.Sink.BeginTx(blockNumber, txIndex, h.NowTxHash)
+	}
+}
+
+// EndTx hands the buffered accesses of the current transaction to the sink,
+// followed by the transaction's receipt.
+func (h *RWRecorder) EndTx(receipt *types.Receipt) {
+	if !h.Enabled() {
+		return
+	}
+	for i := range h.pending {
+		h.Sink.Access(&h.pending[i])
+	}
+	h.pending = h.pending[:0]
+	h.Sink.EndTx(receipt)
+}
+
+// EndBlock tells the sink that every transaction of the block was processed.
+func (h *RWRecorder) EndBlock(blockNumber uint64, blockHash common.Hash) {
+	if !h.Enabled() {
+		return
+	}
+	h.Sink.EndBlock(blockNumber, blockHash)
+}
+
+// Snapshot returns a marker of the accesses buffered so far, to be handed
+// back to RevertToSnapshot if the state is reverted to this point.
+func (h *RWRecorder) Snapshot() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.pending)
+}
+
+// RevertToSnapshot tags every access buffered after the marker as reverted.
+// Reverted writes never reach the state and are demoted to reads, they still
+// observed the state and constrain the ordering of the transaction.
+func (h *RWRecorder) RevertToSnapshot(mark int) {
+	if h == nil {
+		return
+	}
+	for i := mark; i < len(h.pending); i++ {
+		rw := &h.pending[i]
+		rw.Reverted = true
+		rw.IsRead = true
+		rw.Silent = false
+	}
+}
+
+// RecordStorage buffers a storage slot access of the current transaction. prev
+// is the value the slot held before the access, value the one read or stored.
+// Stores leaving the slot unchanged are flagged as silent.
+func (h *RWRecorder) RecordStorage(addr common.Address, key uint256.Int, prev, value []byte, isRead bool) {
+	if !h.Enabled() {
+		return
+	}
+	h.pending = append(h.pending, RWS{
+		NowTxHash:  h.NowTxHash,
+		NowBLKNUM:  h.NowBLKNUM,
+		Address:    &addr,
+		BlkNum:     h.NowBLKNUM,
+		Kind:       AccessStorage,
+		Slot_key:   key,
+		Slot_value: value,
+		Prev_value: prev,
+		IsRead:     isRead,
+		Silent:     !isRead && bytes.Equal(prev, value),
+	})
+}
+
+// RecordAccount buffers an account-level (balance, nonce, code or existence)
+// access of the current transaction.
+func (h *RWRecorder) RecordAccount(addr common.Address, kind AccessKind, value []byte, isRead bool) {
+	if !h.Enabled() {
+		return
+	}
+	h.pending = append(h.pending, RWS{
+		NowTxHash:  h.NowTxHash,
+		NowBLKNUM:  h.NowBLKNUM,
+		Address:    &addr,
+		BlkNum:     h.NowBLKNUM,
+		Kind:       kind,
+		Slot_value: value,
+		IsRead:     isRead,
+	})
+}
+
+// execTimeQueue is the capacity of the execution cost queue. Readers drain it
+// after every block, so it only has to hold the transactions of one block,
+// which are at most 1428 on mainnet (30M gas in 21000 gas transfers).
+const execTimeQueue = 4096
+
+// ReportExecTime queues the execution cost of a transaction. Block processing
+// never stalls on a full queue, the cost is counted as dropped instead.
+func (h *RWRecorder) ReportExecTime(cost ExecTime) {
+	select {
+	case h.TxExecTime <- cost:
+	default:
+		atomic.AddUint64(&h.droppedExecTimes, 1)
+	}
+}
+
+// DroppedExecTimes returns the number of execution costs dropped so far for
+// a full queue.
+func (h *RWRecorder) DroppedExecTimes() uint64 {
+	return atomic.LoadUint64(&h.droppedExecTimes)
+}
+
 func (hc *Hotcache) NewRWHook() *RWRecorder {
 	rwr := &RWRecorder{
 
 		txID:       common.Hash{},
 		txIndex:    0,
-		RWChan:     make(chan *RWS, 999999999),
-		TxExecTime: make(chan ExecTime, 1000000),
+		TxExecTime: make(chan ExecTime, execTimeQueue),
 	}
 	//go insert_map_GoRoutine(rwr)
 
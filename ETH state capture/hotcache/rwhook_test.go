@@ -0,0 +1,362 @@
+package hotcache
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/hotcache/rwtrace"
+	"github.com/holiman/uint256"
+)
+
+// recordingSink collects the raw accesses handed to it.
+type recordingSink struct {
+	accesses []RWS
+	ended    int
+}
+
+func (s *recordingSink) BeginTx(uint64, int, common.Hash) {}
+func (s *recordingSink) Access(rw *RWS)                   { s.accesses = append(s.accesses, *rw) }
+func (s *recordingSink) EndTx(*types.Receipt)             { s.ended++ }
+func (s *recordingSink) EndBlock(uint64, common.Hash)     {}
+
+var (
+	testAddr = common.HexToAddress("0x01")
+	testTx   = types.NewTransaction(0, testAddr, common.Big0, 21000, common.Big1, nil)
+)
+
+func TestRecorderRevertDemotesWrites(t *testing.T) {
+	sink := new(recordingSink)
+	rec := &RWRecorder{Sink: sink}
+
+	rec.BeginTx(1, 0, testTx)
+	rec.RecordStorage(testAddr, *uint256.NewInt(1), []byte{0}, []byte{1}, false)
+	mark := rec.Snapshot()
+	rec.RecordStorage(testAddr, *uint256.NewInt(2), []byte{0}, []byte{2}, false)
+	rec.RecordAccount(testAddr, AccessBalance, []byte{5}, true)
+	if len(sink.accesses) != 0 {
+		t.Fatalf("accesses emitted before the transaction ended")
+	}
+	rec.RevertToSnapshot(mark)
+	rec.EndTx(nil)
+
+	got := sink.accesses
+	if len(got) != 3 || sink.ended != 1 {
+		t.Fatalf("emitted %d accesses in %d transactions, want 3 in 1", len(got), sink.ended)
+	}
+	if got[0].IsRead || got[0].Reverted {
+		t.Errorf("committed write was altered: %+v", got[0])
+	}
+	for _, rw := range got[1:] {
+		if !rw.IsRead || !rw.Reverted {
+			t.Errorf("reverted access not demoted to a tagged read: %+v", rw)
+		}
+	}
+}
+
+func TestRecorderDisabledWithoutSink(t *testing.T) {
+	rec := new(RWRecorder)
+	rec.BeginTx(1, 0, testTx)
+	rec.RecordStorage(testAddr, *uint256.NewInt(1), nil, nil, true)
+	if len(rec.pending) != 0 {
+		t.Fatalf("recorder without sink buffered %d accesses", len(rec.pending))
+	}
+}
+
+func TestMemorySinkAggregation(t *testing.T) {
+	sink := NewMemorySink()
+	rec := &RWRecorder{Sink: sink}
+
+	rec.BeginTx(7, 3, testTx)
+	slot1, slot2 := *uint256.NewInt(1), *uint256.NewInt(2)
+	rec.RecordAccount(testAddr, AccessBalance, []byte{9}, true)
+	rec.RecordStorage(testAddr, slot1, []byte{7}, []byte{7}, true)
+	rec.RecordStorage(testAddr, slot1, []byte{7}, []byte{8}, false) // Changed, then restored
+	rec.RecordStorage(testAddr, slot1, []byte{8}, []byte{7}, false)
+	rec.RecordStorage(testAddr, slot2, []byte{0}, []byte{1}, false)
+	rec.RecordAccount(testAddr, AccessBalance, []byte{8}, false)
+	rec.EndTx(&types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: 21000})
+
+	sets := sink.Sets()
+	if len(sets) != 1 {
+		t.Fatalf("collected %d access sets, want 1", len(sets))
+	}
+	var (
+		balance = StateKey{Address: testAddr, Kind: AccessBalance}
+		key1    = StateKey{Address: testAddr, Slot: slot1.Bytes32()}
+		key2    = StateKey{Address: testAddr, Slot: slot2.Bytes32()}
+	)
+	want := &TxAccessSet{
+		BlockNumber:  7,
+		TxIndex:      3,
+		TxHash:       testTx.Hash(),
+		Status:       types.ReceiptStatusSuccessful,
+		GasUsed:      21000,
+		Invoked:      []common.Address{testAddr},
+		Reads:        []StateKey{balance, key1},
+		Writes:       []StateKey{key2, balance},
+		SilentWrites: []StateKey{key1},
+	}
+	if !reflect.DeepEqual(sets[0], want) {
+		t.Errorf("access set mismatch:\nhave %+v\nwant %+v", sets[0], want)
+	}
+}
+
+func TestTraceSinkRoundtrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.rwt")
+	sink, err := NewTraceSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemorySink()
+	for _, sink := range []AccessSink{sink, mem} {
+		rec := &RWRecorder{Sink: sink}
+		for block := uint64(1); block <= 2; block++ {
+			rec.BeginTx(block, 0, testTx)
+			rec.RecordStorage(testAddr, *uint256.NewInt(block), []byte{0}, []byte{1}, false)
+			rec.RecordAccount(testAddr, AccessNonce, []byte{1}, true)
+			rec.EndTx(nil)
+			rec.EndBlock(block, common.Hash{})
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := rwtrace.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	for i, want := range mem.Sets() {
+		block, err := reader.Block(want.BlockNumber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(block.Txs) != 1 || !reflect.DeepEqual(block.Txs[0], want.TraceTx()) {
+			t.Errorf("set %d mismatch:\nhave %+v\nwant %+v", i, block.Txs, want)
+		}
+	}
+}
+
+func TestStateKeyString(t *testing.T) {
+	for kind := AccessStorage; kind <= AccessExistence; kind++ {
+		key := StateKey{Address: testAddr, Kind: kind}
+		if kind == AccessStorage {
+			key.Slot = common.BigToHash(common.Big257)
+		}
+		if have, want := key.String(), key.TraceKey().String(); have != want {
+			t.Errorf("kind %v: key rendered as %q, rwtrace renders %q", kind, have, want)
+		}
+	}
+}
+
+func TestCSVRecord(t *testing.T) {
+	set := &TxAccessSet{
+		BlockNumber: 15000000,
+		TxHash:      common.HexToHash("0xaa"),
+		Invoked:     []common.Address{testAddr},
+		Reads:       []StateKey{{Address: testAddr, Slot: common.BigToHash(common.Big3)}},
+		Writes:      []StateKey{{Address: testAddr, Kind: AccessBalance}},
+	}
+	record := CSVRecord(set)
+	if len(record) != len(CSVHeader) {
+		t.Fatalf("record has %d columns, header %d", len(record), len(CSVHeader))
+	}
+	if want := testAddr.Hex() + "0x3~"; record[3] != want {
+		t.Errorf("read column = %q, want %q", record[3], want)
+	}
+	if want := testAddr.Hex() + ":balance~"; record[4] != want {
+		t.Errorf("write column = %q, want %q", record[4], want)
+	}
+	if record[5] != "" {
+		t.Errorf("silent write column = %q, want empty", record[5])
+	}
+}
+
+func TestCSVSinkResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.csv")
+	sink, err := NewCSVSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &RWRecorder{Sink: sink}
+	rec.BeginTx(1, 0, testTx)
+	rec.EndTx(nil)
+	offset, err := sink.Offset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.BeginTx(2, 0, testTx) // Partial output past the checkpoint
+	rec.EndTx(nil)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sink, err = OpenCSVSink(path, offset); err != nil {
+		t.Fatal(err)
+	}
+	rec.Sink = sink
+	rec.BeginTx(3, 0, testTx)
+	rec.EndTx(nil)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(blob)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][0] != "1" || rows[2][0] != "3" {
+		t.Fatalf("unexpected rows after resume: %v", rows)
+	}
+	if _, err := OpenCSVSink(path, int64(len(blob))+1); err == nil {
+		t.Fatal("reopened past the end of the file")
+	}
+}
+
+func TestDBSinkStoresBlocks(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	sink := NewDBSink()
+	rec := &RWRecorder{Sink: sink}
+	hash1, hash2, hash3 := common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")
+
+	// A block failing halfway must not leak into the next one
+	rec.BeginTx(1, 0, testTx)
+	rec.RecordStorage(testAddr, *uint256.NewInt(9), []byte{0}, []byte{1}, false)
+	rec.EndTx(nil)
+
+	rec.BeginTx(1, 0, testTx)
+	rec.RecordAccount(testAddr, AccessBalance, []byte{1}, true)
+	rec.EndTx(&types.Receipt{Status: types.ReceiptStatusSuccessful})
+	rec.EndBlock(1, hash1)
+	if rawdb.HasAccessSets(db, hash1, 1) {
+		t.Fatal("access sets stored before the block was written")
+	}
+	sink.WriteBlock(db, hash1, 1)
+	rec.EndBlock(2, hash2)
+	sink.WriteBlock(db, hash2, 2)
+
+	// A block failing validation is never written, nor are its sets
+	rec.BeginTx(3, 0, testTx)
+	rec.RecordAccount(testAddr, AccessNonce, []byte{1}, true)
+	rec.EndTx(&types.Receipt{Status: types.ReceiptStatusSuccessful})
+	rec.EndBlock(3, hash3)
+	sink.WriteBlock(db, hash1, 1)
+	if rawdb.HasAccessSets(db, hash3, 3) {
+		t.Errorf("stored access sets of a rejected block")
+	}
+
+	sets := ReadBlockAccessSets(db, hash1, 1)
+	if len(sets) != 1 {
+		t.Fatalf("stored %d access sets, want 1", len(sets))
+	}
+	if want := []StateKey{{Address: testAddr, Kind: AccessBalance}}; !reflect.DeepEqual(sets[0].Reads, want) || len(sets[0].Writes) != 0 {
+		t.Errorf("stored access set mismatch: %+v", sets[0])
+	}
+	if !rawdb.HasAccessSets(db, hash2, 2) || len(ReadBlockAccessSets(db, hash2, 2)) != 0 {
+		t.Errorf("empty block not stored as empty list")
+	}
+	if rawdb.HasAccessSets(db, hash1, 2) || ReadBlockAccessSets(db, hash1, 2) != nil {
+		t.Errorf("found access sets of unrecorded block")
+	}
+}
+
+func TestDecodeTransfers(t *testing.T) {
+	var (
+		token = common.HexToAddress("0x70")
+		from  = common.HexToAddress("0xf0")
+		to    = common.HexToAddress("0x10")
+		word  = func(n int64) []byte { return common.BigToHash(big.NewInt(n)).Bytes() }
+		topic = func(addr common.Address) common.Hash { return common.BytesToHash(addr.Bytes()) }
+	)
+	batch := append(append(word(64), word(160)...), word(2)...) // Offsets of ids and values, 2 ids
+	batch = append(append(append(batch, word(7)...), word(8)...), word(2)...)
+	batch = append(append(batch, word(100)...), word(200)...)
+
+	logs := []*types.Log{
+		{Address: token, Index: 0, Topics: []common.Hash{erc20ABI.Events["Transfer"].ID, topic(from), topic(to)}, Data: word(5)},
+		{Address: token, Index: 1, Topics: []common.Hash{erc721ABI.Events["Transfer"].ID, topic(from), topic(to), common.BigToHash(big.NewInt(9))}},
+		{Address: token, Index: 2, Topics: []common.Hash{erc1155ABI.Events["TransferBatch"].ID, topic(from), topic(from), topic(to)}, Data: batch},
+		{Address: token, Index: 3, Topics: []common.Hash{erc20ABI.Events["Transfer"].ID, topic(from), topic(to)}}, // Missing value
+		{Address: token, Index: 4, Topics: []common.Hash{common.HexToHash("0x01")}},
+	}
+	want := []TokenTransfer{
+		{Standard: ERC20, Token: token, From: from, To: to, Value: big.NewInt(5), LogIndex: 0},
+		{Standard: ERC721, Token: token, From: from, To: to, TokenID: big.NewInt(9), Value: big.NewInt(1), LogIndex: 1},
+		{Standard: ERC1155, Token: token, From: from, To: to, TokenID: big.NewInt(7), Value: big.NewInt(100), LogIndex: 2},
+		{Standard: ERC1155, Token: token, From: from, To: to, TokenID: big.NewInt(8), Value: big.NewInt(200), LogIndex: 2},
+	}
+	if have := DecodeTransfers(logs); !reflect.DeepEqual(have, want) {
+		t.Fatalf("transfers mismatch:\nhave %+v\nwant %+v", have, want)
+	}
+}
+
+func TestTokenSink(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "capture")
+	sink, err := NewTokenSink(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		token    = common.HexToAddress("0x70")
+		transfer = &types.Log{Address: token, Topics: []common.Hash{
+			erc721ABI.Events["Transfer"].ID, common.HexToHash("0xf0"), common.HexToHash("0x10"), common.HexToHash("0x09"),
+		}}
+	)
+	sink.BeginTx(1, 0, common.HexToHash("0xaa"))
+	sink.EndTx(&types.Receipt{Logs: []*types.Log{transfer}})
+	sink.BeginTx(1, 1, common.HexToHash("0xbb"))
+	sink.EndTx(&types.Receipt{})
+	sink.EndBlock(1, common.Hash{})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) [][]string {
+		blob, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(bytes.NewReader(blob)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	paths := TokenSinkPaths(prefix)
+	if rows := read(paths[0]); len(rows) != 3 || rows[1][2] != "true" || rows[2][2] != "false" {
+		t.Fatalf("unexpected classification: %v", rows)
+	}
+	if rows := read(paths[1]); len(rows) != 2 || rows[1][3] != ERC721 || rows[1][7] != "9" {
+		t.Fatalf("unexpected transfers: %v", rows)
+	}
+	hash := common.HexToHash("0xaa").Hex()
+	want := []string{"1", hash, hash + "_0x00000000000000000000000000000000000000f0_0x0000000000000000000000000000000000000070",
+		hash + "_0x0000000000000000000000000000000000000010_0x0000000000000000000000000000000000000070"}
+	if rows := read(paths[2]); len(rows) != 2 || !reflect.DeepEqual(rows[1], want) {
+		t.Fatalf("unexpected vessel rows: %v", rows)
+	}
+}
+
+func TestReportExecTimeCountsDrops(t *testing.T) {
+	rec := &RWRecorder{TxExecTime: make(chan ExecTime, 2)}
+	for i := 0; i < 5; i++ {
+		rec.ReportExecTime(ExecTime{GasUsed: uint64(i)})
+	}
+	if len(rec.TxExecTime) != 2 {
+		t.Fatalf("queued %d costs, want 2", len(rec.TxExecTime))
+	}
+	if dropped := rec.DroppedExecTimes(); dropped != 3 {
+		t.Errorf("dropped %d costs, want 3", dropped)
+	}
+}
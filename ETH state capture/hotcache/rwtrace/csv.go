@@ -0,0 +1,228 @@
+package rwtrace
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// CSVHeader is the header row of the access set CSV files.
+var CSVHeader = []string{"BlockNumber", "TxHash", "InvokeAddress", "ReadStateSlot", "WriteStateSlot", "SilentWriteStateSlot", "RevertedStateSlot"}
+
+// ExecTimeColumn is the name of the execution time column added to the access
+// set CSV files when they are merged with the captured execution times.
+const ExecTimeColumn = "ExecTime(ns)"
+
+// CSVRecord renders a transaction as a CSV row matching CSVHeader, with every
+// list rendered as "~"-terminated entries.
+func CSVRecord(number uint64, tx *Tx) []string {
+	var invoked bytes.Buffer
+	for _, addr := range tx.Invoked {
+		invoked.WriteString(addr.String() + "~")
+	}
+	return []string{
+		strconv.FormatUint(number, 10),
+		tx.Hash.String(),
+		invoked.String(),
+		joinKeys(tx.Reads),
+		joinKeys(tx.Writes),
+		joinKeys(tx.SilentWrites),
+		joinKeys(tx.Reverted),
+	}
+}
+
+func joinKeys(keys []Key) string {
+	var buf bytes.Buffer
+	for _, key := range keys {
+		buf.WriteString(key.String() + "~")
+	}
+	return buf.String()
+}
+
+// splitList splits a "~"-separated list, with or without the trailing "~".
+func splitList(s string) []string {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "~")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "~")
+}
+
+func parseKeys(s string) ([]Key, error) {
+	var keys []Key
+	for _, item := range splitList(s) {
+		key, err := ParseKey(item)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ReadCSV parses access set rows from r, calling fn for every transaction.
+// Columns are located by their header names, only BlockNumber and TxHash are
+// required. Transactions are numbered by their position among the rows of
+// their block. The optional ExecTimeColumn may hold fractional or empty values.
+func ReadCSV(r io.Reader, fn func(number uint64, tx *Tx) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range CSVHeader[:2] {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("missing %s column", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	var (
+		last  uint64
+		index uint64
+	)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		number, err := strconv.ParseUint(strings.TrimSpace(field(record, "BlockNumber")), 10, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid block number: %v", line, err)
+		}
+		if number != last {
+			last, index = number, 0
+		}
+		tx := &Tx{Hash: common.HexToHash(strings.TrimSpace(field(record, "TxHash"))), Index: index}
+		index++
+
+		for _, item := range splitList(field(record, "InvokeAddress")) {
+			if !common.IsHexAddress(item) {
+				return fmt.Errorf("line %d: invalid address %q", line, item)
+			}
+			tx.Invoked = append(tx.Invoked, common.HexToAddress(item))
+		}
+		for i, list := range []*[]Key{&tx.Reads, &tx.Writes, &tx.SilentWrites, &tx.Reverted} {
+			if *list, err = parseKeys(field(record, CSVHeader[3+i])); err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+		if s := strings.TrimSpace(field(record, ExecTimeColumn)); s != "" {
+			execTime, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return fmt.Errorf("line %d: invalid execution time: %v", line, err)
+			}
+			if !math.IsNaN(execTime) && execTime > 0 {
+				tx.ExecTime = uint64(execTime)
+			}
+		}
+		if err := fn(number, tx); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadExecTimes loads an execution time CSV written by the capture, keyed by
+// transaction hash. Only the first two columns, the hash and the execution
+// time in nanoseconds, are used.
+func ReadExecTimes(r io.Reader) (map[common.Hash]uint64, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	if _, err := reader.Read(); err != nil {
+		return nil, err
+	}
+	execTimes := make(map[common.Hash]uint64)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return execTimes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("short record %v", record)
+		}
+		execTime, err := strconv.ParseUint(strings.TrimSpace(record[1]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		execTimes[common.HexToHash(strings.TrimSpace(record[0]))] = execTime
+	}
+}
+
+// FromCSV converts the access set rows read from r into trace blocks written
+// to w. Rows must be ordered by block number. Execution times found in
+// execTimes, keyed by transaction hash, take precedence over the CSV ones.
+func FromCSV(r io.Reader, w *Writer, execTimes map[common.Hash]uint64) error {
+	var block *Block
+	err := ReadCSV(r, func(number uint64, tx *Tx) error {
+		if block != nil && block.Number != number {
+			if err := w.WriteBlock(block); err != nil {
+				return err
+			}
+			block = nil
+		}
+		if block == nil {
+			block = &Block{Number: number}
+		}
+		if execTime, ok := execTimes[tx.Hash]; ok {
+			tx.ExecTime = execTime
+		}
+		block.Txs = append(block.Txs, tx)
+		return nil
+	})
+	if err == nil && block != nil {
+		err = w.WriteBlock(block)
+	}
+	return err
+}
+
+// ToCSV streams the trace read from r and writes every transaction as a CSV
+// row to w, adding the ExecTimeColumn if execTime is set.
+func ToCSV(r io.Reader, w io.Writer, execTime bool) error {
+	writer := csv.NewWriter(w)
+	header := CSVHeader
+	if execTime {
+		header = append(header[:len(header):len(header)], ExecTimeColumn)
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	err := Stream(r, func(block *Block) error {
+		for _, tx := range block.Txs {
+			record := CSVRecord(block.Number, tx)
+			if execTime {
+				record = append(record, strconv.FormatUint(tx.ExecTime, 10))
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,267 @@
+package rwtrace
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var magic = []byte("RWTRACE\x01")
+
+const (
+	indexMarker = 0x00  // Single byte separating the block records from the index
+	trailerSize = 8 + 8 // Index offset followed by the magic
+	headerSize  = int64(len("RWTRACE\x01"))
+)
+
+// keyRef is the dictionary encoded form of a Key. Slot is only meaningful
+// for storage keys.
+type keyRef struct {
+	Addr uint64
+	Kind Kind
+	Slot uint64
+}
+
+type txRecord struct {
+	Hash     common.Hash
+	Index    uint64
+	Status   uint64
+	GasUsed  uint64
+	ExecTime uint64
+
+	Invoked      []uint64
+	Reads        []keyRef
+	Writes       []keyRef
+	SilentWrites []keyRef
+	Reverted     []keyRef
+}
+
+type blockRecord struct {
+	Number    uint64
+	Addresses []common.Address // Dictionary entries first used in this block
+	Slots     []common.Hash
+	Txs       []txRecord
+}
+
+type indexEntry struct {
+	Number uint64
+	Offset uint64
+}
+
+type index struct {
+	Blocks    []indexEntry
+	Addresses []common.Address
+	Slots     []common.Hash
+}
+
+// dictionary maps addresses and slots to their positions in the trace.
+type dictionary struct {
+	addrs   []common.Address
+	slots   []common.Hash
+	addrIDs map[common.Address]uint64
+	slotIDs map[common.Hash]uint64
+}
+
+func newDictionary() *dictionary {
+	return &dictionary{
+		addrIDs: make(map[common.Address]uint64),
+		slotIDs: make(map[common.Hash]uint64),
+	}
+}
+
+func (d *dictionary) extend(addrs []common.Address, slots []common.Hash) {
+	for _, addr := range addrs {
+		d.addrIDs[addr] = uint64(len(d.addrs))
+		d.addrs = append(d.addrs, addr)
+	}
+	for _, slot := range slots {
+		d.slotIDs[slot] = uint64(len(d.slots))
+		d.slots = append(d.slots, slot)
+	}
+}
+
+func (d *dictionary) addrID(addr common.Address) uint64 {
+	if id, ok := d.addrIDs[addr]; ok {
+		return id
+	}
+	d.extend([]common.Address{addr}, nil)
+	return uint64(len(d.addrs) - 1)
+}
+
+func (d *dictionary) ref(key Key) keyRef {
+	ref := keyRef{Addr: d.addrID(key.Address), Kind: key.Kind}
+	if key.Kind == KindStorage {
+		id, ok := d.slotIDs[key.Slot]
+		if !ok {
+			d.extend(nil, []common.Hash{key.Slot})
+			id = uint64(len(d.slots) - 1)
+		}
+		ref.Slot = id
+	}
+	return ref
+}
+
+func (d *dictionary) refs(keys []Key) []keyRef {
+	refs := make([]keyRef, len(keys))
+	for i, key := range keys {
+		refs[i] = d.ref(key)
+	}
+	return refs
+}
+
+func (d *dictionary) address(id uint64) (common.Address, error) {
+	if id >= uint64(len(d.addrs)) {
+		return common.Address{}, fmt.Errorf("address #%d not in dictionary", id)
+	}
+	return d.addrs[id], nil
+}
+
+func (d *dictionary) keys(refs []keyRef) ([]Key, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	keys := make([]Key, len(refs))
+	for i, ref := range refs {
+		addr, err := d.address(ref.Addr)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = Key{Address: addr, Kind: ref.Kind}
+		if ref.Kind == KindStorage {
+			if ref.Slot >= uint64(len(d.slots)) {
+				return nil, fmt.Errorf("slot #%d not in dictionary", ref.Slot)
+			}
+			keys[i].Slot = d.slots[ref.Slot]
+		}
+	}
+	return keys, nil
+}
+
+// encode converts a block into its record, adding the new dictionary entries
+// to it.
+func (d *dictionary) encode(block *Block) *blockRecord {
+	var (
+		rec   = &blockRecord{Number: block.Number, Txs: make([]txRecord, len(block.Txs))}
+		addrs = len(d.addrs)
+		slots = len(d.slots)
+	)
+	for i, tx := range block.Txs {
+		invoked := make([]uint64, len(tx.Invoked))
+		for j, addr := range tx.Invoked {
+			invoked[j] = d.addrID(addr)
+		}
+		rec.Txs[i] = txRecord{
+			Hash:         tx.Hash,
+			Index:        tx.Index,
+			Status:       tx.Status,
+			GasUsed:      tx.GasUsed,
+			ExecTime:     tx.ExecTime,
+			Invoked:      invoked,
+			Reads:        d.refs(tx.Reads),
+			Writes:       d.refs(tx.Writes),
+			SilentWrites: d.refs(tx.SilentWrites),
+			Reverted:     d.refs(tx.Reverted),
+		}
+	}
+	rec.Addresses = d.addrs[addrs:]
+	rec.Slots = d.slots[slots:]
+	return rec
+}
+
+// decode resolves a block record against the dictionary, which must already
+// contain the entries of the record.
+func (d *dictionary) decode(rec *blockRecord) (*Block, error) {
+	block := &Block{Number: rec.Number, Txs: make([]*Tx, len(rec.Txs))}
+	for i, r := range rec.Txs {
+		tx := &Tx{
+			Hash:     r.Hash,
+			Index:    r.Index,
+			Status:   r.Status,
+			GasUsed:  r.GasUsed,
+			ExecTime: r.ExecTime,
+		}
+		for _, id := range r.Invoked {
+			addr, err := d.address(id)
+			if err != nil {
+				return nil, err
+			}
+			tx.Invoked = append(tx.Invoked, addr)
+		}
+		var err error
+		if tx.Reads, err = d.keys(r.Reads); err != nil {
+			return nil, err
+		}
+		if tx.Writes, err = d.keys(r.Writes); err != nil {
+			return nil, err
+		}
+		if tx.SilentWrites, err = d.keys(r.SilentWrites); err != nil {
+			return nil, err
+		}
+		if tx.Reverted, err = d.keys(r.Reverted); err != nil {
+			return nil, err
+		}
+		block.Txs[i] = tx
+	}
+	return block, nil
+}
+
+// scan reads the block records following the magic in r, calling fn with the
+// offset and content of each. It returns the offset of the first byte after
+// the last complete record, stopping at the index marker or at the end of the
+// input. A truncated record is reported as io.ErrUnexpectedEOF.
+func scan(r io.Reader, fn func(offset int64, rec *blockRecord) error) (int64, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, head); err != nil || !bytes.Equal(head, magic) {
+		return 0, errBadMagic
+	}
+	var (
+		offset = headerSize
+		stream = rlp.NewStream(br, 0)
+	)
+	for {
+		kind, _, err := stream.Kind()
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		if kind != rlp.List {
+			return offset, nil // Index marker
+		}
+		raw, err := stream.Raw()
+		if err != nil {
+			return offset, err
+		}
+		rec := new(blockRecord)
+		if err := rlp.DecodeBytes(raw, rec); err != nil {
+			return offset, fmt.Errorf("block record at offset %d: %v", offset, err)
+		}
+		if err := fn(offset, rec); err != nil {
+			return offset, err
+		}
+		offset += int64(len(raw))
+	}
+}
+
+// Stream decodes the blocks of the trace read from r in file order, calling fn
+// for each of them until the blocks are exhausted or fn returns an error. It
+// needs no index, so it also reads traces that were not closed properly, a
+// partially written last block is reported as io.ErrUnexpectedEOF.
+func Stream(r io.Reader, fn func(*Block) error) error {
+	dict := newDictionary()
+	_, err := scan(r, func(offset int64, rec *blockRecord) error {
+		dict.extend(rec.Addresses, rec.Slots)
+		block, err := dict.decode(rec)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", rec.Number, err)
+		}
+		return fn(block)
+	})
+	return err
+}
@@ -0,0 +1,102 @@
+package rwtrace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Reader provides random access to the blocks of a trace file.
+type Reader struct {
+	file  *os.File
+	size  int64
+	dict  *dictionary
+	index []indexEntry
+}
+
+// Open opens the trace file at path, loading its index and dictionaries. A
+// file without an index is scanned to build them.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r := &Reader{file: file, size: info.Size(), dict: newDictionary()}
+	if err := r.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, nil
+}
+
+func (r *Reader) load() error {
+	if r.size >= headerSize+1+trailerSize {
+		trailer := make([]byte, trailerSize)
+		if _, err := r.file.ReadAt(trailer, r.size-trailerSize); err != nil {
+			return err
+		}
+		if bytes.Equal(trailer[8:], magic) {
+			offset := int64(binary.BigEndian.Uint64(trailer[:8]))
+			if offset < headerSize || offset >= r.size-trailerSize {
+				return fmt.Errorf("invalid index offset %d", offset)
+			}
+			var idx index
+			stream := rlp.NewStream(io.NewSectionReader(r.file, offset+1, r.size-trailerSize-offset-1), 0)
+			if err := stream.Decode(&idx); err != nil {
+				return fmt.Errorf("invalid index: %v", err)
+			}
+			r.dict.extend(idx.Addresses, idx.Slots)
+			r.index = idx.Blocks
+			return nil
+		}
+	}
+	// No index, the trace was not closed properly
+	_, err := scan(io.NewSectionReader(r.file, 0, r.size), func(offset int64, rec *blockRecord) error {
+		r.dict.extend(rec.Addresses, rec.Slots)
+		r.index = append(r.index, indexEntry{Number: rec.Number, Offset: uint64(offset)})
+		return nil
+	})
+	if err == io.ErrUnexpectedEOF {
+		err = nil // Ignore the partially written last block
+	}
+	return err
+}
+
+// Numbers returns the numbers of the blocks in the trace in ascending order.
+func (r *Reader) Numbers() []uint64 {
+	numbers := make([]uint64, len(r.index))
+	for i, entry := range r.index {
+		numbers[i] = entry.Number
+	}
+	return numbers
+}
+
+// Block decodes the block with the given number, returning ErrUnknownBlock if
+// the trace has no transactions of it.
+func (r *Reader) Block(number uint64) (*Block, error) {
+	i := sort.Search(len(r.index), func(i int) bool { return r.index[i].Number >= number })
+	if i == len(r.index) || r.index[i].Number != number {
+		return nil, ErrUnknownBlock
+	}
+	offset := int64(r.index[i].Offset)
+	var rec blockRecord
+	if err := rlp.NewStream(io.NewSectionReader(r.file, offset, r.size-offset), 0).Decode(&rec); err != nil {
+		return nil, fmt.Errorf("block %d: %v", number, err)
+	}
+	return r.dict.decode(&rec)
+}
+
+// Close closes the underlying file.
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,142 @@
+// Package rwtrace implements a compact, block-indexed binary format for the
+// captured read/write sets of transactions.
+//
+// A trace file starts with an 8 byte magic, followed by one RLP encoded record
+// per block holding transactions. Addresses and storage slots are dictionary
+// encoded: every block record carries the dictionary entries first used in
+// that block, and state keys refer to entries by their position. A finished
+// file ends with a 0x00 marker byte, an RLP encoded index holding the offset
+// of every block record along with the complete dictionaries, and a 16 byte
+// trailer made of the index offset and the magic.
+//
+// Files without an index, like the output of a capture that was killed, can
+// still be streamed, and are indexed on the fly when opened.
+package rwtrace
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Kind identifies which part of an account a state key refers to. The values
+// match the access kinds of the hotcache recorder.
+type Kind uint8
+
+const (
+	KindStorage   Kind = iota // Contract storage slot
+	KindBalance               // Account balance
+	KindNonce                 // Account nonce
+	KindCode                  // Account code
+	KindExistence             // Account existence
+)
+
+var kindNames = []string{"storage", "balance", "nonce", "code", "existence"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "kind" + strconv.Itoa(int(k))
+}
+
+// Key identifies a single state item: a storage slot, or one field of an
+// account for the account-level kinds.
+type Key struct {
+	Address common.Address
+	Kind    Kind
+	Slot    common.Hash // Storage slot, zero for account-level kinds
+}
+
+// String returns the identifier used for the key in the CSV files: the
+// address followed by the minimal hex form of the slot, or by ":" and the
+// kind name for account-level keys.
+func (k Key) String() string {
+	if k.Kind == KindStorage {
+		return k.Address.Hex() + hexutil.EncodeBig(new(big.Int).SetBytes(k.Slot[:]))
+	}
+	return k.Address.Hex() + ":" + k.Kind.String()
+}
+
+// KeyStrings returns the identifiers of the keys, an empty list for no keys.
+func KeyStrings(keys []Key) []string {
+	strs := make([]string, len(keys))
+	for i, key := range keys {
+		strs[i] = key.String()
+	}
+	return strs
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k Key) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (k *Key) UnmarshalText(input []byte) error {
+	key, err := ParseKey(string(input))
+	if err != nil {
+		return err
+	}
+	*k = key
+	return nil
+}
+
+// ParseKey parses a key in the form produced by Key.String.
+func ParseKey(s string) (Key, error) {
+	if len(s) < 2*common.AddressLength+2 || !common.IsHexAddress(s[:2*common.AddressLength+2]) {
+		return Key{}, fmt.Errorf("invalid state key %q: bad address", s)
+	}
+	key := Key{Address: common.HexToAddress(s[:2*common.AddressLength+2])}
+	rest := s[2*common.AddressLength+2:]
+	if strings.HasPrefix(rest, ":") {
+		for i, name := range kindNames {
+			if i != int(KindStorage) && rest[1:] == name {
+				key.Kind = Kind(i)
+				return key, nil
+			}
+		}
+		return Key{}, fmt.Errorf("invalid state key %q: unknown kind", s)
+	}
+	slot, err := hexutil.DecodeBig(rest)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid state key %q: %v", s, err)
+	}
+	key.Slot = common.BigToHash(slot)
+	return key, nil
+}
+
+// Tx is the read/write set of a single transaction.
+type Tx struct {
+	Hash     common.Hash
+	Index    uint64 // Position in the block
+	Status   uint64 // Receipt status
+	GasUsed  uint64
+	ExecTime uint64 // Execution time in nanoseconds, zero if unknown
+
+	Invoked      []common.Address // Contracts whose storage was accessed
+	Reads        []Key
+	Writes       []Key // Writes changing the item's value
+	SilentWrites []Key // Writes leaving the item at its pre-transaction value
+	Reverted     []Key // Items accessed by reverted call frames
+}
+
+// Block holds the transactions of a block in execution order. Blocks without
+// transactions are not stored in trace files.
+type Block struct {
+	Number uint64
+	Txs    []*Tx
+}
+
+var (
+	// ErrUnknownBlock is returned by Reader.Block if the trace holds no
+	// transactions for the requested block.
+	ErrUnknownBlock = errors.New("block not in trace")
+
+	errBadMagic = errors.New("not a read/write set trace")
+)
@@ -0,0 +1,230 @@
+package rwtrace
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	addrA = common.HexToAddress("0x000000000000000000000000000000000000000a")
+	addrB = common.HexToAddress("0x000000000000000000000000000000000000000b")
+)
+
+func testBlocks() []*Block {
+	slot := func(n int64) Key { return Key{Address: addrA, Slot: common.BigToHash(big.NewInt(n << 40))} }
+	return []*Block{
+		{Number: 10, Txs: []*Tx{{
+			Hash:     common.HexToHash("0x01"),
+			Status:   1,
+			GasUsed:  50000,
+			ExecTime: 1200,
+			Invoked:  []common.Address{addrA},
+			Reads:    []Key{slot(1), {Address: addrB, Kind: KindBalance}},
+			Writes:   []Key{slot(2)},
+		}}},
+		{Number: 12, Txs: []*Tx{
+			{Hash: common.HexToHash("0x02"), Reads: []Key{{Address: addrB, Kind: KindNonce}}},
+			{
+				Hash:         common.HexToHash("0x03"),
+				Index:        1,
+				Invoked:      []common.Address{addrA},
+				Reads:        []Key{slot(1), slot(3)},
+				SilentWrites: []Key{slot(1)},
+				Reverted:     []Key{slot(3), {Address: addrA, Kind: KindExistence}},
+			},
+		}},
+	}
+}
+
+func writeTrace(t *testing.T, path string, blocks []*Block, close bool) int64 {
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if err := w.WriteBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offset, err := w.Offset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if close {
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		w.file.Close()
+	}
+	return offset
+}
+
+func checkBlocks(t *testing.T, path string, want []*Block) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var streamed []*Block
+	if err := Stream(file, func(block *Block) error {
+		streamed = append(streamed, block)
+		return nil
+	}); err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if !reflect.DeepEqual(streamed, want) {
+		t.Errorf("streamed blocks mismatch:\nhave %v\nwant %v", streamed, want)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := len(want) - 1; i >= 0; i-- {
+		block, err := r.Block(want[i].Number)
+		if err != nil {
+			t.Fatalf("block %d: %v", want[i].Number, err)
+		}
+		if !reflect.DeepEqual(block, want[i]) {
+			t.Errorf("block %d mismatch:\nhave %v\nwant %v", want[i].Number, block, want[i])
+		}
+	}
+	if _, err := r.Block(11); err != ErrUnknownBlock {
+		t.Errorf("missing block lookup returned %v, want %v", err, ErrUnknownBlock)
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.rwt")
+	writeTrace(t, path, testBlocks(), true)
+	checkBlocks(t, path, testBlocks())
+}
+
+func TestUnclosedTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.rwt")
+	writeTrace(t, path, testBlocks(), false)
+	checkBlocks(t, path, testBlocks())
+}
+
+func TestAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.rwt")
+	blocks := testBlocks()
+	offset := writeTrace(t, path, blocks[:1], false)
+
+	// Append a block, close and append again after the first one, replacing
+	// both the second block and the index
+	w, err := Append(path, offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteBlock(&Block{Number: 11, Txs: []*Tx{{Hash: common.HexToHash("0xff")}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w, err = Append(path, offset); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteBlock(blocks[0]); err == nil {
+		t.Fatal("block written out of order")
+	}
+	if err := w.WriteBlock(blocks[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkBlocks(t, path, testBlocks())
+
+	if _, err := Append(path, offset+1); err == nil {
+		t.Fatal("appended at an offset inside a block")
+	}
+}
+
+func TestTruncatedStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.rwt")
+	offset := writeTrace(t, path, testBlocks(), false)
+	if err := os.Truncate(path, offset-3); err != nil {
+		t.Fatal(err)
+	}
+	blob, _ := os.ReadFile(path)
+	if err := Stream(bytes.NewReader(blob), func(*Block) error { return nil }); err != io.ErrUnexpectedEOF {
+		t.Fatalf("stream of truncated trace returned %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if numbers := r.Numbers(); !reflect.DeepEqual(numbers, []uint64{10}) {
+		t.Fatalf("indexed blocks %v, want [10]", numbers)
+	}
+}
+
+func TestKeyString(t *testing.T) {
+	tests := []struct {
+		key Key
+		str string
+	}{
+		{Key{Address: addrA}, addrA.Hex() + "0x0"},
+		{Key{Address: addrA, Slot: common.HexToHash("0x1f")}, addrA.Hex() + "0x1f"},
+		{Key{Address: addrB, Kind: KindCode}, addrB.Hex() + ":code"},
+	}
+	for _, tt := range tests {
+		if str := tt.key.String(); str != tt.str {
+			t.Errorf("%v: have %q, want %q", tt.key, str, tt.str)
+		}
+		if key, err := ParseKey(tt.str); err != nil || key != tt.key {
+			t.Errorf("%q: parsed %v, %v", tt.str, key, err)
+		}
+	}
+	for _, bad := range []string{"", "0x1234", addrA.Hex() + ":storage", addrA.Hex() + "0x01", addrA.Hex() + "zz"} {
+		if _, err := ParseKey(bad); err == nil {
+			t.Errorf("%q: parsed without error", bad)
+		}
+	}
+}
+
+func TestCSVConversion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.rwt")
+	writeTrace(t, path, testBlocks(), true)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var out bytes.Buffer
+	if err := ToCSV(file, &out, true); err != nil {
+		t.Fatal(err)
+	}
+	// Rows merged by the data processing scripts have the trailing "~" stripped
+	merged := strings.ReplaceAll(out.String(), "~,", ",")
+
+	path2 := filepath.Join(t.TempDir(), "converted.rwt")
+	w, err := Create(path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := FromCSV(strings.NewReader(merged), w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := testBlocks()
+	want[0].Txs[0].Status, want[0].Txs[0].GasUsed = 0, 0 // Not part of the CSV
+	checkBlocks(t, path2, want)
+}
@@ -0,0 +1,133 @@
+package rwtrace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Writer appends blocks to a trace file. Blocks have to be written in
+// ascending order of their numbers. The index is written on Close.
+type Writer struct {
+	file   *os.File
+	buf    *bufio.Writer
+	offset int64 // Offset following the last block record
+	dict   *dictionary
+	index  []indexEntry
+}
+
+// Create creates (or truncates) the trace file at path.
+func Create(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(magic); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Writer{
+		file:   file,
+		buf:    bufio.NewWriter(file),
+		offset: headerSize,
+		dict:   newDictionary(),
+	}, nil
+}
+
+// Append reopens the trace file at path for writing more blocks, discarding
+// everything after offset, including the index of a closed file. The offset
+// must be one previously reported by Offset.
+func Append(path string, offset int64) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{file: file, dict: newDictionary()}
+	end, err := scan(io.NewSectionReader(file, 0, offset), func(offset int64, rec *blockRecord) error {
+		w.dict.extend(rec.Addresses, rec.Slots)
+		w.index = append(w.index, indexEntry{Number: rec.Number, Offset: uint64(offset)})
+		return nil
+	})
+	if err == nil && end != offset {
+		err = fmt.Errorf("offset %d is not a block boundary of %s", offset, path)
+	}
+	if err == nil {
+		err = file.Truncate(offset)
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.buf, w.offset = bufio.NewWriter(file), offset
+	return w, nil
+}
+
+// WriteBlock appends a block to the trace.
+func (w *Writer) WriteBlock(block *Block) error {
+	if n := len(w.index); n > 0 && block.Number <= w.index[n-1].Number {
+		return fmt.Errorf("block %d written after block %d", block.Number, w.index[n-1].Number)
+	}
+	blob, err := rlp.EncodeToBytes(w.dict.encode(block))
+	if err != nil {
+		return err
+	}
+	if _, err := w.buf.Write(blob); err != nil {
+		return err
+	}
+	w.index = append(w.index, indexEntry{Number: block.Number, Offset: uint64(w.offset)})
+	w.offset += int64(len(blob))
+	return nil
+}
+
+// Flush writes the buffered blocks to the file.
+func (w *Writer) Flush() error {
+	return w.buf.Flush()
+}
+
+// Offset flushes the buffered blocks, syncs the file and returns the offset
+// following the last block, which Append accepts to continue the trace.
+func (w *Writer) Offset() (int64, error) {
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+	return w.offset, nil
+}
+
+// Close writes the index and closes the file.
+func (w *Writer) Close() error {
+	blob, err := rlp.EncodeToBytes(&index{
+		Blocks:    w.index,
+		Addresses: w.dict.addrs,
+		Slots:     w.dict.slots,
+	})
+	if err == nil {
+		err = w.buf.WriteByte(indexMarker)
+	}
+	if err == nil {
+		_, err = w.buf.Write(blob)
+	}
+	if err == nil {
+		var trailer [trailerSize]byte
+		binary.BigEndian.PutUint64(trailer[:8], uint64(w.offset))
+		copy(trailer[8:], magic)
+		_, err = w.buf.Write(trailer[:])
+	}
+	if err == nil {
+		err = w.buf.Flush()
+	}
+	if err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
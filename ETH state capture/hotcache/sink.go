@@ -0,0 +1,270 @@
+package hotcache
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/hotcache/rwtrace"
+	"github.com/holiman/uint256"
+)
+
+// AccessSink receives the state accesses of every processed transaction.
+// BeginTx and EndTx bracket each transaction, Access is called once per
+// recorded access in between, after reverted call frames have been demoted.
+// EndBlock follows the last transaction of every fully processed block.
+type AccessSink interface {
+	BeginTx(blockNumber uint64, txIndex int, txHash common.Hash)
+	Access(rw *RWS)
+	EndTx(receipt *types.Receipt)
+	EndBlock(blockNumber uint64, blockHash common.Hash)
+}
+
+// BlockWriter is implemented by sinks storing the access sets with the block
+// itself. Their EndBlock only stages the sets of a block, which are written by
+// WriteBlock into the batch of the block once it has passed validation.
+type BlockWriter interface {
+	WriteBlock(db ethdb.KeyValueWriter, blockHash common.Hash, blockNumber uint64)
+}
+
+// MultiSink hands the accesses to several sinks in turn.
+type MultiSink []AccessSink
+
+// BeginTx implements AccessSink.
+func (m MultiSink) BeginTx(blockNumber uint64, txIndex int, txHash common.Hash) {
+	for _, sink := range m {
+		sink.BeginTx(blockNumber, txIndex, txHash)
+	}
+}
+
+// Access implements AccessSink.
+func (m MultiSink) Access(rw *RWS) {
+	for _, sink := range m {
+		sink.Access(rw)
+	}
+}
+
+// EndTx implements AccessSink.
+func (m MultiSink) EndTx(receipt *types.Receipt) {
+	for _, sink := range m {
+		sink.EndTx(receipt)
+	}
+}
+
+// EndBlock implements AccessSink.
+func (m MultiSink) EndBlock(blockNumber uint64, blockHash common.Hash) {
+	for _, sink := range m {
+		sink.EndBlock(blockNumber, blockHash)
+	}
+}
+
+// WriteBlock implements BlockWriter for the sinks implementing it.
+func (m MultiSink) WriteBlock(db ethdb.KeyValueWriter, blockHash common.Hash, blockNumber uint64) {
+	for _, sink := range m {
+		if w, ok := sink.(BlockWriter); ok {
+			w.WriteBlock(db, blockHash, blockNumber)
+		}
+	}
+}
+
+// StateKey identifies a single state item: a storage slot, or one field of
+// an account for the account-level access kinds.
+type StateKey struct {
+	Address common.Address
+	Kind    AccessKind
+	Slot    common.Hash // Storage slot, zero for account-level kinds
+}
+
+// String returns the item identifier used in the captured CSV files.
+func (k StateKey) String() string {
+	if k.Kind == AccessStorage {
+		return k.Address.Hex() + new(uint256.Int).SetBytes32(k.Slot[:]).Hex()
+	}
+	return k.Address.Hex() + ":" + k.Kind.String()
+}
+
+// KeyStrings returns the identifiers of the keys, an empty list for no keys.
+func KeyStrings(keys []StateKey) []string {
+	strs := make([]string, len(keys))
+	for i, key := range keys {
+		strs[i] = key.String()
+	}
+	return strs
+}
+
+// TxAccessSet is the aggregated state footprint of a single transaction.
+// Every list holds unique entries in first-access order.
+type TxAccessSet struct {
+	BlockNumber  uint64
+	TxIndex      uint64
+	TxHash       common.Hash
+	Status       uint64
+	GasUsed      uint64
+	Invoked      []common.Address // Contracts whose storage was accessed
+	Reads        []StateKey
+	Writes       []StateKey // Writes changing the item's value
+	SilentWrites []StateKey // Writes leaving the item at its pre-transaction value
+	Reverted     []StateKey // Items accessed by reverted call frames
+}
+
+// TraceKey converts the key into its rwtrace form.
+func (k StateKey) TraceKey() rwtrace.Key {
+	return rwtrace.Key{Address: k.Address, Kind: rwtrace.Kind(k.Kind), Slot: k.Slot}
+}
+
+func traceKeys(keys []StateKey) []rwtrace.Key {
+	if len(keys) == 0 {
+		return nil
+	}
+	converted := make([]rwtrace.Key, len(keys))
+	for i, key := range keys {
+		converted[i] = key.TraceKey()
+	}
+	return converted
+}
+
+// TraceTx converts the access set into an rwtrace transaction.
+func (set *TxAccessSet) TraceTx() *rwtrace.Tx {
+	return &rwtrace.Tx{
+		Hash:         set.TxHash,
+		Index:        set.TxIndex,
+		Status:       set.Status,
+		GasUsed:      set.GasUsed,
+		Invoked:      set.Invoked,
+		Reads:        traceKeys(set.Reads),
+		Writes:       traceKeys(set.Writes),
+		SilentWrites: traceKeys(set.SilentWrites),
+		Reverted:     traceKeys(set.Reverted),
+	}
+}
+
+// aggregator folds the access stream of one transaction into a TxAccessSet.
+// A store is silent if the slot ends the transaction holding its
+// pre-transaction value, which also covers every single store writing back
+// the current value. Silent stores still observe the slot and count as reads.
+type aggregator struct {
+	set *TxAccessSet
+
+	invoked  map[common.Address]struct{}
+	reads    map[StateKey]struct{}
+	writes   map[StateKey]struct{}
+	reverted map[StateKey]struct{}
+	origin   map[StateKey][]byte
+	final    map[StateKey][]byte
+
+	writeOrder []StateKey
+}
+
+func (a *aggregator) begin(blockNumber uint64, txIndex int, txHash common.Hash) {
+	a.set = &TxAccessSet{
+		BlockNumber: blockNumber,
+		TxIndex:     uint64(txIndex),
+		TxHash:      txHash,
+	}
+	a.invoked = make(map[common.Address]struct{})
+	a.reads = make(map[StateKey]struct{})
+	a.writes = make(map[StateKey]struct{})
+	a.reverted = make(map[StateKey]struct{})
+	a.origin = make(map[StateKey][]byte)
+	a.final = make(map[StateKey][]byte)
+	a.writeOrder = nil
+}
+
+func appendUnique(list []StateKey, seen map[StateKey]struct{}, key StateKey) []StateKey {
+	if _, ok := seen[key]; ok {
+		return list
+	}
+	seen[key] = struct{}{}
+	return append(list, key)
+}
+
+func (a *aggregator) add(rw *RWS) {
+	if a.set == nil {
+		return // Access outside of a transaction
+	}
+	key := rw.StateKey()
+	if rw.Kind == AccessStorage {
+		if _, ok := a.invoked[key.Address]; !ok {
+			a.invoked[key.Address] = struct{}{}
+			a.set.Invoked = append(a.set.Invoked, key.Address)
+		}
+		if _, ok := a.origin[key]; !ok {
+			a.origin[key] = rw.Prev_value
+		}
+		if !rw.IsRead {
+			a.final[key] = rw.Slot_value
+		}
+	}
+	if rw.Reverted {
+		a.set.Reverted = appendUnique(a.set.Reverted, a.reverted, key)
+	}
+	if rw.IsRead {
+		a.set.Reads = appendUnique(a.set.Reads, a.reads, key)
+	} else {
+		a.writeOrder = appendUnique(a.writeOrder, a.writes, key)
+	}
+}
+
+func (a *aggregator) finish(receipt *types.Receipt) *TxAccessSet {
+	set := a.set
+	if set == nil {
+		return nil
+	}
+	a.set = nil
+
+	for _, key := range a.writeOrder {
+		if final, ok := a.final[key]; ok && bytes.Equal(a.origin[key], final) {
+			set.SilentWrites = append(set.SilentWrites, key)
+			set.Reads = appendUnique(set.Reads, a.reads, key)
+		} else {
+			set.Writes = append(set.Writes, key)
+		}
+	}
+	if receipt != nil {
+		set.Status = receipt.Status
+		set.GasUsed = receipt.GasUsed
+	}
+	return set
+}
+
+// MemorySink keeps the aggregated access set of every transaction in memory.
+type MemorySink struct {
+	agg  aggregator
+	sets []*TxAccessSet
+}
+
+// NewMemorySink creates an empty in-memory access sink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// BeginTx implements AccessSink.
+func (s *MemorySink) BeginTx(blockNumber uint64, txIndex int, txHash common.Hash) {
+	s.agg.begin(blockNumber, txIndex, txHash)
+}
+
+// Access implements AccessSink.
+func (s *MemorySink) Access(rw *RWS) {
+	s.agg.add(rw)
+}
+
+// EndTx implements AccessSink.
+func (s *MemorySink) EndTx(receipt *types.Receipt) {
+	if set := s.agg.finish(receipt); set != nil {
+		s.sets = append(s.sets, set)
+	}
+}
+
+// EndBlock implements AccessSink.
+func (s *MemorySink) EndBlock(blockNumber uint64, blockHash common.Hash) {}
+
+// Sets returns the access sets collected since the last Reset.
+func (s *MemorySink) Sets() []*TxAccessSet {
+	return s.sets
+}
+
+// Reset drops all collected access sets.
+func (s *MemorySink) Reset() {
+	s.sets = nil
+}
@@ -0,0 +1,128 @@
+package hotcache
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/hotcache/rwtrace"
+)
+
+// CSVHeader is the header row of the access set CSV files.
+var CSVHeader = rwtrace.CSVHeader
+
+// CSVSink writes one CSV row per transaction, with every state item list
+// rendered as "~"-terminated entries. Rows are flushed to disk at the end of
+// every block, so the file only ever ends in the middle of a block if the
+// process is killed.
+type CSVSink struct {
+	agg    aggregator
+	file   *os.File
+	writer *csv.Writer
+}
+
+// NewCSVSink creates (or truncates) the CSV file at path and writes the header.
+func NewCSVSink(path string) (*CSVSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(file)
+	if err := writer.Write(CSVHeader); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &CSVSink{file: file, writer: writer}, nil
+}
+
+// OpenCSVSink reopens an existing CSV file for appending, discarding any
+// content after offset. The offset must be one previously reported by Offset.
+func OpenCSVSink(path string, offset int64) (*CSVSink, error) {
+	file, err := openAt(path, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &CSVSink{file: file, writer: csv.NewWriter(file)}, nil
+}
+
+// openAt opens an existing file for writing, truncated to offset and
+// positioned at its end.
+func openAt(path string, offset int64) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err != nil || info.Size() < offset {
+		file.Close()
+		if err == nil {
+			err = fmt.Errorf("%s is shorter than offset %d", path, offset)
+		}
+		return nil, err
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// BeginTx implements AccessSink.
+func (s *CSVSink) BeginTx(blockNumber uint64, txIndex int, txHash common.Hash) {
+	s.agg.begin(blockNumber, txIndex, txHash)
+}
+
+// Access implements AccessSink.
+func (s *CSVSink) Access(rw *RWS) {
+	s.agg.add(rw)
+}
+
+// EndTx implements AccessSink.
+func (s *CSVSink) EndTx(receipt *types.Receipt) {
+	if set := s.agg.finish(receipt); set != nil {
+		s.writer.Write(CSVRecord(set))
+	}
+}
+
+// EndBlock implements AccessSink.
+func (s *CSVSink) EndBlock(blockNumber uint64, blockHash common.Hash) {
+	s.writer.Flush()
+}
+
+// Flush writes any buffered rows to the file.
+func (s *CSVSink) Flush() error {
+	s.writer.Flush()
+	return s.writer.Error()
+}
+
+// Offset flushes the buffered rows, syncs the file and returns the size of the
+// file, which always ends on a row boundary.
+func (s *CSVSink) Offset() (int64, error) {
+	if err := s.Flush(); err != nil {
+		return 0, err
+	}
+	if err := s.file.Sync(); err != nil {
+		return 0, err
+	}
+	return s.file.Seek(0, io.SeekCurrent)
+}
+
+// Close flushes the remaining rows and closes the file.
+func (s *CSVSink) Close() error {
+	if err := s.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// CSVRecord renders an access set as a CSV row matching CSVHeader.
+func CSVRecord(set *TxAccessSet) []string {
+	return rwtrace.CSVRecord(set.BlockNumber, set.TraceTx())
+}
@@ -0,0 +1,92 @@
+package hotcache
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// DBSink stores the access sets of every inserted block in the chain database,
+// next to the block itself. The sets of a processed block are held back until
+// the block is written, so blocks failing validation leave nothing behind.
+// Blocks without transactions get an empty list, so they can be told apart
+// from blocks processed without recording.
+type DBSink struct {
+	agg  aggregator
+	sets []*TxAccessSet
+
+	staged       []*TxAccessSet // Sets of the last processed block
+	stagedHash   common.Hash
+	stagedNumber uint64
+}
+
+// NewDBSink creates a sink storing the access sets with the blocks.
+func NewDBSink() *DBSink {
+	return new(DBSink)
+}
+
+// BeginTx implements AccessSink.
+func (s *DBSink) BeginTx(blockNumber uint64, txIndex int, txHash common.Hash) {
+	if txIndex == 0 {
+		s.sets = nil // Drop the leftovers of a block that failed processing
+	}
+	s.agg.begin(blockNumber, txIndex, txHash)
+}
+
+// Access implements AccessSink.
+func (s *DBSink) Access(rw *RWS) {
+	s.agg.add(rw)
+}
+
+// EndTx implements AccessSink.
+func (s *DBSink) EndTx(receipt *types.Receipt) {
+	if set := s.agg.finish(receipt); set != nil {
+		s.sets = append(s.sets, set)
+	}
+}
+
+// EndBlock implements AccessSink.
+func (s *DBSink) EndBlock(blockNumber uint64, blockHash common.Hash) {
+	if s.sets == nil {
+		s.sets = []*TxAccessSet{}
+	}
+	s.staged, s.stagedHash, s.stagedNumber = s.sets, blockHash, blockNumber
+	s.sets = nil
+}
+
+// WriteBlock implements BlockWriter. Nothing is written if the block wasn't
+// the last one processed.
+func (s *DBSink) WriteBlock(db ethdb.KeyValueWriter, blockHash common.Hash, blockNumber uint64) {
+	if s.staged == nil || s.stagedHash != blockHash || s.stagedNumber != blockNumber {
+		return
+	}
+	WriteBlockAccessSets(db, blockHash, blockNumber, s.staged)
+	s.staged = nil
+}
+
+// ReadBlockAccessSets retrieves the stored access sets of a block, nil if the
+// block was not recorded.
+func ReadBlockAccessSets(db ethdb.KeyValueReader, hash common.Hash, number uint64) []*TxAccessSet {
+	data := rawdb.ReadAccessSetsRLP(db, hash, number)
+	if len(data) == 0 {
+		return nil
+	}
+	sets := []*TxAccessSet{}
+	if err := rlp.DecodeBytes(data, &sets); err != nil {
+		log.Error("Invalid block access sets RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return sets
+}
+
+// WriteBlockAccessSets stores the access sets of a block.
+func WriteBlockAccessSets(db ethdb.KeyValueWriter, hash common.Hash, number uint64, sets []*TxAccessSet) {
+	data, err := rlp.EncodeToBytes(sets)
+	if err != nil {
+		log.Crit("Failed to encode block access sets", "err", err)
+	}
+	rawdb.WriteAccessSetsRLP(db, hash, number, data)
+}
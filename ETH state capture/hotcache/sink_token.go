@@ -0,0 +1,179 @@
+package hotcache
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	// TokenTxHeader is the header row of the transaction classification file.
+	TokenTxHeader = []string{"BlockNumber", "TxHash", "Token"}
+
+	// TransferHeader is the header row of the token transfer file. The column
+	// names follow the xblock.pro token transaction datasets.
+	TransferHeader = []string{"blockNumber", "transactionHash", "logIndex", "standard", "tokenAddress", "from", "to", "tokenId", "value"}
+
+	// VesselHeader is the header row of the vessel transaction file.
+	VesselHeader = []string{"Block Number", "Transaction Hash", "From", "To"}
+)
+
+// TokenSink decodes the token transfer events in the receipts of the processed
+// transactions. It classifies every transaction as token transaction (emitting
+// at least one transfer) or not, and writes three CSV files next to each
+// other: the classification, one row per transfer, and one vessel transaction
+// per transfer, which moves the token between the "<tx>_<from>_<token>" and
+// "<tx>_<to>_<token>" vessels. Rows are flushed at the end of every block.
+type TokenSink struct {
+	files   [3]*os.File
+	writers [3]*csv.Writer
+
+	blockNumber uint64
+	txHash      common.Hash
+}
+
+// TokenSinkPaths returns the paths of the files written by a token sink.
+func TokenSinkPaths(prefix string) [3]string {
+	return [3]string{prefix + "TokenTx.csv", prefix + "Transfers.csv", prefix + "vessel.csv"}
+}
+
+// NewTokenSink creates (or truncates) the token output files of prefix.
+func NewTokenSink(prefix string) (*TokenSink, error) {
+	headers := [3][]string{TokenTxHeader, TransferHeader, VesselHeader}
+
+	s := new(TokenSink)
+	for i, path := range TokenSinkPaths(prefix) {
+		file, err := os.Create(path)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.files[i], s.writers[i] = file, csv.NewWriter(file)
+		if err := s.writers[i].Write(headers[i]); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// OpenTokenSink reopens existing token output files for appending, discarding
+// any content after the given offsets, which must be ones previously reported
+// by Offsets.
+func OpenTokenSink(prefix string, offsets []int64) (*TokenSink, error) {
+	paths := TokenSinkPaths(prefix)
+	if len(offsets) != len(paths) {
+		return nil, fmt.Errorf("need %d token file offsets, have %d", len(paths), len(offsets))
+	}
+	s := new(TokenSink)
+	for i, path := range paths {
+		file, err := openAt(path, offsets[i])
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.files[i], s.writers[i] = file, csv.NewWriter(file)
+	}
+	return s, nil
+}
+
+// BeginTx implements AccessSink.
+func (s *TokenSink) BeginTx(blockNumber uint64, txIndex int, txHash common.Hash) {
+	s.blockNumber, s.txHash = blockNumber, txHash
+}
+
+// Access implements AccessSink.
+func (s *TokenSink) Access(rw *RWS) {}
+
+// EndTx implements AccessSink.
+func (s *TokenSink) EndTx(receipt *types.Receipt) {
+	var transfers []TokenTransfer
+	if receipt != nil {
+		transfers = DecodeTransfers(receipt.Logs)
+	}
+	var (
+		number = strconv.FormatUint(s.blockNumber, 10)
+		hash   = s.txHash.Hex()
+	)
+	s.writers[0].Write([]string{number, hash, strconv.FormatBool(len(transfers) > 0)})
+	for _, transfer := range transfers {
+		var (
+			token = hexutil.Encode(transfer.Token[:])
+			from  = hexutil.Encode(transfer.From[:])
+			to    = hexutil.Encode(transfer.To[:])
+		)
+		s.writers[1].Write([]string{
+			number, hash, strconv.FormatUint(uint64(transfer.LogIndex), 10), transfer.Standard,
+			token, from, to, bigString(transfer.TokenID), bigString(transfer.Value),
+		})
+		s.writers[2].Write([]string{number, hash, hash + "_" + from + "_" + token, hash + "_" + to + "_" + token})
+	}
+}
+
+func bigString(n *big.Int) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
+
+// EndBlock implements AccessSink.
+func (s *TokenSink) EndBlock(blockNumber uint64, blockHash common.Hash) {
+	s.Flush()
+}
+
+// Flush writes any buffered rows to the files.
+func (s *TokenSink) Flush() error {
+	for _, writer := range s.writers {
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Offsets flushes the buffered rows, syncs the files and returns their sizes,
+// in the order of TokenSinkPaths.
+func (s *TokenSink) Offsets() ([]int64, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	offsets := make([]int64, len(s.files))
+	for i, file := range s.files {
+		if err := file.Sync(); err != nil {
+			return nil, err
+		}
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		offsets[i] = offset
+	}
+	return offsets, nil
+}
+
+// Close flushes the remaining rows and closes the files.
+func (s *TokenSink) Close() error {
+	var err error
+	for i, file := range s.files {
+		if file == nil {
+			continue
+		}
+		s.writers[i].Flush()
+		if werr := s.writers[i].Error(); err == nil {
+			err = werr
+		}
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package hotcache
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/hotcache/rwtrace"
+)
+
+// TraceSink writes the access sets into a block-indexed rwtrace file. The
+// transactions of a block are written at the end of the block, or when the
+// sink is flushed.
+type TraceSink struct {
+	agg    aggregator
+	writer *rwtrace.Writer
+	block  *rwtrace.Block
+	err    error
+}
+
+// NewTraceSink creates (or truncates) the trace file at path.
+func NewTraceSink(path string) (*TraceSink, error) {
+	writer, err := rwtrace.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &TraceSink{writer: writer}, nil
+}
+
+// OpenTraceSink reopens an existing trace file for appending, discarding any
+// content after offset. The offset must be one previously reported by Offset.
+func OpenTraceSink(path string, offset int64) (*TraceSink, error) {
+	writer, err := rwtrace.Append(path, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &TraceSink{writer: writer}, nil
+}
+
+// BeginTx implements AccessSink.
+func (s *TraceSink) BeginTx(blockNumber uint64, txIndex int, txHash common.Hash) {
+	if s.block == nil || txIndex == 0 {
+		// Blocks never ended failed processing, drop their transactions
+		s.block = &rwtrace.Block{Number: blockNumber}
+	}
+	s.agg.begin(blockNumber, txIndex, txHash)
+}
+
+// Access implements AccessSink.
+func (s *TraceSink) Access(rw *RWS) {
+	s.agg.add(rw)
+}
+
+// EndTx implements AccessSink.
+func (s *TraceSink) EndTx(receipt *types.Receipt) {
+	if set := s.agg.finish(receipt); set != nil && s.block != nil {
+		s.block.Txs = append(s.block.Txs, set.TraceTx())
+	}
+}
+
+// EndBlock implements AccessSink.
+func (s *TraceSink) EndBlock(blockNumber uint64, blockHash common.Hash) {
+	s.Flush()
+}
+
+// Flush writes the transactions collected so far as a block and flushes the
+// file, reporting the first error encountered while writing.
+func (s *TraceSink) Flush() error {
+	if s.block != nil && s.err == nil {
+		s.err = s.writer.WriteBlock(s.block)
+	}
+	s.block = nil
+	if s.err == nil {
+		s.err = s.writer.Flush()
+	}
+	return s.err
+}
+
+// Offset flushes the collected transactions, syncs the file and returns the
+// offset following the last written block.
+func (s *TraceSink) Offset() (int64, error) {
+	if err := s.Flush(); err != nil {
+		return 0, err
+	}
+	return s.writer.Offset()
+}
+
+// Close flushes the remaining transactions, writes the index and closes the
+// file.
+func (s *TraceSink) Close() error {
+	s.Flush()
+	if err := s.writer.Close(); s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
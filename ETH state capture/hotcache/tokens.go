@@ -0,0 +1,163 @@
+package hotcache
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Token standards of the decoded transfer events.
+const (
+	ERC20   = "ERC20"
+	ERC721  = "ERC721"
+	ERC1155 = "ERC1155"
+)
+
+// ERC-20 and ERC-721 share the Transfer event signature, they only differ in
+// whether the third argument is indexed.
+const (
+	erc20ABIJSON = `[{"type":"event","name":"Transfer","inputs":[
+		{"name":"from","type":"address","indexed":true},
+		{"name":"to","type":"address","indexed":true},
+		{"name":"value","type":"uint256","indexed":false}]}]`
+	erc721ABIJSON = `[{"type":"event","name":"Transfer","inputs":[
+		{"name":"from","type":"address","indexed":true},
+		{"name":"to","type":"address","indexed":true},
+		{"name":"tokenId","type":"uint256","indexed":true}]}]`
+	erc1155ABIJSON = `[{"type":"event","name":"TransferSingle","inputs":[
+		{"name":"operator","type":"address","indexed":true},
+		{"name":"from","type":"address","indexed":true},
+		{"name":"to","type":"address","indexed":true},
+		{"name":"id","type":"uint256","indexed":false},
+		{"name":"value","type":"uint256","indexed":false}]},
+	{"type":"event","name":"TransferBatch","inputs":[
+		{"name":"operator","type":"address","indexed":true},
+		{"name":"from","type":"address","indexed":true},
+		{"name":"to","type":"address","indexed":true},
+		{"name":"ids","type":"uint256[]","indexed":false},
+		{"name":"values","type":"uint256[]","indexed":false}]}]`
+)
+
+var (
+	erc20ABI   = mustParseABI(erc20ABIJSON)
+	erc721ABI  = mustParseABI(erc721ABIJSON)
+	erc1155ABI = mustParseABI(erc1155ABIJSON)
+)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// TokenTransfer is a token movement decoded from a transfer event.
+type TokenTransfer struct {
+	Standard string
+	Token    common.Address // Contract emitting the event
+	From     common.Address // Zero address for mints
+	To       common.Address // Zero address for burns
+	TokenID  *big.Int       // Nil for ERC-20
+	Value    *big.Int       // Amount moved, 1 for ERC-721
+	LogIndex uint
+}
+
+// DecodeTransfers extracts the ERC-20, ERC-721 and ERC-1155 transfers from
+// the logs of a transaction, in log order. ERC-1155 batch transfers yield one
+// transfer per token id. Logs that are not well-formed transfer events are
+// skipped.
+func DecodeTransfers(logs []*types.Log) []TokenTransfer {
+	var transfers []TokenTransfer
+	for _, log := range logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+		switch topic := log.Topics[0]; {
+		case topic == erc20ABI.Events["Transfer"].ID && len(log.Topics) == 3:
+			args, ok := unpackEvent(erc20ABI, "Transfer", log)
+			if !ok {
+				continue
+			}
+			transfers = append(transfers, TokenTransfer{
+				Standard: ERC20,
+				Token:    log.Address,
+				From:     args["from"].(common.Address),
+				To:       args["to"].(common.Address),
+				Value:    args["value"].(*big.Int),
+				LogIndex: log.Index,
+			})
+		case topic == erc721ABI.Events["Transfer"].ID && len(log.Topics) == 4:
+			args, ok := unpackEvent(erc721ABI, "Transfer", log)
+			if !ok {
+				continue
+			}
+			transfers = append(transfers, TokenTransfer{
+				Standard: ERC721,
+				Token:    log.Address,
+				From:     args["from"].(common.Address),
+				To:       args["to"].(common.Address),
+				TokenID:  args["tokenId"].(*big.Int),
+				Value:    big.NewInt(1),
+				LogIndex: log.Index,
+			})
+		case topic == erc1155ABI.Events["TransferSingle"].ID && len(log.Topics) == 4:
+			args, ok := unpackEvent(erc1155ABI, "TransferSingle", log)
+			if !ok {
+				continue
+			}
+			transfers = append(transfers, TokenTransfer{
+				Standard: ERC1155,
+				Token:    log.Address,
+				From:     args["from"].(common.Address),
+				To:       args["to"].(common.Address),
+				TokenID:  args["id"].(*big.Int),
+				Value:    args["value"].(*big.Int),
+				LogIndex: log.Index,
+			})
+		case topic == erc1155ABI.Events["TransferBatch"].ID && len(log.Topics) == 4:
+			args, ok := unpackEvent(erc1155ABI, "TransferBatch", log)
+			if !ok {
+				continue
+			}
+			ids, values := args["ids"].([]*big.Int), args["values"].([]*big.Int)
+			if len(ids) != len(values) {
+				continue
+			}
+			for i := range ids {
+				transfers = append(transfers, TokenTransfer{
+					Standard: ERC1155,
+					Token:    log.Address,
+					From:     args["from"].(common.Address),
+					To:       args["to"].(common.Address),
+					TokenID:  ids[i],
+					Value:    values[i],
+					LogIndex: log.Index,
+				})
+			}
+		}
+	}
+	return transfers
+}
+
+// unpackEvent decodes the indexed and data arguments of an event log.
+func unpackEvent(contract abi.ABI, name string, log *types.Log) (map[string]interface{}, bool) {
+	event := contract.Events[name]
+	args := make(map[string]interface{})
+	if err := contract.UnpackIntoMap(args, name, log.Data); err != nil {
+		return nil, false
+	}
+	var indexed abi.Arguments
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexed, log.Topics[1:]); err != nil {
+		return nil, false
+	}
+	return args, true
+}
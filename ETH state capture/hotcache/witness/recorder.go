@@ -0,0 +1,186 @@
+package witness
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// HeaderReader retrieves the headers of a chain.
+type HeaderReader interface {
+	GetHeader(hash common.Hash, number uint64) *types.Header
+}
+
+// Recorder collects the witness of a block while it is executed. Trie nodes
+// are reported by the trie database (see trie.Database.SetNodeRecorder), code
+// reads go through the state database returned by Database and the block
+// hashes read by the EVM are seen by the recorder acting as EVM logger.
+type Recorder struct {
+	nodes map[common.Hash][]byte
+	codes map[common.Hash][]byte
+
+	number    uint64 // Number of the executed block
+	oldest    uint64 // Oldest block number read by BLOCKHASH
+	readsHash bool   // Whether any block hash was read
+
+	lock sync.Mutex
+}
+
+// NewRecorder creates an empty witness recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		nodes: make(map[common.Hash][]byte),
+		codes: make(map[common.Hash][]byte),
+	}
+}
+
+// AddNode records a resolved trie node.
+func (r *Recorder) AddNode(hash common.Hash, blob []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.nodes[hash]; !ok {
+		r.nodes[hash] = common.CopyBytes(blob)
+	}
+}
+
+// AddCode records a contract code read.
+func (r *Recorder) AddCode(hash common.Hash, code []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.codes[hash]; !ok {
+		r.codes[hash] = common.CopyBytes(code)
+	}
+}
+
+// Database wraps db to record the contract codes read through it.
+func (r *Recorder) Database(db state.Database) state.Database {
+	return &codeRecorder{Database: db, recorder: r}
+}
+
+// Witness assembles the recorded witness of block, looking up the parent and
+// the ancestors whose hashes were read in chain.
+func (r *Recorder) Witness(block *types.Block, chain HeaderReader) (*Witness, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// The EVM finds the hash of block n in the header of block n+1, walking
+	// back from the parent
+	oldest := block.NumberU64() - 1
+	if r.readsHash && r.oldest+1 < oldest {
+		oldest = r.oldest + 1
+	}
+	w := &Witness{Block: block}
+	hash, number := block.ParentHash(), block.NumberU64()-1
+	for {
+		header := chain.GetHeader(hash, number)
+		if header == nil {
+			return nil, fmt.Errorf("ancestor %d %x of block %d missing", number, hash, block.NumberU64())
+		}
+		w.Headers = append(w.Headers, header)
+		if number <= oldest || number == 0 {
+			break
+		}
+		hash, number = header.ParentHash, number-1
+	}
+	w.Codes = sortedBlobs(r.codes)
+	w.Nodes = sortedBlobs(r.nodes)
+	return w, nil
+}
+
+// sortedBlobs returns the values of set ordered by their keys, so that the
+// witness of a block doesn't depend on the map iteration order.
+func sortedBlobs(set map[common.Hash][]byte) [][]byte {
+	keys := make([]common.Hash, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+
+	blobs := make([][]byte, len(keys))
+	for i, key := range keys {
+		blobs[i] = set[key]
+	}
+	return blobs
+}
+
+// codeRecorder is a state database recording the contract codes read.
+type codeRecorder struct {
+	state.Database
+	recorder *Recorder
+}
+
+// ContractCode implements state.Database.
+func (db *codeRecorder) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	code, err := db.Database.ContractCode(addrHash, codeHash)
+	if err == nil {
+		db.recorder.AddCode(codeHash, code)
+	}
+	return code, err
+}
+
+// ContractCodeSize implements state.Database. The size is only known from the
+// code itself, so the code is part of the witness too.
+func (db *codeRecorder) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	code, err := db.ContractCode(addrHash, codeHash)
+	return len(code), err
+}
+
+// CaptureState implements vm.EVMLogger, noting the oldest block hash read.
+func (r *Recorder) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if op != vm.BLOCKHASH || err != nil || len(scope.Stack.Data()) == 0 {
+		return
+	}
+	num := scope.Stack.Back(0)
+	if !num.IsUint64() {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// Hashes out of the 256 block window are not looked up
+	number := num.Uint64()
+	if number >= r.number || number+256 < r.number {
+		return
+	}
+	if !r.readsHash || number < r.oldest {
+		r.oldest, r.readsHash = number, true
+	}
+}
+
+// CaptureTxStart implements vm.EVMLogger.
+func (r *Recorder) CaptureTxStart(gasLimit uint64) {}
+
+// CaptureTxEnd implements vm.EVMLogger.
+func (r *Recorder) CaptureTxEnd(restGas uint64) {}
+
+// CaptureStart implements vm.EVMLogger.
+func (r *Recorder) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.number = env.Context.BlockNumber.Uint64()
+}
+
+// CaptureEnd implements vm.EVMLogger.
+func (r *Recorder) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) {}
+
+// CaptureEnter implements vm.EVMLogger.
+func (r *Recorder) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+// CaptureExit implements vm.EVMLogger.
+func (r *Recorder) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+// CaptureFault implements vm.EVMLogger.
+func (r *Recorder) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
@@ -0,0 +1,161 @@
+package witness
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Verify executes the block of a witness on the state held by the witness
+// alone, and checks that it arrives at the gas used and state root of the
+// block header. Consensus rewards are applied by engine.
+func Verify(config *params.ChainConfig, engine consensus.Engine, w *Witness) error {
+	if w.Block == nil {
+		return errors.New("witness without block")
+	}
+	parent := w.Parent()
+	if parent == nil || parent.Hash() != w.Block.ParentHash() {
+		return fmt.Errorf("witness of block %d lacks its parent", w.Block.NumberU64())
+	}
+	chain, err := newWitnessChain(config, engine, w.Headers)
+	if err != nil {
+		return err
+	}
+	statedb, err := state.New(parent.Root, w.StateDatabase(), nil, nil)
+	if err != nil {
+		return fmt.Errorf("block %d: %w", w.Block.NumberU64(), err)
+	}
+	gasUsed, err := execute(config, chain, w.Block, statedb, vm.Config{})
+	if err != nil {
+		return fmt.Errorf("block %d: %w", w.Block.NumberU64(), err)
+	}
+	root := statedb.IntermediateRoot(config.IsEIP158(w.Block.Number()))
+	if err := statedb.Error(); err != nil {
+		return fmt.Errorf("block %d: incomplete witness: %w", w.Block.NumberU64(), err)
+	}
+	if gasUsed != w.Block.GasUsed() {
+		return fmt.Errorf("block %d: gas used %d, header has %d", w.Block.NumberU64(), gasUsed, w.Block.GasUsed())
+	}
+	if root != w.Block.Root() {
+		return fmt.Errorf("block %d: state root %x, header has %x", w.Block.NumberU64(), root, w.Block.Root())
+	}
+	return nil
+}
+
+// StateDatabase returns a state database holding the trie nodes and contract
+// codes of the witness alone, on which the state of the parent block can be
+// opened. Reads of anything else fail with a missing trie node error.
+func (w *Witness) StateDatabase() state.Database {
+	db := rawdb.NewMemoryDatabase()
+	for _, node := range w.Nodes {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	for _, code := range w.Codes {
+		rawdb.WriteCode(db, crypto.Keccak256Hash(code), code)
+	}
+	return state.NewDatabase(db)
+}
+
+// ChainContext returns a chain context serving the ancestor headers of the
+// witness, for executing the transactions of the block outside of a chain.
+func (w *Witness) ChainContext(config *params.ChainConfig, engine consensus.Engine) (core.ChainContext, error) {
+	if len(w.Headers) == 0 {
+		return nil, errors.New("witness without headers")
+	}
+	return newWitnessChain(config, engine, w.Headers)
+}
+
+// execute applies the transactions and the consensus rewards of block to
+// statedb the way the state processor does, and returns the gas used.
+func execute(config *params.ChainConfig, chain *witnessChain, block *types.Block, statedb *state.StateDB, cfg vm.Config) (uint64, error) {
+	var (
+		header  = block.Header()
+		gp      = new(core.GasPool).AddGas(block.GasLimit())
+		usedGas = new(uint64)
+	)
+	if config.DAOForkSupport && config.DAOForkBlock != nil && config.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(statedb)
+	}
+	for i, tx := range block.Transactions() {
+		statedb.Prepare(tx.Hash(), i)
+		if _, err := core.ApplyTransaction(config, chain, nil, gp, statedb, header, tx, usedGas, cfg); err != nil {
+			return 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
+		}
+	}
+	chain.engine.Finalize(chain, header, statedb, block.Transactions(), block.Uncles())
+	return *usedGas, nil
+}
+
+// witnessChain serves the ancestor headers of a witness to the EVM and the
+// consensus engine.
+type witnessChain struct {
+	config  *params.ChainConfig
+	engine  consensus.Engine
+	headers map[common.Hash]*types.Header
+	head    *types.Header
+}
+
+func newWitnessChain(config *params.ChainConfig, engine consensus.Engine, headers []*types.Header) (*witnessChain, error) {
+	chain := &witnessChain{
+		config:  config,
+		engine:  engine,
+		headers: make(map[common.Hash]*types.Header, len(headers)),
+		head:    headers[0],
+	}
+	for i, header := range headers {
+		if i > 0 && headers[i-1].ParentHash != header.Hash() {
+			return nil, fmt.Errorf("witness header %d not the parent of %d", header.Number, headers[i-1].Number)
+		}
+		chain.headers[header.Hash()] = header
+	}
+	return chain, nil
+}
+
+// Engine implements core.ChainContext.
+func (c *witnessChain) Engine() consensus.Engine { return c.engine }
+
+// Config implements consensus.ChainHeaderReader.
+func (c *witnessChain) Config() *params.ChainConfig { return c.config }
+
+// CurrentHeader implements consensus.ChainHeaderReader.
+func (c *witnessChain) CurrentHeader() *types.Header { return c.head }
+
+// GetHeader implements core.ChainContext.
+func (c *witnessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.headers[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+// GetHeaderByNumber implements consensus.ChainHeaderReader.
+func (c *witnessChain) GetHeaderByNumber(number uint64) *types.Header {
+	for _, header := range c.headers {
+		if header.Number.Uint64() == number {
+			return header
+		}
+	}
+	return nil
+}
+
+// GetHeaderByHash implements consensus.ChainHeaderReader.
+func (c *witnessChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.headers[hash]
+}
+
+// GetTd implements consensus.ChainHeaderReader. Total difficulties are not
+// part of a witness.
+func (c *witnessChain) GetTd(hash common.Hash, number uint64) *big.Int {
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package witness implements stateless block witnesses: the block together
+// with every trie node, contract code and ancestor header its execution reads,
+// enough to execute it again without a state database.
+//
+// A witness file is a plain stream of RLP encoded witnesses, one per block.
+package witness
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Witness holds a block and the pre-state it executes on.
+type Witness struct {
+	Block *types.Block
+
+	// Headers holds the parent of the block and, if the block reads older
+	// block hashes, the ancestors down to the oldest one read, newest first.
+	Headers []*types.Header
+
+	Codes [][]byte // Contract codes executed or read
+	Nodes [][]byte // Account and storage trie nodes resolved
+}
+
+// Parent returns the header of the block's parent.
+func (w *Witness) Parent() *types.Header {
+	if len(w.Headers) == 0 {
+		return nil
+	}
+	return w.Headers[0]
+}
+
+// Writer appends witnesses to a witness file.
+type Writer struct {
+	file   *os.File
+	buf    *bufio.Writer
+	offset int64
+}
+
+// NewWriter creates (or truncates) a witness file.
+func NewWriter(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{file: file, buf: bufio.NewWriter(file)}, nil
+}
+
+// OpenWriter reopens an existing witness file for appending, discarding any
+// content after offset, which must be one previously reported by Offset.
+func OpenWriter(path string, offset int64) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err != nil || info.Size() < offset {
+		file.Close()
+		if err == nil {
+			err = fmt.Errorf("%s is shorter than offset %d", path, offset)
+		}
+		return nil, err
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Writer{file: file, buf: bufio.NewWriter(file), offset: offset}, nil
+}
+
+// Write appends a witness to the file.
+func (w *Writer) Write(witness *Witness) error {
+	blob, err := rlp.EncodeToBytes(witness)
+	if err != nil {
+		return err
+	}
+	n, err := w.buf.Write(blob)
+	w.offset += int64(n)
+	return err
+}
+
+// Offset flushes the buffered witnesses, syncs the file and returns the size
+// of the file.
+func (w *Writer) Offset() (int64, error) {
+	if err := w.buf.Flush(); err != nil {
+		return 0, err
+	}
+	return w.offset, w.file.Sync()
+}
+
+// Close flushes the buffered witnesses and closes the file.
+func (w *Writer) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Reader iterates over the witnesses of a witness file.
+type Reader struct {
+	file   *os.File
+	stream *rlp.Stream
+}
+
+// OpenReader opens a witness file for reading.
+func OpenReader(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{file: file, stream: rlp.NewStream(bufio.NewReader(file), 0)}, nil
+}
+
+// Next decodes the next witness of the file, returning io.EOF at its end.
+func (r *Reader) Next() (*Witness, error) {
+	witness := new(Witness)
+	if err := r.stream.Decode(witness); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	return witness, nil
+}
+
+// Close closes the file.
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,174 @@
+package witness
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testChain generates a few blocks calling a contract that counts its calls
+// and stores the parent block hash, plus a transfer to a new account each.
+func testChain(t *testing.T) (*params.ChainConfig, []*types.Block, *state.StateDB) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0xc0de")
+		config   = params.TestChainConfig
+		db       = rawdb.NewMemoryDatabase()
+		genesis  = &core.Genesis{
+			Config: config,
+			Alloc: core.GenesisAlloc{
+				sender: {Balance: big.NewInt(params.Ether)},
+				contract: {
+					Balance: common.Big0,
+					// slot0++; slot1 = blockhash(number-1)
+					Code:    common.FromHex("600054600101600055600143034060015500"),
+					Storage: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(7))},
+				},
+			},
+		}
+		signer = types.LatestSigner(config)
+	)
+	gblock := genesis.MustCommit(db)
+	blocks, _ := core.GenerateChain(config, gblock, ethash.NewFaker(), db, 3, func(i int, b *core.BlockGen) {
+		call, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), contract, common.Big0, 100000, b.BaseFee(), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(call)
+		transfer, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), common.BigToAddress(big.NewInt(int64(0x1000+i))), common.Big1, 21000, b.BaseFee(), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(transfer)
+	})
+	parent := blocks[len(blocks)-2]
+	statedb, err := state.New(parent.Root(), state.NewDatabase(db), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config, blocks, statedb
+}
+
+// recordWitness executes the last block on statedb, recording its witness.
+func recordWitness(t *testing.T, config *params.ChainConfig, blocks []*types.Block, pre *state.StateDB) *Witness {
+	var (
+		block    = blocks[len(blocks)-1]
+		recorder = NewRecorder()
+		sdb      = pre.Database()
+	)
+	sdb.TrieDB().SetNodeRecorder(recorder.AddNode)
+	defer sdb.TrieDB().SetNodeRecorder(nil)
+
+	statedb, err := state.New(blocks[len(blocks)-2].Root(), recorder.Database(sdb), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers []*types.Header
+	for i := len(blocks) - 2; i >= 0; i-- {
+		headers = append(headers, blocks[i].Header())
+	}
+	chain, err := newWitnessChain(config, ethash.NewFaker(), headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execute(config, chain, block, statedb, vm.Config{Debug: true, Tracer: recorder}); err != nil {
+		t.Fatal(err)
+	}
+	if root := statedb.IntermediateRoot(config.IsEIP158(block.Number())); root != block.Root() {
+		t.Fatalf("recording run root mismatch: have %x, want %x", root, block.Root())
+	}
+	w, err := recorder.Witness(block, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWitnessVerify(t *testing.T) {
+	config, blocks, pre := testChain(t)
+	w := recordWitness(t, config, blocks, pre)
+
+	if len(w.Headers) != 1 || w.Headers[0].Hash() != blocks[len(blocks)-2].Hash() {
+		t.Fatalf("unexpected witness headers: %v", w.Headers)
+	}
+	if len(w.Codes) != 1 {
+		t.Fatalf("witness has %d codes, want 1", len(w.Codes))
+	}
+	if err := Verify(config, ethash.NewFaker(), w); err != nil {
+		t.Fatalf("witness rejected: %v", err)
+	}
+	// Every node is needed, dropping any one must fail the verification
+	for i := range w.Nodes {
+		partial := *w
+		partial.Nodes = append(append([][]byte{}, w.Nodes[:i]...), w.Nodes[i+1:]...)
+		if err := Verify(config, ethash.NewFaker(), &partial); err == nil {
+			t.Errorf("witness without node %d accepted", i)
+		}
+	}
+	partial := *w
+	partial.Codes = nil
+	if err := Verify(config, ethash.NewFaker(), &partial); err == nil {
+		t.Error("witness without code accepted")
+	}
+}
+
+func TestWitnessFile(t *testing.T) {
+	config, blocks, pre := testChain(t)
+	w := recordWitness(t, config, blocks, pre)
+	path := filepath.Join(t.TempDir(), "witness.rlp")
+
+	writer, err := NewWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(w); err != nil {
+		t.Fatal(err)
+	}
+	offset, err := writer.Offset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Resuming drops the second witness
+	if writer, err = OpenWriter(path, offset); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	have, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have.Block.Hash() != w.Block.Hash() || len(have.Nodes) != len(w.Nodes) || len(have.Codes) != len(w.Codes) {
+		t.Fatal("decoded witness differs")
+	}
+	if err := Verify(config, ethash.NewFaker(), have); err != nil {
+		t.Fatalf("decoded witness rejected: %v", err)
+	}
+	if _, err := reader.Next(); err == nil {
+		t.Fatal("expected end of file")
+	}
+}
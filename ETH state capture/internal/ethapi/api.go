@@ -35,11 +35,13 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+	"github.com/ethereum/go-ethereum/hotcache"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params"
@@ -1933,6 +1935,85 @@ func (api *DebugAPI) GetRawReceipts(ctx context.Context, blockNrOrHash rpc.Block
 	return result, nil
 }
 
+// RPCAccessSet is the recorded state footprint of a transaction. State items
+// are rendered as in the captured CSV files.
+type RPCAccessSet struct {
+	BlockHash        common.Hash      `json:"blockHash"`
+	BlockNumber      hexutil.Uint64   `json:"blockNumber"`
+	TransactionHash  common.Hash      `json:"transactionHash"`
+	TransactionIndex hexutil.Uint64   `json:"transactionIndex"`
+	Status           hexutil.Uint64   `json:"status"`
+	GasUsed          hexutil.Uint64   `json:"gasUsed"`
+	Invoked          []common.Address `json:"invoked"`
+	Reads            []string         `json:"reads"`
+	Writes           []string         `json:"writes"`
+	SilentWrites     []string         `json:"silentWrites"`
+	Reverted         []string         `json:"reverted"`
+}
+
+func newRPCAccessSet(set *hotcache.TxAccessSet, blockHash common.Hash) *RPCAccessSet {
+	invoked := set.Invoked
+	if invoked == nil {
+		invoked = []common.Address{}
+	}
+	return &RPCAccessSet{
+		BlockHash:        blockHash,
+		BlockNumber:      hexutil.Uint64(set.BlockNumber),
+		TransactionHash:  set.TxHash,
+		TransactionIndex: hexutil.Uint64(set.TxIndex),
+		Status:           hexutil.Uint64(set.Status),
+		GasUsed:          hexutil.Uint64(set.GasUsed),
+		Invoked:          invoked,
+		Reads:            hotcache.KeyStrings(set.Reads),
+		Writes:           hotcache.KeyStrings(set.Writes),
+		SilentWrites:     hotcache.KeyStrings(set.SilentWrites),
+		Reverted:         hotcache.KeyStrings(set.Reverted),
+	}
+}
+
+// GetBlockAccessSets returns the recorded access sets of the transactions in a
+// block. Access sets are only recorded by nodes running with --vm.accesssets
+// or by the capture command.
+func (api *DebugAPI) GetBlockAccessSets(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]*RPCAccessSet, error) {
+	header, err := api.b.HeaderByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, errors.New("block not found")
+	}
+	hash, number := header.Hash(), header.Number.Uint64()
+	if !rawdb.HasAccessSets(api.b.ChainDb(), hash, number) {
+		return nil, fmt.Errorf("access sets of block #%d not recorded", number)
+	}
+	sets := hotcache.ReadBlockAccessSets(api.b.ChainDb(), hash, number)
+	result := make([]*RPCAccessSet, len(sets))
+	for i, set := range sets {
+		result[i] = newRPCAccessSet(set, hash)
+	}
+	return result, nil
+}
+
+// GetTransactionAccessSet returns the recorded access set of a transaction.
+func (api *DebugAPI) GetTransactionAccessSet(ctx context.Context, hash common.Hash) (*RPCAccessSet, error) {
+	tx, blockHash, blockNumber, _, err := api.b.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, nil
+	}
+	if !rawdb.HasAccessSets(api.b.ChainDb(), blockHash, blockNumber) {
+		return nil, fmt.Errorf("access sets of block #%d not recorded", blockNumber)
+	}
+	for _, set := range hotcache.ReadBlockAccessSets(api.b.ChainDb(), blockHash, blockNumber) {
+		if set.TxHash == hash {
+			return newRPCAccessSet(set, blockHash), nil
+		}
+	}
+	return nil, fmt.Errorf("access set of transaction %x not recorded", hash)
+}
+
 // PrintBlock retrieves a block and returns its pretty printed form.
 func (api *DebugAPI) PrintBlock(ctx context.Context, number uint64) (string, error) {
 	block, _ := api.b.BlockByNumber(ctx, rpc.BlockNumber(number))
@@ -33,6 +33,7 @@ const (
 	VMCategory         = "VIRTUAL MACHINE"
 	LoggingCategory    = "LOGGING AND DEBUGGING"
 	MetricsCategory    = "METRICS AND STATS"
+	CaptureCategory    = "STATE CAPTURE"
 	MiscCategory       = "MISC"
 	DeprecatedCategory = "ALIASED (deprecated)"
 )
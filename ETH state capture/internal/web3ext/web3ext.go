@@ -238,6 +238,16 @@ web3._extend({
 			call: 'debug_getRawReceipts',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getBlockAccessSets',
+			call: 'debug_getBlockAccessSets',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getTransactionAccessSet',
+			call: 'debug_getTransactionAccessSet',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'setHead',
 			call: 'debug_setHead',
@@ -23,6 +23,7 @@ import (
 	"reflect"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/fastcache"
@@ -96,6 +97,8 @@ type Database struct {
 	childrenSize common.StorageSize // Storage size of the external children tracking
 	preimages    *preimageStore     // The store for caching preimages
 
+	recorder func(hash common.Hash, blob []byte) // Callback receiving every resolved node, if set
+
 	lock sync.RWMutex
 }
 
@@ -430,14 +433,29 @@ func (db *Database) insert(hash common.Hash, size int, node node) {
 	db.dirtiesSize += common.StorageSize(common.HashLength + entry.size)
 }
 
+// SetNodeRecorder installs a callback receiving the hash and RLP encoding of
+// every node resolved by the tries opened on db, wherever the node was found,
+// or removes it if recorder is nil. Only the regular node lookups are reported,
+// not those of the hot cache variants. The callback must not be changed while
+// tries are being resolved.
+func (db *Database) SetNodeRecorder(recorder func(hash common.Hash, blob []byte)) {
+	db.recorder = recorder
+}
+
 // node retrieves a cached trie node from memory, or returns nil if none can be
 // found in the memory cache.
-func (db *Database) node(hash common.Hash) node {
-	fmt.Println(hash.String())
+func (db *Database) node(hash common.Hash, stats *hotcache.IOStats) node {
 	// Retrieve the node from the clean cache if available
 	if db.cleans != nil {
 
 		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
+			if db.recorder != nil {
+				db.recorder(hash, enc)
+			}
+			if stats != nil {
+				stats.CleanNodes++
+				stats.ReadBytes += uint64(len(enc))
+			}
 			//memcacheCleanHitMeter.Mark(1)
 			//memcacheCleanReadMeter.Mark(int64(len(enc)))
 
@@ -475,7 +493,13 @@ func (db *Database) node(hash common.Hash) node {
 	if dirty != nil {
 		//memcacheDirtyHitMeter.Mark(1)
 		//memcacheDirtyReadMeter.Mark(int64(dirty.size))
-
+		if db.recorder != nil {
+			db.recorder(hash, dirty.rlp())
+		}
+		if stats != nil {
+			stats.DirtyNodes++
+			stats.ReadBytes += uint64(dirty.size)
+		}
 		return dirty.obj(hash)
 	}
 	//memcacheDirtyMissMeter.Mark(1)
@@ -487,7 +511,15 @@ func (db *Database) node(hash common.Hash) node {
 	if err != nil || enc == nil {
 		return nil
 	}
-	db.hotcache.Node_disk_get_num++
+	atomic.AddUint64(&db.hotcache.Node_disk_get_num, 1)
+	if db.recorder != nil {
+		db.recorder(hash, enc)
+	}
+	if stats != nil {
+		stats.DiskNodes++
+		stats.ReadBytes += uint64(len(enc))
+		stats.DiskBytes += uint64(len(enc))
+	}
 
 	if db.cleans != nil {
 		db.cleans.Set(hash[:], enc)
@@ -21,6 +21,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/hotcache"
 )
 
 // Tests that the trie database returns a missing trie node error if attempting
@@ -31,3 +32,52 @@ func TestDatabaseMetarootFetch(t *testing.T) {
 		t.Fatalf("metaroot retrieval succeeded")
 	}
 }
+
+// Tests that the nodes resolved by a trie are counted by where they were found.
+func TestDatabaseIOStats(t *testing.T) {
+	var (
+		diskdb = memorydb.New()
+		triedb = NewDatabaseWithConfig(diskdb, &Config{Cache: 16})
+		trie   = NewEmpty(triedb)
+		keys   [][]byte
+	)
+	for i := byte(0); i < 100; i++ {
+		key := common.LeftPadBytes([]byte{i, i * 7}, 32)
+		trie.Update(key, []byte{i})
+		keys = append(keys, key)
+	}
+	root, nodes, err := trie.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := triedb.Update(NewWithNodeSet(nodes)); err != nil {
+		t.Fatal(err)
+	}
+	read := func(db *Database) hotcache.IOStats {
+		var stats hotcache.IOStats
+		tr, err := New(common.Hash{}, root, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr.SetIOStats(&stats)
+		for _, key := range keys {
+			if _, err := tr.TryGet(key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return stats
+	}
+	if stats := read(triedb); stats.DirtyNodes == 0 || stats.CleanNodes != 0 || stats.DiskNodes != 0 || stats.ReadBytes == 0 {
+		t.Errorf("dirty reads counted as %+v", stats)
+	}
+	if err := triedb.Commit(root, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats := read(triedb); stats.CleanNodes == 0 || stats.DirtyNodes != 0 || stats.DiskNodes != 0 {
+		t.Errorf("clean reads counted as %+v", stats)
+	}
+	stats := read(NewDatabase(diskdb))
+	if stats.DiskNodes == 0 || stats.CleanNodes != 0 || stats.DirtyNodes != 0 || stats.DiskBytes != stats.ReadBytes {
+		t.Errorf("disk reads counted as %+v", stats)
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/hotcache"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
 )
@@ -304,6 +305,12 @@ func (t *StateTrie) Copy() *StateTrie {
 	}
 }
 
+// SetIOStats makes the trie count the nodes it resolves from the database in
+// stats, see Trie.SetIOStats.
+func (t *StateTrie) SetIOStats(stats *hotcache.IOStats) {
+	t.trie.SetIOStats(stats)
+}
+
 // NodeIterator returns an iterator that returns nodes of the underlying trie. Iteration
 // starts at the key after the given start key.
 func (t *StateTrie) NodeIterator(start []byte) NodeIterator {
@@ -76,6 +76,9 @@ type Trie struct {
 	// tracer is the tool to track the trie changes.
 	// It will be reset after each commit operation.
 	tracer *tracer
+
+	// stats counts the nodes resolved from db, if set.
+	stats *hotcache.IOStats
 }
 
 // newFlag returns the cache flag value for a newly created node.
@@ -91,9 +94,16 @@ func (t *Trie) Copy() *Trie {
 		unhashed: t.unhashed,
 		db:       t.db,
 		tracer:   t.tracer.copy(),
+		stats:    t.stats,
 	}
 }
 
+// SetIOStats makes the trie count the nodes it resolves from the database in
+// stats, or stop counting if stats is nil. Copies of the trie share its stats.
+func (t *Trie) SetIOStats(stats *hotcache.IOStats) {
+	t.stats = stats
+}
+
 // New creates a trie with an existing root node from db and an assigned
 // owner for storage proximity.
 //
@@ -655,8 +665,7 @@ func (t *Trie) resolve(n node, prefix []byte) (node, error) {
 func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	hash := common.BytesToHash(n)
 
-	if node := t.db.node(hash); node != nil {
-
+	if node := t.db.node(hash, t.stats); node != nil {
 		return node, nil
 	}
 	return nil, &MissingNodeError{Owner: t.owner, NodeHash: hash, Path: prefix}
@@ -1,56 +1,20 @@
 package main
 
 import (
-	"encoding/csv"
-	"fmt"
-	"os"
-	"strconv"
 	"sync"
 	"time"
 )
 
-// deoccExecuteTransaction simulates the execution of a transaction and checks for conflicts.
-func deoccExecuteTransaction(tx *Transaction, txs []Transaction, semaphore chan struct{}, sm *StateManager, i int, fLine *finishLine) {
-
+// deoccExecuteTransaction attempts transaction i and marks it finished once
+// its writes are committed.
+func deoccExecuteTransaction(block *Block, exec Executor, semaphore chan struct{}, i int, fLine *finishLine) {
 	semaphore <- struct{}{}
+	defer func() { <-semaphore }()
 
-	snapshot := make(map[string]int)
-
-	for _, addr := range tx.ReadStateAddresses {
-		snapshot[addr] = sm.stateMap[addr].Version
-	}
-	for _, addr := range tx.WriteStateAddresses {
-		snapshot[addr] = sm.stateMap[addr].Version
-	}
-
-	time.Sleep(time.Nanosecond * time.Duration(tx.ExecutionTime)) // Simulate transaction execution time
-	conflict := false
-
-	sm.lock.RLock()
-	for addr, version := range snapshot {
-		currentVersion := sm.stateMap[addr].Version
-		if currentVersion != version {
-			conflict = true
-			break
-		}
-	}
-	sm.lock.RUnlock()
-
-	if !conflict {
-		sm.lock.Lock()
-		for _, addr := range tx.WriteStateAddresses {
-			sm.stateMap[addr].Value++
-			sm.stateMap[addr].Version++
-		}
-		sm.lock.Unlock()
+	if exec.Attempt(block, i) {
 		fLine.lock.Lock()
 		fLine.fs[i] = true
-		ff := make([]bool, len(txs))
-		copy(ff, fLine.fs)
 		fLine.lock.Unlock()
-		<-semaphore
-	} else {
-		<-semaphore
 	}
 }
 
@@ -96,84 +60,77 @@ func BuildConflictGraph(transactions []Transaction) [][]bool {
 	return conflictGraph
 }
 
-// deOCC simulates the execution of transactions using the deOCC algorithm.
-func deOCC(blocks []Block, stateManager *StateManager, class string) {
-	outputFilePath := strconv.Itoa(thread) + class + "_deocc_execution_times.csv"
-	outputFile, err := os.Create(outputFilePath)
-	if err != nil {
-		fmt.Printf("Error creating output file: %v\n", err)
-		return
-	}
-	defer outputFile.Close()
-	writer := csv.NewWriter(outputFile)
-	defer writer.Flush()
-	writer.Write([]string{"BlockNumber", "ExecutionTime(ms)", "ValidationTime(ms)", "needRW"})
-
-	totalExecTime := time.Duration(0)
-	totalValiTime := time.Duration(0)
+// deoccScheduler executes the transactions of a block optimistically until all
+// are committed, then builds an acyclic dependency graph from their conflicts
+// and executes the block once more in its order for validation.
+type deoccScheduler struct{}
 
-	for _, block := range blocks {
-		println("Start of packaging phase:", block.BlockNumber)
-		startTime := time.Now()
-		semaphore := make(chan struct{}, thread)
-		fLine := &finishLine{fs: make([]bool, len(block.Transactions))}
-		var toExecute []int
-		for i := range block.Transactions {
-			toExecute = append(toExecute, i)
+// ExecuteBlock implements Scheduler.
+func (deoccScheduler) ExecuteBlock(block *Block, exec Executor, workers int) (Result, error) {
+	if err := exec.BeginBlock(block); err != nil {
+		return Result{}, err
+	}
+	startTime := time.Now()
+	semaphore := make(chan struct{}, workers)
+	fLine := &finishLine{fs: make([]bool, len(block.Transactions))}
+	var toExecute []int
+	for i := range block.Transactions {
+		toExecute = append(toExecute, i)
+	}
+	executions := 0
+	for len(toExecute) > 0 {
+		executions += len(toExecute)
+		wg := sync.WaitGroup{}
+		for _, i := range toExecute {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				deoccExecuteTransaction(block, exec, semaphore, i, fLine)
+			}(i)
 		}
-		for len(toExecute) > 0 {
-			wg := sync.WaitGroup{}
-			for _, i := range toExecute {
-				wg.Add(1)
-				go func(i int) {
-					defer wg.Done()
-					deoccExecuteTransaction(&block.Transactions[i], block.Transactions, semaphore, stateManager, i, fLine)
-				}(i)
-			}
-			wg.Wait()
-			toExecute = toExecute[:0]
-			for i, done := range fLine.fs {
-				if !done {
-					toExecute = append(toExecute, i)
-				}
+		wg.Wait()
+		toExecute = toExecute[:0]
+		for i, done := range fLine.fs {
+			if !done {
+				toExecute = append(toExecute, i)
 			}
 		}
-		tdg, sum := buildtdg(block.Transactions)
-		maxSize := tdg.CalculateMaxReachableSubgraphSize()
-		println("max:", maxSize, "total:", len(block.Transactions))
-		execTime := time.Since(startTime)
-		totalExecTime += execTime
-		println(sum)
-		println("Start of validation phase:", block.BlockNumber)
-		startTime = time.Now()
-		for {
-			executable := findExecutableTransactions(tdg.graph)
-			if len(executable) <= 1 {
-				break
-			}
-			var wg sync.WaitGroup
-			semaphore := make(chan struct{}, thread)
-			for _, txIndex := range executable {
-				wg.Add(1)
-				go func(index int) {
-					defer wg.Done()
-					semaphore <- struct{}{}
-					for _, addr := range append(block.Transactions[index].ReadStateAddresses, block.Transactions[index].WriteStateAddresses...) {
-						_ = stateManager.stateMap[addr]
-					}
-					time.Sleep(time.Nanosecond * time.Duration(block.Transactions[index].ExecutionTime))
-					tdg.RemoveTransaction(index)
-					<-semaphore
-				}(txIndex)
-			}
-			wg.Wait()
+	}
+	tdg, sum := buildtdg(block.Transactions)
+	execTime := time.Since(startTime)
+	if err := exec.BeginBlock(block); err != nil {
+		return Result{}, err
+	}
+	startTime = time.Now()
+	for {
+		executable := findExecutableTransactions(tdg.graph)
+		if len(executable) == 0 {
+			break
 		}
-		valiTime := time.Since(startTime)
-		totalValiTime += valiTime
-		writer.Write([]string{block.BlockNumber, fmt.Sprintf("%d", execTime.Milliseconds()), fmt.Sprintf("%d", valiTime.Milliseconds()), fmt.Sprintf("%d", sum)})
+		var wg sync.WaitGroup
+		semaphore := make(chan struct{}, workers)
+		for _, txIndex := range executable {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				exec.Apply(block, index)
+				tdg.RemoveTransaction(index)
+				<-semaphore
+			}(txIndex)
+		}
+		wg.Wait()
 	}
-	writer.Write([]string{"Total Execution Time", fmt.Sprintf("%d", totalExecTime.Milliseconds())})
-	writer.Write([]string{"Total Validation Time", fmt.Sprintf("%d", totalValiTime.Milliseconds())})
+	return Result{ExecTime: execTime, ValidationTime: time.Since(startTime), NeedRW: sum, Executions: executions, Aborts: executions - len(block.Transactions)}, nil
+}
+
+// SimulateBlock implements VirtualScheduler.
+func (deoccScheduler) SimulateBlock(block *Block, workers int) Result {
+	txs := block.Transactions
+	execTime, busy, executions := simulateOCC(txs, workers, nil)
+	tdg, sum := buildtdg(txs)
+	valiTime, valiBusy := simulateGraph(tdg, txs, 0, workers)
+	return Result{ExecTime: execTime, ValidationTime: valiTime, NeedRW: sum, Executions: executions, Aborts: executions - len(txs), Busy: busy + valiBusy}
 }
 
 // buildtdg constructs the transaction dependency graph and determines the maximum reachable subgraph size.
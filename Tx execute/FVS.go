@@ -145,12 +145,15 @@ func calculateDegrees(cg [][]bool, verticesToCheck map[int]bool) (map[int]int, m
 	return degrees, outDegrees
 }
 
-// selectVertexToPrune selects the vertex with the maximum degree for pruning.
+// selectVertexToPrune selects the vertex with the maximum degree for pruning,
+// the lowest one of those with the same degrees so that the result doesn't
+// depend on the map order.
 func selectVertexToPrune(degrees map[int]int, outDegrees map[int]int) int {
 	var maxDegree = -1
 	var selectedVertex = -1
 	for v, degree := range degrees {
-		if degree > maxDegree || (degree == maxDegree && outDegrees[v] < outDegrees[selectedVertex]) {
+		if degree > maxDegree || (degree == maxDegree && (outDegrees[v] < outDegrees[selectedVertex] ||
+			outDegrees[v] == outDegrees[selectedVertex] && v < selectedVertex)) {
 			maxDegree = degree
 			selectedVertex = v
 		}
@@ -1,10 +1,6 @@
 package main
 
 import (
-	"encoding/csv"
-	"fmt"
-	"os"
-	"strconv"
 	"sync"
 	"time"
 )
@@ -191,55 +187,26 @@ func (dg *DependencyGraph) RemoveTransaction(txIndex int) {
 	dg.graph[txIndex][txIndex] = true
 }
 
-func occwsiExecuteTransaction(tx *Transaction, txs []Transaction, semaphore chan struct{}, sm *StateManager, dg *DependencyGraph, i int, fLine *finishLine) {
+// occwsiExecuteTransaction attempts transaction i and, once its writes are
+// committed, adds its dependencies on the transactions finished before it to
+// the dependency graph.
+func occwsiExecuteTransaction(block *Block, exec Executor, semaphore chan struct{}, dg *DependencyGraph, i int, fLine *finishLine) {
+	txs := block.Transactions
 
 	semaphore <- struct{}{}
+	defer func() { <-semaphore }()
 
-	snapshot := make(map[string]int)
-
-	//sm.lock.RLock()
-	for _, addr := range tx.ReadStateAddresses {
-		snapshot[addr] = sm.stateMap[addr].Version
-	}
-	for _, addr := range tx.WriteStateAddresses {
-		snapshot[addr] = sm.stateMap[addr].Version
-	}
-	//sm.lock.RUnlock()
-	/*for _, addr := range append(tx.ReadStateAddresses, tx.WriteStateAddresses...) {
-		_ = sm.stateMap[addr]
-	}*/
-	time.Sleep(time.Nanosecond * time.Duration(tx.ExecutionTime)) // Simulate transaction execution time
-	conflict := false
-	// Check if the version numbers have changed after execution
-	sm.lock.RLock()
-	for addr, version := range snapshot {
-		currentVersion := sm.stateMap[addr].Version
-		if currentVersion != version {
-			conflict = true
-			break
-		}
-	}
-	sm.lock.RUnlock()
-	// If version numbers haven't changed, the transaction executed successfully
-	if !conflict {
-		sm.lock.Lock()
-		for _, addr := range tx.WriteStateAddresses {
-			sm.stateMap[addr].Value++
-			sm.stateMap[addr].Version++
-		}
-		sm.lock.Unlock()
-		fLine.lock.Lock()
-		fLine.fs[i] = true
-		ff := make([]bool, len(txs))
-		copy(ff, fLine.fs)
-		fLine.lock.Unlock()
-		dg.UpdateGraph(tx, i, ff, txs)
-		//fmt.Printf("Transaction %s executed successfully.\n", tx.TransactionHash)
-		<-semaphore
-	} else {
-		<-semaphore
-		//fmt.Printf("Transaction %s aborted due to conflict.\n", tx.TransactionHash)
+	if !exec.Attempt(block, i) {
+		//fmt.Printf("Transaction %s aborted due to conflict.\n", txs[i].TransactionHash)
+		return
 	}
+	fLine.lock.Lock()
+	fLine.fs[i] = true
+	ff := make([]bool, len(txs))
+	copy(ff, fLine.fs)
+	fLine.lock.Unlock()
+	dg.UpdateGraph(&txs[i], i, ff, txs)
+	//fmt.Printf("Transaction %s executed successfully.\n", txs[i].TransactionHash)
 }
 
 type finishLine struct {
@@ -247,96 +214,85 @@ type finishLine struct {
 	lock sync.RWMutex
 }
 
-func occWsi(blocks []Block, stateManager *StateManager, class string) {
-	// Create output file
-	outputFilePath := strconv.Itoa(thread) + class + "_wsi_execution_times.csv"
-	outputFile, err := os.Create(outputFilePath)
-	if err != nil {
-		fmt.Printf("Error creating output file: %v\n", err)
-		return
-	}
-	defer outputFile.Close()
-	writer := csv.NewWriter(outputFile)
-	defer writer.Flush()
-	writer.Write([]string{"BlockNumber", "ExecutionTime(ms)", "ValidationTime(ms)"})
+// occwsiScheduler executes the transactions of a block optimistically,
+// re-executing the aborted ones in rounds until all are committed while
+// recording the dependencies between them, then executes the block once more
+// in the order of the resulting dependency graph for validation.
+type occwsiScheduler struct{}
 
-	// Record total execution time
-	totalExecTime := time.Duration(0)
-	totalValiTime := time.Duration(0)
-
-	// Sequentially execute each block, but execute transactions within a block in parallel
-	for _, block := range blocks {
-		println("Packaging phase started:", block.BlockNumber)
-		startTime := time.Now()
-		semaphore := make(chan struct{}, thread) // Use global variable thread as parallelism degree
-		tdg := NewDependencyGraph(len(block.Transactions))
-		fLine := &finishLine{fs: make([]bool, len(block.Transactions))}
-		var toExecute []int // Store the indices of transactions to be executed or re-executed
+// ExecuteBlock implements Scheduler.
+func (occwsiScheduler) ExecuteBlock(block *Block, exec Executor, workers int) (Result, error) {
+	if err := exec.BeginBlock(block); err != nil {
+		return Result{}, err
+	}
+	startTime := time.Now()
+	semaphore := make(chan struct{}, workers)
+	tdg := NewDependencyGraph(len(block.Transactions))
+	fLine := &finishLine{fs: make([]bool, len(block.Transactions))}
+	var toExecute []int // Store the indices of transactions to be executed or re-executed
 
-		// Initially mark all transactions as needing execution
-		for i := range block.Transactions {
-			toExecute = append(toExecute, i)
+	// Initially mark all transactions as needing execution
+	for i := range block.Transactions {
+		toExecute = append(toExecute, i)
+	}
+	executions := 0
+	// Loop until all transactions are successfully executed
+	for len(toExecute) > 0 {
+		executions += len(toExecute)
+		wg := sync.WaitGroup{}
+		for _, i := range toExecute {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				occwsiExecuteTransaction(block, exec, semaphore, tdg, i, fLine)
+			}(i)
 		}
-		round := 0
-		// Loop until all transactions are successfully executed
-		for len(toExecute) > 0 {
-			wg := sync.WaitGroup{}
-			for _, i := range toExecute {
-				wg.Add(1)
-				go func(i int) {
-					defer wg.Done()
-					occwsiExecuteTransaction(&block.Transactions[i], block.Transactions, semaphore, stateManager, tdg, i, fLine)
-				}(i)
-			}
 
-			wg.Wait() // Wait for all attempted transactions in this round to complete
-			round++
-			toExecute = toExecute[:0] // Clear to collect indices of failed transactions again
-			for i, done := range fLine.fs {
-				if !done {
-					toExecute = append(toExecute, i)
-				}
+		wg.Wait()                 // Wait for all attempted transactions in this round to complete
+		toExecute = toExecute[:0] // Clear to collect indices of failed transactions again
+		for i, done := range fLine.fs {
+			if !done {
+				toExecute = append(toExecute, i)
 			}
 		}
-		println(round)
-		execTime := time.Since(startTime)
-		totalExecTime += execTime
-		//tdg.RemoveRedundantEdges()
-		println(tdg.IsDAG())
-		maxSize := tdg.CalculateMaxReachableSubgraphSize()
-		println("max:", maxSize, "total:", len(block.Transactions))
-		println("Validation phase started:", block.BlockNumber)
-		// Validation phase: execute transactions in parallel based on the dependency graph
-		startTime = time.Now()
-		for {
-			executable := findExecutableTransactions(tdg.graph)
-			if len(executable) <= 1 {
-				break // No more executable transactions, exit loop
-			}
-			var wg sync.WaitGroup
-			for _, txIndex := range executable {
-				wg.Add(1)
-				go func(index int) {
-					defer wg.Done()
-					semaphore <- struct{}{} // Acquire semaphore
-					// Execute transaction logic...
-					for _, addr := range append(block.Transactions[index].ReadStateAddresses, block.Transactions[index].WriteStateAddresses...) {
-						_ = stateManager.stateMap[addr]
-					}
-					time.Sleep(time.Nanosecond * time.Duration(block.Transactions[index].ExecutionTime)) // Simulate transaction execution time
-					tdg.RemoveTransaction(index)                                                         // Remove completed transaction from the dependency graph
-					<-semaphore
-				}(txIndex)
-			}
-			wg.Wait() // Wait for all executable transactions in this round to complete
+	}
+	execTime := time.Since(startTime)
+	//tdg.RemoveRedundantEdges()
+	// Validation phase: execute transactions in parallel based on the dependency graph
+	if err := exec.BeginBlock(block); err != nil {
+		return Result{}, err
+	}
+	startTime = time.Now()
+	for {
+		executable := findExecutableTransactions(tdg.graph)
+		if len(executable) == 0 {
+			break // No more executable transactions, exit loop
+		}
+		var wg sync.WaitGroup
+		for _, txIndex := range executable {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				semaphore <- struct{}{} // Acquire semaphore
+				exec.Apply(block, index)
+				tdg.RemoveTransaction(index) // Remove completed transaction from the dependency graph
+				<-semaphore
+			}(txIndex)
 		}
-		valiTime := time.Since(startTime)
-		totalValiTime += valiTime
-		writer.Write([]string{block.BlockNumber, fmt.Sprintf("%d", execTime.Milliseconds()), fmt.Sprintf("%d", valiTime.Milliseconds())})
+		wg.Wait() // Wait for all executable transactions in this round to complete
 	}
-	// Record total execution time
-	writer.Write([]string{"Total Execution Time", fmt.Sprintf("%d", totalExecTime.Milliseconds())})
-	writer.Write([]string{"Total Validation Time", fmt.Sprintf("%d", totalValiTime.Milliseconds())})
+	return Result{ExecTime: execTime, ValidationTime: time.Since(startTime), Executions: executions, Aborts: executions - len(block.Transactions)}, nil
+}
+
+// SimulateBlock implements VirtualScheduler.
+func (occwsiScheduler) SimulateBlock(block *Block, workers int) Result {
+	txs := block.Transactions
+	tdg := NewDependencyGraph(len(txs))
+	execTime, busy, executions := simulateOCC(txs, workers, func(i int, finished []bool) {
+		tdg.UpdateGraph(&txs[i], i, finished, txs)
+	})
+	valiTime, valiBusy := simulateGraph(tdg, txs, 0, workers)
+	return Result{ExecTime: execTime, ValidationTime: valiTime, Executions: executions, Aborts: executions - len(txs), Busy: busy + valiBusy}
 }
 
 // ContainsFalse checks if there are any false elements in a bool slice
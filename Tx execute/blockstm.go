@@ -0,0 +1,599 @@
+package main
+
+import (
+	"container/heap"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// blockstmScheduler executes the transactions of a block with Block-STM
+// (Gelashvili et al., "Block-STM: Scaling Blockchain Execution by Turning
+// Ordering Curse to a Performance Blessing"). The workers take execution and
+// validation tasks from a collaborative scheduler in the preset order of the
+// block. Executions read the writes of lower transactions from a multi-version
+// memory, validations re-read them and abort the incarnation if any changed.
+// The writes of an aborted incarnation stay in the memory as estimates, and a
+// transaction reading one waits for the writer to be re-executed.
+//
+// Transactions are executed on their captured read/write sets, so it runs on
+// the simulated executor only: every execution takes the recorded execution
+// time, and the state items of the StateManager are updated once the block is
+// done.
+type blockstmScheduler struct{}
+
+// ExecuteBlock implements Scheduler. There is no separate validation phase,
+// the validation time is zero.
+func (blockstmScheduler) ExecuteBlock(block *Block, exec Executor, workers int) (Result, error) {
+	sim, ok := exec.(*simExecutor)
+	if !ok {
+		return Result{}, errUnsupportedExecutor
+	}
+	if err := exec.BeginBlock(block); err != nil {
+		return Result{}, err
+	}
+	startTime := time.Now()
+	s := newBlockSTM(block.Transactions, sim.sm)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.run()
+		}()
+	}
+	wg.Wait()
+	s.commit()
+	execTime := time.Since(startTime)
+	return Result{ExecTime: execTime, Executions: int(s.executions), Aborts: int(s.aborts), Suspensions: int(s.suspensions)}, nil
+}
+
+// SimulateBlock implements VirtualScheduler. The workers run the same
+// collaborative scheduler and multi-version memory in virtual time: an
+// execution reads when it starts and writes when it ends, validations are
+// instant, and the idle workers ask for a task whenever an execution ends.
+func (blockstmScheduler) SimulateBlock(block *Block, workers int) Result {
+	s := newBlockSTM(block.Transactions, nil)
+	var (
+		now     time.Duration
+		busy    time.Duration
+		running vtQueue
+		seq     int
+		reads   = make([][]readDescriptor, workers)
+		version = make([]stmVersion, workers)
+		idle    = make([]bool, workers)
+	)
+	// perform runs the task on worker w until it starts an execution or runs
+	// out of tasks
+	perform := func(w int, task *stmTask) {
+		for task != nil {
+			if task.validation {
+				task = s.needsReexecution(task.version)
+				continue
+			}
+			rs, blocking := s.readSet(task.version.txIdx)
+			if blocking >= 0 {
+				if !s.addDependency(task.version.txIdx, blocking) {
+					continue // The blocking transaction was re-executed meanwhile
+				}
+				atomic.AddInt64(&s.suspensions, 1)
+				task = nil
+				continue
+			}
+			d := time.Duration(s.txs[task.version.txIdx].ExecutionTime)
+			busy += d
+			reads[w], version[w], idle[w] = rs, task.version, false
+			heap.Push(&running, vtEvent{end: now + d, seq: seq, i: w})
+			seq++
+			return
+		}
+		idle[w] = true
+	}
+	for w := range idle {
+		idle[w] = true
+	}
+	for !s.done() {
+		// The idle workers take tasks until the indices stop moving, there
+		// are no more tasks at this time then
+		before := s.position()
+		for w := range idle {
+			if idle[w] {
+				if task := s.nextTask(); task != nil {
+					perform(w, task)
+				}
+			}
+		}
+		if s.position() != before || s.done() {
+			continue
+		}
+		if len(running) == 0 {
+			panic("Block-STM simulation stalled")
+		}
+		now = running[0].end
+		for len(running) > 0 && running[0].end == now {
+			w := heap.Pop(&running).(vtEvent).i
+			wroteNewLocation := s.record(version[w], reads[w])
+			perform(w, s.finishExecution(version[w].txIdx, version[w].incarnation, wroteNewLocation))
+		}
+	}
+	return Result{ExecTime: now, Executions: int(s.executions), Aborts: int(s.aborts), Suspensions: int(s.suspensions), Busy: busy}
+}
+
+// Status of a transaction in the collaborative scheduler.
+const (
+	readyToExecute = iota
+	executing
+	executed
+	aborting
+)
+
+// stmVersion identifies an incarnation of a transaction.
+type stmVersion struct {
+	txIdx       int
+	incarnation int
+}
+
+// stmTask is an execution or validation task for a version.
+type stmTask struct {
+	version    stmVersion
+	validation bool
+}
+
+// stmStatus is the incarnation and status of a transaction.
+type stmStatus struct {
+	incarnation int
+	status      int
+	lock        sync.Mutex
+}
+
+// mvEntry is the write of a transaction to a state item in the multi-version
+// memory. The value is the version that wrote it, which is all a transaction
+// observes of a state item.
+type mvEntry struct {
+	incarnation int
+	estimate    bool // Written by an aborted incarnation
+}
+
+// mvItem holds the writes to a state item by transaction index.
+type mvItem struct {
+	writes map[int]*mvEntry
+	lock   sync.RWMutex
+}
+
+// readResult is the outcome of a read from the multi-version memory: the
+// version read, or the storage if no lower transaction wrote the item, or the
+// transaction whose estimate blocked the read.
+type readResult struct {
+	version  stmVersion
+	storage  bool
+	blocking int // Index of the blocking transaction, -1 if none
+}
+
+// readDescriptor records a read of a state item for validation.
+type readDescriptor struct {
+	addr string
+	res  readResult
+}
+
+// blockSTM holds the collaborative scheduler and the multi-version memory of
+// a block.
+type blockSTM struct {
+	txs []Transaction
+	sm  *StateManager
+	n   int64
+
+	// Collaborative scheduler
+	executionIdx   int64
+	validationIdx  int64
+	decreaseCnt    int64
+	numActiveTasks int64
+	doneMarker     int32
+	status         []stmStatus
+	dependencies   [][]int
+	depLocks       []sync.Mutex
+
+	// Multi-version memory
+	items          map[string]*mvItem
+	itemsLock      sync.Mutex
+	lastWritten    [][]string
+	lastReads      [][]readDescriptor
+	lastAccessLock []sync.RWMutex
+
+	executions  int64 // Executions started, including those stopped at an estimate
+	aborts      int64 // Incarnations aborted by a validation
+	suspensions int64 // Executions stopped at an estimate
+}
+
+func newBlockSTM(txs []Transaction, sm *StateManager) *blockSTM {
+	n := len(txs)
+	return &blockSTM{
+		txs:            txs,
+		sm:             sm,
+		n:              int64(n),
+		status:         make([]stmStatus, n),
+		dependencies:   make([][]int, n),
+		depLocks:       make([]sync.Mutex, n),
+		items:          make(map[string]*mvItem),
+		lastWritten:    make([][]string, n),
+		lastReads:      make([][]readDescriptor, n),
+		lastAccessLock: make([]sync.RWMutex, n),
+	}
+}
+
+// run is the loop of a worker, taking tasks until the block is done.
+func (s *blockSTM) run() {
+	var task *stmTask
+	for !s.done() {
+		if task != nil {
+			if task.validation {
+				task = s.needsReexecution(task.version)
+			} else {
+				task = s.tryExecute(task.version)
+			}
+		}
+		if task == nil {
+			if task = s.nextTask(); task == nil {
+				runtime.Gosched() // Let the workers holding tasks run
+			}
+		}
+	}
+}
+
+// commit applies the writes of the block to the state items, in block order.
+func (s *blockSTM) commit() {
+	s.sm.lock.Lock()
+	defer s.sm.lock.Unlock()
+	for i := range s.txs {
+		for _, addr := range s.txs[i].WriteStateAddresses {
+			s.sm.stateMap[addr].Value++
+			s.sm.stateMap[addr].Version++
+		}
+	}
+}
+
+// tryExecute executes a version and returns the validation task that may
+// follow it.
+func (s *blockSTM) tryExecute(version stmVersion) *stmTask {
+	for {
+		reads, blocking := s.execute(version.txIdx)
+		if blocking >= 0 {
+			if !s.addDependency(version.txIdx, blocking) {
+				continue // The blocking transaction was re-executed meanwhile
+			}
+			atomic.AddInt64(&s.suspensions, 1)
+			return nil
+		}
+		wroteNewLocation := s.record(version, reads)
+		return s.finishExecution(version.txIdx, version.incarnation, wroteNewLocation)
+	}
+}
+
+// execute reads the read set of a transaction from the multi-version memory
+// and simulates its execution. It returns the reads, or the index of the
+// transaction whose estimate was read.
+func (s *blockSTM) execute(txIdx int) ([]readDescriptor, int) {
+	reads, blocking := s.readSet(txIdx)
+	if blocking < 0 {
+		time.Sleep(time.Nanosecond * time.Duration(s.txs[txIdx].ExecutionTime)) // Simulate transaction execution time
+	}
+	return reads, blocking
+}
+
+// readSet starts an execution of a transaction by reading its read set from
+// the multi-version memory, and the storage if a StateManager is set.
+func (s *blockSTM) readSet(txIdx int) ([]readDescriptor, int) {
+	atomic.AddInt64(&s.executions, 1)
+	tx := &s.txs[txIdx]
+	reads := make([]readDescriptor, 0, len(tx.ReadStateAddresses))
+	for _, addr := range tx.ReadStateAddresses {
+		res := s.read(addr, txIdx)
+		if res.blocking >= 0 {
+			return nil, res.blocking
+		}
+		if res.storage && s.sm != nil {
+			s.sm.lock.RLock()
+			_ = s.sm.stateMap[addr].Value
+			s.sm.lock.RUnlock()
+		}
+		reads = append(reads, readDescriptor{addr: addr, res: res})
+	}
+	return reads, -1
+}
+
+// needsReexecution validates a version and returns the re-execution task that
+// may follow its abort.
+func (s *blockSTM) needsReexecution(version stmVersion) *stmTask {
+	valid := s.validateReadSet(version.txIdx)
+	aborted := !valid && s.tryValidationAbort(version.txIdx, version.incarnation)
+	if aborted {
+		atomic.AddInt64(&s.aborts, 1)
+		s.convertWritesToEstimates(version.txIdx)
+	}
+	return s.finishValidation(version.txIdx, aborted)
+}
+
+// item returns the multi-version memory of a state item.
+func (s *blockSTM) item(addr string) *mvItem {
+	s.itemsLock.Lock()
+	defer s.itemsLock.Unlock()
+	it, ok := s.items[addr]
+	if !ok {
+		it = &mvItem{writes: make(map[int]*mvEntry)}
+		s.items[addr] = it
+	}
+	return it
+}
+
+// read returns the write of the highest transaction below txIdx to a state
+// item.
+func (s *blockSTM) read(addr string, txIdx int) readResult {
+	it := s.item(addr)
+	it.lock.RLock()
+	defer it.lock.RUnlock()
+
+	best := -1
+	for idx := range it.writes {
+		if idx < txIdx && idx > best {
+			best = idx
+		}
+	}
+	if best < 0 {
+		return readResult{storage: true, blocking: -1}
+	}
+	entry := it.writes[best]
+	if entry.estimate {
+		return readResult{blocking: best}
+	}
+	return readResult{version: stmVersion{best, entry.incarnation}, blocking: -1}
+}
+
+// record stores the reads and writes of an incarnation, removing the writes of
+// the previous incarnation to state items not written anymore. It reports
+// whether a state item was written that the previous incarnation didn't.
+func (s *blockSTM) record(version stmVersion, reads []readDescriptor) bool {
+	written := s.txs[version.txIdx].WriteStateAddresses
+	for _, addr := range written {
+		it := s.item(addr)
+		it.lock.Lock()
+		it.writes[version.txIdx] = &mvEntry{incarnation: version.incarnation}
+		it.lock.Unlock()
+	}
+	s.lastAccessLock[version.txIdx].Lock()
+	defer s.lastAccessLock[version.txIdx].Unlock()
+
+	current := make(map[string]bool, len(written))
+	for _, addr := range written {
+		current[addr] = true
+	}
+	previous := make(map[string]bool, len(s.lastWritten[version.txIdx]))
+	for _, addr := range s.lastWritten[version.txIdx] {
+		previous[addr] = true
+		if !current[addr] {
+			it := s.item(addr)
+			it.lock.Lock()
+			delete(it.writes, version.txIdx)
+			it.lock.Unlock()
+		}
+	}
+	wroteNewLocation := false
+	for addr := range current {
+		if !previous[addr] {
+			wroteNewLocation = true
+		}
+	}
+	s.lastWritten[version.txIdx] = written
+	s.lastReads[version.txIdx] = reads
+	return wroteNewLocation
+}
+
+// convertWritesToEstimates marks the writes of an aborted incarnation.
+func (s *blockSTM) convertWritesToEstimates(txIdx int) {
+	s.lastAccessLock[txIdx].RLock()
+	defer s.lastAccessLock[txIdx].RUnlock()
+	for _, addr := range s.lastWritten[txIdx] {
+		it := s.item(addr)
+		it.lock.Lock()
+		if entry, ok := it.writes[txIdx]; ok {
+			entry.estimate = true
+		}
+		it.lock.Unlock()
+	}
+}
+
+// validateReadSet reports whether the reads of the last incarnation of a
+// transaction still return the same versions.
+func (s *blockSTM) validateReadSet(txIdx int) bool {
+	s.lastAccessLock[txIdx].RLock()
+	reads := s.lastReads[txIdx]
+	s.lastAccessLock[txIdx].RUnlock()
+
+	for _, r := range reads {
+		res := s.read(r.addr, txIdx)
+		if res.blocking >= 0 || res.storage != r.res.storage || res.version != r.res.version {
+			return false
+		}
+	}
+	return true
+}
+
+// decreaseIdx lowers an execution or validation index to target.
+func (s *blockSTM) decreaseIdx(idx *int64, target int) {
+	for {
+		cur := atomic.LoadInt64(idx)
+		if cur <= int64(target) || atomic.CompareAndSwapInt64(idx, cur, int64(target)) {
+			break
+		}
+	}
+	atomic.AddInt64(&s.decreaseCnt, 1)
+}
+
+// position returns the indices of the scheduler and how often they were
+// decreased.
+func (s *blockSTM) position() [3]int64 {
+	return [3]int64{atomic.LoadInt64(&s.executionIdx), atomic.LoadInt64(&s.validationIdx), atomic.LoadInt64(&s.decreaseCnt)}
+}
+
+func (s *blockSTM) done() bool {
+	return atomic.LoadInt32(&s.doneMarker) == 1
+}
+
+func (s *blockSTM) checkDone() {
+	observed := atomic.LoadInt64(&s.decreaseCnt)
+	if atomic.LoadInt64(&s.executionIdx) >= s.n && atomic.LoadInt64(&s.validationIdx) >= s.n &&
+		atomic.LoadInt64(&s.numActiveTasks) == 0 && observed == atomic.LoadInt64(&s.decreaseCnt) {
+		atomic.StoreInt32(&s.doneMarker, 1)
+	}
+}
+
+// tryIncarnate starts executing a transaction that is ready to execute. The
+// callers release their task if it isn't.
+func (s *blockSTM) tryIncarnate(txIdx int) *stmVersion {
+	if int64(txIdx) < s.n {
+		st := &s.status[txIdx]
+		st.lock.Lock()
+		if st.status == readyToExecute {
+			st.status = executing
+			version := &stmVersion{txIdx, st.incarnation}
+			st.lock.Unlock()
+			return version
+		}
+		st.lock.Unlock()
+	}
+	return nil
+}
+
+func (s *blockSTM) nextVersionToExecute() *stmVersion {
+	if atomic.LoadInt64(&s.executionIdx) >= s.n {
+		s.checkDone()
+		return nil
+	}
+	atomic.AddInt64(&s.numActiveTasks, 1)
+	idx := atomic.AddInt64(&s.executionIdx, 1) - 1
+	if version := s.tryIncarnate(int(idx)); version != nil {
+		return version
+	}
+	atomic.AddInt64(&s.numActiveTasks, -1)
+	return nil
+}
+
+func (s *blockSTM) nextVersionToValidate() *stmVersion {
+	if atomic.LoadInt64(&s.validationIdx) >= s.n {
+		s.checkDone()
+		return nil
+	}
+	atomic.AddInt64(&s.numActiveTasks, 1)
+	idx := atomic.AddInt64(&s.validationIdx, 1) - 1
+	if idx < s.n {
+		st := &s.status[idx]
+		st.lock.Lock()
+		if st.status == executed {
+			version := &stmVersion{int(idx), st.incarnation}
+			st.lock.Unlock()
+			return version
+		}
+		st.lock.Unlock()
+	}
+	atomic.AddInt64(&s.numActiveTasks, -1)
+	return nil
+}
+
+// nextTask prefers validating lower transactions over executing higher ones.
+func (s *blockSTM) nextTask() *stmTask {
+	if atomic.LoadInt64(&s.validationIdx) < atomic.LoadInt64(&s.executionIdx) {
+		if version := s.nextVersionToValidate(); version != nil {
+			return &stmTask{version: *version, validation: true}
+		}
+	} else if version := s.nextVersionToExecute(); version != nil {
+		return &stmTask{version: *version}
+	}
+	return nil
+}
+
+// addDependency suspends a transaction until the blocking one is executed. It
+// returns false if it already was.
+func (s *blockSTM) addDependency(txIdx, blocking int) bool {
+	s.depLocks[blocking].Lock()
+	defer s.depLocks[blocking].Unlock()
+
+	st := &s.status[blocking]
+	st.lock.Lock()
+	blockingExecuted := st.status == executed
+	st.lock.Unlock()
+	if blockingExecuted {
+		return false
+	}
+	st = &s.status[txIdx]
+	st.lock.Lock()
+	st.status = aborting
+	st.lock.Unlock()
+	s.dependencies[blocking] = append(s.dependencies[blocking], txIdx)
+	atomic.AddInt64(&s.numActiveTasks, -1)
+	return true
+}
+
+// setReadyStatus moves an aborting transaction to its next incarnation.
+func (s *blockSTM) setReadyStatus(txIdx int) {
+	st := &s.status[txIdx]
+	st.lock.Lock()
+	st.incarnation++
+	st.status = readyToExecute
+	st.lock.Unlock()
+}
+
+func (s *blockSTM) finishExecution(txIdx, incarnation int, wroteNewLocation bool) *stmTask {
+	st := &s.status[txIdx]
+	st.lock.Lock()
+	st.status = executed
+	st.lock.Unlock()
+
+	s.depLocks[txIdx].Lock()
+	deps := s.dependencies[txIdx]
+	s.dependencies[txIdx] = nil
+	s.depLocks[txIdx].Unlock()
+
+	if len(deps) > 0 {
+		minDep := deps[0]
+		for _, dep := range deps {
+			s.setReadyStatus(dep)
+			if dep < minDep {
+				minDep = dep
+			}
+		}
+		s.decreaseIdx(&s.executionIdx, minDep)
+	}
+	if atomic.LoadInt64(&s.validationIdx) > int64(txIdx) {
+		if wroteNewLocation {
+			s.decreaseIdx(&s.validationIdx, txIdx)
+		} else {
+			return &stmTask{version: stmVersion{txIdx, incarnation}, validation: true}
+		}
+	}
+	atomic.AddInt64(&s.numActiveTasks, -1)
+	return nil
+}
+
+func (s *blockSTM) tryValidationAbort(txIdx, incarnation int) bool {
+	st := &s.status[txIdx]
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if st.incarnation == incarnation && st.status == executed {
+		st.status = aborting
+		return true
+	}
+	return false
+}
+
+func (s *blockSTM) finishValidation(txIdx int, aborted bool) *stmTask {
+	if aborted {
+		s.setReadyStatus(txIdx)
+		s.decreaseIdx(&s.validationIdx, txIdx+1)
+		if atomic.LoadInt64(&s.executionIdx) > int64(txIdx) {
+			if version := s.tryIncarnate(txIdx); version != nil {
+				return &stmTask{version: *version}
+			}
+		}
+	}
+	atomic.AddInt64(&s.numActiveTasks, -1)
+	return nil
+}
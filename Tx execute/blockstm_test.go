@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// stmTestTxs returns a block in which transactions 1, 2 and 4 depend on the
+// ones before them, and transaction 3 on none.
+func stmTestTxs(execTime int64) []Transaction {
+	txs := []Transaction{
+		{WriteStateAddresses: []string{"a"}},
+		{ReadStateAddresses: []string{"a"}, WriteStateAddresses: []string{"b"}},
+		{ReadStateAddresses: []string{"b"}, WriteStateAddresses: []string{"a"}},
+		{ReadStateAddresses: []string{"c"}, WriteStateAddresses: []string{"d"}},
+		{ReadStateAddresses: []string{"a", "d"}, WriteStateAddresses: []string{"c"}},
+	}
+	for i := range txs {
+		txs[i].TransactionHash = fmt.Sprintf("0x%02x", i)
+		txs[i].ExecutionTime = execTime * int64(len(txs)-i)
+	}
+	return txs
+}
+
+// serialReads returns for every read of every transaction the index of the
+// transaction it reads from when executed in block order, -1 for the storage.
+func serialReads(txs []Transaction) [][]int {
+	last := make(map[string]int)
+	reads := make([][]int, len(txs))
+	for i, tx := range txs {
+		for _, addr := range tx.ReadStateAddresses {
+			writer, ok := last[addr]
+			if !ok {
+				writer = -1
+			}
+			reads[i] = append(reads[i], writer)
+		}
+		for _, addr := range tx.WriteStateAddresses {
+			last[addr] = i
+		}
+	}
+	return reads
+}
+
+// Tests that whatever the interleaving, every transaction ends up with the
+// reads of the serial execution, and the state with its writes.
+func TestBlockSTMDeterminism(t *testing.T) {
+	txs := stmTestTxs(1000)
+	want := serialReads(txs)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		for run := 0; run < 20; run++ {
+			sm := NewStateManager(txs)
+			s := newBlockSTM(txs, sm)
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.run()
+				}()
+			}
+			wg.Wait()
+			s.commit()
+
+			have := make([][]int, len(txs))
+			for i, reads := range s.lastReads {
+				for _, r := range reads {
+					if r.res.storage {
+						have[i] = append(have[i], -1)
+					} else {
+						have[i] = append(have[i], r.res.version.txIdx)
+					}
+				}
+				if s.status[i].status != executed {
+					t.Fatalf("workers %d, run %d: transaction %d not executed", workers, run, i)
+				}
+			}
+			if !reflect.DeepEqual(have, want) {
+				t.Fatalf("workers %d, run %d: reads mismatch: have %v, want %v", workers, run, have, want)
+			}
+			for addr, writes := range map[string]int{"a": 2, "b": 1, "c": 1, "d": 1} {
+				if v := sm.stateMap[addr]; v.Value != writes || v.Version != writes {
+					t.Fatalf("workers %d, run %d: item %s has value %d version %d, want %d", workers, run, addr, v.Value, v.Version, writes)
+				}
+			}
+			if min := s.n + s.aborts + s.suspensions; s.executions < min {
+				t.Fatalf("workers %d, run %d: %d executions, want at least %d", workers, run, s.executions, min)
+			}
+		}
+	}
+}
+
+// Tests the conflicts of the simulation: aborts and suspensions need
+// dependent transactions, and the same block always runs the same way.
+func TestBlockSTMSimulateConflicts(t *testing.T) {
+	independent := []Transaction{
+		{ReadStateAddresses: []string{"a"}, WriteStateAddresses: []string{"b"}, ExecutionTime: 3},
+		{ReadStateAddresses: []string{"c"}, WriteStateAddresses: []string{"d"}, ExecutionTime: 5},
+		{ReadStateAddresses: []string{"e"}, WriteStateAddresses: []string{"f"}, ExecutionTime: 2},
+	}
+	tests := []struct {
+		txs       []Transaction
+		workers   int
+		conflicts bool
+	}{
+		{txs: independent, workers: 1},
+		{txs: independent, workers: 3},
+		{txs: stmTestTxs(1), workers: 1},
+		{txs: stmTestTxs(1), workers: 2, conflicts: true},
+		{txs: stmTestTxs(1), workers: 5, conflicts: true},
+	}
+	for i, tt := range tests {
+		res := blockstmScheduler{}.SimulateBlock(&Block{Transactions: tt.txs}, tt.workers)
+		if again := (blockstmScheduler{}).SimulateBlock(&Block{Transactions: tt.txs}, tt.workers); again != res {
+			t.Errorf("test %d: simulation not deterministic: %+v, then %+v", i, res, again)
+		}
+		conflicts := res.Aborts+res.Suspensions > 0
+		if conflicts != tt.conflicts {
+			t.Errorf("test %d: conflicts mismatch: have %d aborts and %d suspensions, want conflicts %v", i, res.Aborts, res.Suspensions, tt.conflicts)
+		}
+		if !tt.conflicts && res.Executions != len(tt.txs) {
+			t.Errorf("test %d: executions mismatch: have %d, want %d", i, res.Executions, len(tt.txs))
+		}
+		if res.Executions < len(tt.txs)+res.Aborts+res.Suspensions {
+			t.Errorf("test %d: %d executions for %d aborts and %d suspensions", i, res.Executions, res.Aborts, res.Suspensions)
+		}
+	}
+	// Independent transactions on enough workers take as long as the longest
+	if res := (blockstmScheduler{}).SimulateBlock(&Block{Transactions: independent}, 3); res.ExecTime != 5 {
+		t.Errorf("makespan mismatch: have %v, want 5ns", res.ExecTime)
+	}
+}
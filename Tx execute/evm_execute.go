@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/hotcache"
+	"github.com/ethereum/go-ethereum/hotcache/witness"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// evmExecutor executes the transactions on the EVM, against the state of the
+// parent of their block as held by the witness the capture wrote for the block.
+//
+// Every execution runs through core.ApplyMessage in a state.StateDB of its own,
+// opened on the parent state and overlaid with the writes committed so far, so
+// that re-executions read the state again. The read and write sets of every
+// execution are recorded by the state, and an attempt only commits if none of
+// the items it accessed were committed by another transaction since it started.
+// The committed read/write sets and execution times replace the captured ones
+// of the transactions, for the dependency graphs built by the schedulers.
+// Callers hand in copies of the blocks they want to keep unchanged.
+//
+// Transactions execute without nonce checks, as the transaction files may hold
+// a part of a block only. Any other failure of an execution, on the EVM or on
+// the state, voids the block and is returned by Err. The fees paid to the
+// coinbase are committed as balance increments and never conflict, so
+// transactions reading the coinbase balance themselves see it as it was when
+// they started.
+type evmExecutor struct {
+	config    *params.ChainConfig
+	witnesses *witnessFile
+	block     *evmBlock
+
+	lock sync.Mutex
+	err  error // First execution failure
+}
+
+func newEVMExecutor(path string, config *params.ChainConfig) (*evmExecutor, error) {
+	witnesses, err := openWitnessFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &evmExecutor{config: config, witnesses: witnesses}, nil
+}
+
+// loadChainConfig returns the chain configuration of mainnet if chain is
+// "mainnet", otherwise the one held by the genesis JSON file chain, such as the
+// genesis.json written by geth capture synthetic.
+func loadChainConfig(chain string) (*params.ChainConfig, error) {
+	if chain == "mainnet" {
+		return params.MainnetChainConfig, nil
+	}
+	file, err := os.Open(chain)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var genesis core.Genesis
+	if err := json.NewDecoder(file).Decode(&genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %v", chain, err)
+	}
+	if genesis.Config == nil {
+		return nil, fmt.Errorf("genesis file %s holds no chain configuration", chain)
+	}
+	return genesis.Config, nil
+}
+
+// Close closes the witness file.
+func (e *evmExecutor) Close() error {
+	return e.witnesses.close()
+}
+
+// BeginBlock implements Executor.
+func (e *evmExecutor) BeginBlock(block *Block) error {
+	number, err := strconv.ParseUint(block.BlockNumber, 10, 64)
+	if err != nil {
+		return err
+	}
+	if e.block == nil || e.block.number != number {
+		w, err := e.witnesses.get(number)
+		if err != nil {
+			return err
+		}
+		if e.block, err = newEVMBlock(e.config, w, block); err != nil {
+			return err
+		}
+	}
+	e.block.reset()
+	return nil
+}
+
+// Attempt implements Executor. A failed execution is reported as committed so
+// that the schedulers wind down, its block is void.
+func (e *evmExecutor) Attempt(block *Block, i int) bool {
+	res := e.block.run(i)
+	if res.err != nil {
+		e.fail(res.err)
+		return true
+	}
+	e.block.lock.Lock()
+	valid := e.block.valid(res)
+	if valid {
+		e.block.commit(res)
+	}
+	e.block.lock.Unlock()
+
+	if valid {
+		e.block.record(&block.Transactions[i], res)
+	}
+	return valid
+}
+
+// Apply implements Executor.
+func (e *evmExecutor) Apply(block *Block, i int) {
+	res := e.block.run(i)
+	if res.err != nil {
+		e.fail(res.err)
+		return
+	}
+	e.block.lock.Lock()
+	e.block.commit(res)
+	e.block.lock.Unlock()
+
+	e.block.record(&block.Transactions[i], res)
+}
+
+// Err implements Executor.
+func (e *evmExecutor) Err() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.err
+}
+
+// fail keeps err if it is the first execution failure.
+func (e *evmExecutor) fail(err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// evmTx is a transaction of the block being executed.
+type evmTx struct {
+	tx    *types.Transaction
+	index int // Position in the block
+	msg   types.Message
+}
+
+// evmAccount holds the committed account fields of an address.
+type evmAccount struct {
+	exists  bool
+	reset   bool // Created or destroyed, the storage of the parent state is gone
+	balance *big.Int
+	nonce   uint64
+	code    []byte
+}
+
+// evmResult is the outcome of an execution.
+type evmResult struct {
+	start    uint64 // Number of commits visible to the execution
+	view     *state.StateDB
+	set      *hotcache.TxAccessSet
+	coinbase *big.Int // Coinbase balance the execution started from
+	elapsed  time.Duration
+	err      error
+}
+
+// evmBlock is the parent state of a block together with the writes committed
+// on top of it.
+type evmBlock struct {
+	number   uint64
+	config   *params.ChainConfig
+	header   *types.Header
+	root     common.Hash
+	db       state.Database
+	blockCtx vm.BlockContext
+	eip158   bool
+	txs      []*evmTx // In the order of the scheduled transactions
+
+	lock     sync.RWMutex
+	seq      uint64                       // Number of commits
+	versions map[hotcache.StateKey]uint64 // Commit that last wrote an item
+	accounts map[common.Address]*evmAccount
+	slots    map[common.Address]map[common.Hash]common.Hash
+}
+
+func newEVMBlock(config *params.ChainConfig, w *witness.Witness, block *Block) (*evmBlock, error) {
+	chain, err := w.ChainContext(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	header := w.Block.Header()
+	b := &evmBlock{
+		number:   w.Block.NumberU64(),
+		config:   config,
+		header:   header,
+		root:     w.Parent().Root,
+		db:       w.StateDatabase(),
+		blockCtx: core.NewEVMBlockContext(header, chain, &header.Coinbase),
+		eip158:   config.IsEIP158(header.Number),
+	}
+	positions := make(map[common.Hash]int)
+	for i, tx := range w.Block.Transactions() {
+		positions[tx.Hash()] = i
+	}
+	signer := types.MakeSigner(config, header.Number)
+	for _, t := range block.Transactions {
+		hash := common.HexToHash(t.TransactionHash)
+		index, ok := positions[hash]
+		if !ok {
+			return nil, fmt.Errorf("transaction %s not in the witness of block %d", t.TransactionHash, b.number)
+		}
+		tx := w.Block.Transactions()[index]
+		msg, err := tx.AsMessage(signer, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %s: %w", t.TransactionHash, err)
+		}
+		msg = types.NewMessage(msg.From(), msg.To(), msg.Nonce(), msg.Value(), msg.Gas(), msg.GasPrice(), msg.GasFeeCap(), msg.GasTipCap(), msg.Data(), msg.AccessList(), true)
+		b.txs = append(b.txs, &evmTx{tx: tx, index: index, msg: msg})
+	}
+	return b, nil
+}
+
+// reset drops all committed writes.
+func (b *evmBlock) reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.seq = 0
+	b.versions = make(map[hotcache.StateKey]uint64)
+	b.accounts = make(map[common.Address]*evmAccount)
+	b.slots = make(map[common.Address]map[common.Hash]common.Hash)
+}
+
+// run executes transaction i on the committed state.
+func (b *evmBlock) run(i int) *evmResult {
+	var (
+		etx      = b.txs[i]
+		sink     = hotcache.NewMemorySink()
+		recorder = &hotcache.RWRecorder{Sink: sink}
+	)
+	view, err := state.New(b.root, b.db, nil, recorder)
+	if err != nil {
+		return &evmResult{err: fmt.Errorf("transaction %d of block %d: %w", etx.index, b.number, err)}
+	}
+	b.lock.RLock()
+	res := &evmResult{start: b.seq, view: view}
+	b.overlay(view)
+	b.lock.RUnlock()
+	res.coinbase = view.GetBalance(b.header.Coinbase)
+
+	view.Prepare(etx.tx.Hash(), etx.index)
+	recorder.BeginTx(b.number, etx.index, etx.tx)
+	start := time.Now()
+	evm := vm.NewEVM(b.blockCtx, core.NewEVMTxContext(etx.msg), view, b.config, vm.Config{})
+	result, err := core.ApplyMessage(evm, etx.msg, new(core.GasPool).AddGas(b.header.GasLimit))
+	if err == nil {
+		view.Finalise(b.eip158)
+		err = view.Error()
+	}
+	res.elapsed = time.Since(start)
+
+	var receipt *types.Receipt
+	if result != nil {
+		receipt = &types.Receipt{GasUsed: result.UsedGas, Status: types.ReceiptStatusSuccessful}
+		if result.Failed() {
+			receipt.Status = types.ReceiptStatusFailed
+		}
+	}
+	recorder.EndTx(receipt)
+	res.set = sink.Sets()[0]
+	if err != nil {
+		res.err = fmt.Errorf("transaction %d of block %d: %w", etx.index, b.number, err)
+	}
+	return res
+}
+
+// overlay applies the committed writes to a state opened on the parent state.
+func (b *evmBlock) overlay(view *state.StateDB) {
+	view.DisableRecord()
+	defer view.EnableRecord()
+
+	// Destroyed accounts have to be gone before they can be created again
+	for addr, acc := range b.accounts {
+		if acc.reset && view.Exist(addr) {
+			view.Suicide(addr)
+		}
+	}
+	view.Finalise(b.eip158)
+	for addr, acc := range b.accounts {
+		if !acc.exists {
+			continue
+		}
+		if acc.reset {
+			view.CreateAccount(addr)
+		}
+		view.SetBalance(addr, acc.balance)
+		view.SetNonce(addr, acc.nonce)
+		view.SetCode(addr, acc.code)
+	}
+	for addr, slots := range b.slots {
+		for key, value := range slots {
+			view.SetState(addr, key, value)
+		}
+	}
+	view.Finalise(b.eip158)
+}
+
+// isFee reports whether key is the coinbase balance.
+func (b *evmBlock) isFee(key hotcache.StateKey) bool {
+	return key.Address == b.header.Coinbase && key.Kind == hotcache.AccessBalance
+}
+
+// valid reports whether none of the items accessed by an execution were
+// written by commits it didn't see. Storage reads also depend on the account
+// not being created or destroyed meanwhile.
+func (b *evmBlock) valid(res *evmResult) bool {
+	for _, keys := range [][]hotcache.StateKey{res.set.Reads, res.set.Writes} {
+		for _, key := range keys {
+			if b.isFee(key) {
+				continue
+			}
+			if b.versions[key] > res.start {
+				return false
+			}
+			if key.Kind == hotcache.AccessStorage && b.versions[existenceKey(key.Address)] > res.start {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// commit makes the writes of a successful execution visible to the executions
+// started after it.
+func (b *evmBlock) commit(res *evmResult) {
+	b.seq++
+	view := res.view
+	view.DisableRecord()
+
+	// Account fields first, creating or destroying an account drops its
+	// committed storage
+	created := make(map[common.Address]bool)
+	for _, key := range res.set.Writes {
+		if key.Kind != hotcache.AccessStorage {
+			created[key.Address] = created[key.Address] || key.Kind == hotcache.AccessExistence
+		}
+	}
+	for addr, create := range created {
+		acc := &evmAccount{
+			exists:  view.Exist(addr),
+			balance: new(big.Int).Set(view.GetBalance(addr)),
+			nonce:   view.GetNonce(addr),
+			code:    view.GetCode(addr),
+		}
+		prev := b.accounts[addr]
+		if addr == b.header.Coinbase {
+			// Fees add to the commits the execution didn't see
+			fees := new(big.Int).Sub(acc.balance, res.coinbase)
+			if prev != nil {
+				acc.balance.Add(prev.balance, fees)
+			} else {
+				acc.balance.Add(b.baseBalance(addr), fees)
+			}
+		}
+		if create || !acc.exists {
+			acc.reset = true
+			delete(b.slots, addr)
+			b.versions[existenceKey(addr)] = b.seq
+		} else if prev != nil {
+			acc.reset = prev.reset
+		}
+		b.accounts[addr] = acc
+	}
+	for _, key := range res.set.Writes {
+		if !b.isFee(key) {
+			b.versions[key] = b.seq
+		}
+		if key.Kind != hotcache.AccessStorage || !view.Exist(key.Address) {
+			continue
+		}
+		slots := b.slots[key.Address]
+		if slots == nil {
+			slots = make(map[common.Hash]common.Hash)
+			b.slots[key.Address] = slots
+		}
+		slots[key.Slot] = view.GetState(key.Address, key.Slot)
+	}
+}
+
+// baseBalance returns the balance of addr in the parent state.
+func (b *evmBlock) baseBalance(addr common.Address) *big.Int {
+	base, err := state.New(b.root, b.db, nil, nil)
+	if err != nil {
+		return new(big.Int)
+	}
+	return base.GetBalance(addr)
+}
+
+// record replaces the read/write sets and execution time of a transaction by
+// those of its committed execution.
+func (b *evmBlock) record(tx *Transaction, res *evmResult) {
+	tx.ReadStateAddresses = b.keyStrings(res.set.Reads)
+	tx.WriteStateAddresses = b.keyStrings(res.set.Writes)
+	tx.ExecutionTime = res.elapsed.Nanoseconds()
+}
+
+func (b *evmBlock) keyStrings(keys []hotcache.StateKey) []string {
+	strs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !b.isFee(key) {
+			strs = append(strs, key.String())
+		}
+	}
+	return strs
+}
+
+func existenceKey(addr common.Address) hotcache.StateKey {
+	return hotcache.StateKey{Address: addr, Kind: hotcache.AccessExistence}
+}
+
+// witnessFile serves the witnesses of a witness file by block number. Blocks
+// are expected in ascending order, asking for an earlier block than the last
+// one reads the file again from its start.
+type witnessFile struct {
+	path   string
+	reader *witness.Reader
+	last   *witness.Witness
+}
+
+func openWitnessFile(path string) (*witnessFile, error) {
+	reader, err := witness.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return &witnessFile{path: path, reader: reader}, nil
+}
+
+func (f *witnessFile) get(number uint64) (*witness.Witness, error) {
+	if f.last != nil && f.last.Block.NumberU64() > number {
+		f.reader.Close()
+		reader, err := witness.OpenReader(f.path)
+		if err != nil {
+			return nil, err
+		}
+		f.reader, f.last = reader, nil
+	}
+	for f.last == nil || f.last.Block.NumberU64() < number {
+		w, err := f.reader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no witness of block %d in %s", number, f.path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.last = w
+	}
+	if f.last.Block.NumberU64() != number {
+		return nil, fmt.Errorf("no witness of block %d in %s", number, f.path)
+	}
+	return f.last, nil
+}
+
+func (f *witnessFile) close() error {
+	return f.reader.Close()
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/hotcache"
+	"github.com/ethereum/go-ethereum/hotcache/witness"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	testCounter  = common.HexToAddress("0xc0de") // slot0++
+	testCoinbase = common.HexToAddress("0xc01b")
+)
+
+// testEVMBlock holds a recorded block of the tests and its state after
+// executing the transactions serially, without the block reward.
+type testEVMBlock struct {
+	config   *params.ChainConfig
+	path     string // Witness file
+	witness  *witness.Witness
+	block    Block
+	accounts []common.Address
+	post     *state.StateDB
+}
+
+// newTestEVMBlock generates a block of eight accounts, where
+//
+//	tx 0: account 0 sends to account 1
+//	tx 1: account 1 sends to account 2, conflicting with tx 0
+//	tx 2: account 3 sends to account 4
+//	tx 3: account 0 sends to account 5, conflicting with tx 0
+//	tx 4: account 6 calls the counter
+//	tx 5: account 7 calls the counter, conflicting with tx 4
+//
+// and all of them pay a tip to the coinbase, which exists already. The state
+// changes of the transactions commute, so that every serializable execution
+// yields the state of the serial one. The witness of the block is recorded on
+// the way.
+func newTestEVMBlock(t *testing.T) *testEVMBlock {
+	var (
+		config  = params.AllEthashProtocolChanges
+		signer  = types.LatestSigner(config)
+		db      = rawdb.NewMemoryDatabase()
+		keys    = make([]*ecdsa.PrivateKey, 8)
+		genesis = &core.Genesis{
+			Config:   config,
+			GasLimit: 10000000,
+			BaseFee:  big.NewInt(params.InitialBaseFee),
+			Alloc: core.GenesisAlloc{
+				testCoinbase: {Balance: big.NewInt(params.Ether)},
+				testCounter:  {Balance: common.Big0, Code: common.FromHex("60005460010160005500"), Storage: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(7))}},
+			},
+		}
+		tb = &testEVMBlock{config: config, path: filepath.Join(t.TempDir(), "witness.rlp"), block: Block{BlockNumber: "1"}}
+	)
+	for i := range keys {
+		key, err := crypto.ToECDSA(common.BigToHash(big.NewInt(int64(i + 1))).Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		tb.accounts = append(tb.accounts, crypto.PubkeyToAddress(key.PublicKey))
+		genesis.Alloc[tb.accounts[i]] = core.GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	tb.accounts = append(tb.accounts, testCounter, testCoinbase)
+	parent := genesis.MustCommit(db).Header()
+
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Coinbase:   testCoinbase,
+		Number:     big.NewInt(1),
+		GasLimit:   parent.GasLimit,
+		BaseFee:    parent.BaseFee,
+		Difficulty: big.NewInt(1),
+		Time:       parent.Time + 12,
+	}
+	var (
+		gasPrice = new(big.Int).Mul(header.BaseFee, big.NewInt(2))
+		txs      []*types.Transaction
+	)
+	for _, tx := range []struct {
+		from, nonce int
+		to          common.Address
+		gas         uint64
+	}{
+		{0, 0, tb.accounts[1], params.TxGas},
+		{1, 0, tb.accounts[2], params.TxGas},
+		{3, 0, tb.accounts[4], params.TxGas},
+		{0, 1, tb.accounts[5], params.TxGas},
+		{6, 0, testCounter, 50000},
+		{7, 0, testCounter, 50000},
+	} {
+		signed, err := types.SignTx(types.NewTransaction(uint64(tx.nonce), tx.to, common.Big1, tx.gas, gasPrice, nil), signer, keys[tx.from])
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, signed)
+		tb.block.Transactions = append(tb.block.Transactions, Transaction{BlockNumber: "1", TransactionHash: signed.Hash().Hex()})
+	}
+	block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+
+	// Serial execution, recording the witness
+	var (
+		recorder = witness.NewRecorder()
+		sdb      = state.NewDatabase(db)
+	)
+	sdb.TrieDB().SetNodeRecorder(recorder.AddNode)
+	defer sdb.TrieDB().SetNodeRecorder(nil)
+
+	statedb, err := state.New(parent.Root, recorder.Database(sdb), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockCtx := core.NewEVMBlockContext(header, nil, &header.Coinbase)
+	for i, tx := range txs {
+		msg, err := tx.AsMessage(signer, header.BaseFee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statedb.Prepare(tx.Hash(), i)
+		evm := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), statedb, config, vm.Config{Debug: true, Tracer: recorder})
+		if _, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(header.GasLimit)); err != nil {
+			t.Fatalf("tx %d: %v", i, err)
+		}
+		statedb.Finalise(true)
+	}
+	tb.post = statedb
+
+	if tb.witness, err = recorder.Witness(block, testHeaders{parent}); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := witness.NewWriter(tb.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(tb.witness); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+// testHeaders serves the ancestors of the test block.
+type testHeaders []*types.Header
+
+func (hs testHeaders) GetHeader(hash common.Hash, number uint64) *types.Header {
+	for _, h := range hs {
+		if h.Hash() == hash && h.Number.Uint64() == number {
+			return h
+		}
+	}
+	return nil
+}
+
+// evmBlock returns a fresh evmBlock of the test block.
+func (tb *testEVMBlock) evmBlock(t *testing.T) *evmBlock {
+	t.Helper()
+
+	b, err := newEVMBlock(tb.config, tb.witness, &tb.block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.reset()
+	return b
+}
+
+// committed returns the parent state overlaid with the committed writes of b.
+func committed(t *testing.T, b *evmBlock) *state.StateDB {
+	t.Helper()
+
+	view, err := state.New(b.root, b.db, nil, &hotcache.RWRecorder{Sink: hotcache.NewMemorySink()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.overlay(view)
+	return view
+}
+
+// checkPost compares the accounts of have with the serial post state.
+func (tb *testEVMBlock) checkPost(t *testing.T, name string, have *state.StateDB) {
+	t.Helper()
+
+	for _, addr := range tb.accounts {
+		if h, w := have.GetBalance(addr), tb.post.GetBalance(addr); h.Cmp(w) != 0 {
+			t.Errorf("%s: balance of %x mismatch: have %v, want %v", name, addr, h, w)
+		}
+		if h, w := have.GetNonce(addr), tb.post.GetNonce(addr); h != w {
+			t.Errorf("%s: nonce of %x mismatch: have %d, want %d", name, addr, h, w)
+		}
+	}
+	if h, w := have.GetState(testCounter, common.Hash{}), tb.post.GetState(testCounter, common.Hash{}); h != w {
+		t.Errorf("%s: counter mismatch: have %x, want %x", name, h, w)
+	}
+}
+
+func TestEVMBlockOverlay(t *testing.T) {
+	tb := newTestEVMBlock(t)
+	b := tb.evmBlock(t)
+	sender := tb.accounts[0]
+
+	// Executions don't see each other's uncommitted writes
+	first, second := b.run(0), b.run(3)
+	if first.err != nil || second.err != nil {
+		t.Fatalf("execution failed: %v, %v", first.err, second.err)
+	}
+	if nonce := second.view.GetNonce(sender); nonce != 1 {
+		t.Errorf("uncommitted write visible: nonce %d, want 1", nonce)
+	}
+	if nonce := committed(t, b).GetNonce(sender); nonce != 0 {
+		t.Errorf("uncommitted write in the committed state: nonce %d, want 0", nonce)
+	}
+	// Executions started after a commit do
+	b.commit(first)
+	if nonce := b.run(3).view.GetNonce(sender); nonce != 2 {
+		t.Errorf("committed write invisible: nonce %d, want 2", nonce)
+	}
+	if nonce := committed(t, b).GetNonce(sender); nonce != 1 {
+		t.Errorf("committed nonce %d, want 1", nonce)
+	}
+}
+
+func TestEVMBlockValid(t *testing.T) {
+	tests := []struct {
+		committed, checked int
+		conflict           bool
+	}{
+		{committed: 0, checked: 1, conflict: true},  // Balance of the recipient sending
+		{committed: 0, checked: 3, conflict: true},  // Same sender
+		{committed: 0, checked: 2, conflict: false}, // Only the coinbase shared
+		{committed: 2, checked: 1, conflict: false},
+		{committed: 4, checked: 5, conflict: true}, // Counter slot
+		{committed: 5, checked: 0, conflict: false},
+	}
+	tb := newTestEVMBlock(t)
+	for i, tt := range tests {
+		b := tb.evmBlock(t)
+		res, other := b.run(tt.checked), b.run(tt.committed)
+		b.commit(other)
+		if valid := b.valid(res); valid == tt.conflict {
+			t.Errorf("test %d: tx %d after tx %d: valid %v, want %v", i, tt.checked, tt.committed, valid, !tt.conflict)
+			continue
+		}
+		// Valid executions started from the same state commit both fees
+		if !tt.conflict {
+			b.commit(res)
+			want := new(big.Int).Sub(other.view.GetBalance(testCoinbase), other.coinbase)
+			want.Add(want, res.view.GetBalance(testCoinbase))
+			if have := committed(t, b).GetBalance(testCoinbase); have.Cmp(want) != 0 {
+				t.Errorf("test %d: coinbase balance mismatch: have %v, want %v", i, have, want)
+			}
+		}
+	}
+}
+
+func TestEVMBlockCommitOrder(t *testing.T) {
+	tests := [][]int{
+		{0, 1, 2, 3, 4, 5},
+		{5, 4, 3, 2, 1, 0},
+		{2, 5, 0, 4, 3, 1},
+	}
+	tb := newTestEVMBlock(t)
+	for i, order := range tests {
+		b := tb.evmBlock(t)
+		for _, tx := range order {
+			res := b.run(tx)
+			if res.err != nil {
+				t.Fatalf("test %d: tx %d: %v", i, tx, res.err)
+			}
+			b.commit(res)
+		}
+		tb.checkPost(t, "order "+strconv.Itoa(i), committed(t, b))
+	}
+}
+
+func TestEVMExecutorSchemes(t *testing.T) {
+	tests := []struct {
+		scheme  string
+		workers int
+	}{
+		{"serial", 1},
+		{"occwsi", 1},
+		{"occwsi", 4},
+		{"deocc", 4},
+	}
+	tb := newTestEVMBlock(t)
+	for _, tt := range tests {
+		name := tt.scheme + "/" + strconv.Itoa(tt.workers)
+		s, err := lookupScheme(tt.scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exec, err := newEVMExecutor(tb.path, tb.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks := copyBlocks([]Block{tb.block})
+		results, err := runBlocks(blocks, s.new(), exec, tt.workers)
+		exec.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if results[0].Executions < len(tb.block.Transactions) {
+			t.Errorf("%s: %d executions of %d transactions", name, results[0].Executions, len(tb.block.Transactions))
+		}
+		tb.checkPost(t, name, committed(t, exec.block))
+
+		// The executed read/write sets replace the empty captured ones
+		for i, tx := range blocks[0].Transactions {
+			if len(tx.WriteStateAddresses) == 0 || tx.ExecutionTime <= 0 {
+				t.Errorf("%s: tx %d not recorded: writes %v, time %d", name, i, tx.WriteStateAddresses, tx.ExecutionTime)
+			}
+		}
+	}
+}
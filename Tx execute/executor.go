@@ -0,0 +1,99 @@
+package main
+
+import (
+	"time"
+)
+
+// Executor runs the transactions of a block on behalf of the schedulers. The
+// schedulers decide which transactions run when, the executor what running a
+// transaction costs and what it reads and writes.
+type Executor interface {
+	// BeginBlock resets the executor to the state before the block, dropping
+	// everything committed since.
+	BeginBlock(block *Block) error
+
+	// Attempt executes transaction i of the block optimistically and commits
+	// its writes if none of the state it accessed was committed by another
+	// transaction meanwhile. It reports whether the writes were committed.
+	Attempt(block *Block, i int) bool
+
+	// Apply executes transaction i of the block and commits its writes
+	// unconditionally, the caller orders conflicting transactions.
+	Apply(block *Block, i int)
+
+	// Err returns the first error an execution failed with. The results of
+	// the block it failed in are void and the executor is not to be used
+	// any further.
+	Err() error
+}
+
+// simExecutor simulates the transactions: every transaction takes its recorded
+// execution time, and its captured read/write sets access integer state items
+// whose versions are bumped by every committed write.
+type simExecutor struct {
+	sm *StateManager
+}
+
+func newSimExecutor(transactions []Transaction) *simExecutor {
+	return &simExecutor{sm: NewStateManager(transactions)}
+}
+
+// BeginBlock implements Executor. The state items are kept across blocks.
+func (e *simExecutor) BeginBlock(block *Block) error {
+	return nil
+}
+
+// Attempt implements Executor.
+func (e *simExecutor) Attempt(block *Block, i int) bool {
+	tx := &block.Transactions[i]
+	sm := e.sm
+
+	snapshot := make(map[string]int)
+	for _, addr := range tx.ReadStateAddresses {
+		snapshot[addr] = sm.stateMap[addr].Version
+	}
+	for _, addr := range tx.WriteStateAddresses {
+		snapshot[addr] = sm.stateMap[addr].Version
+	}
+	time.Sleep(time.Nanosecond * time.Duration(tx.ExecutionTime)) // Simulate transaction execution time
+
+	// Check if the version numbers have changed after execution
+	conflict := false
+	sm.lock.RLock()
+	for addr, version := range snapshot {
+		if sm.stateMap[addr].Version != version {
+			conflict = true
+			break
+		}
+	}
+	sm.lock.RUnlock()
+	if conflict {
+		return false
+	}
+	sm.lock.Lock()
+	for _, addr := range tx.WriteStateAddresses {
+		sm.stateMap[addr].Value++
+		sm.stateMap[addr].Version++
+	}
+	sm.lock.Unlock()
+	return true
+}
+
+// Err implements Executor, simulated executions never fail.
+func (e *simExecutor) Err() error {
+	return nil
+}
+
+// Apply implements Executor.
+func (e *simExecutor) Apply(block *Block, i int) {
+	tx := &block.Transactions[i]
+	e.sm.lock.Lock()
+	for _, addr := range tx.WriteStateAddresses {
+		e.sm.stateMap[addr].Value++
+	}
+	for _, addr := range tx.ReadStateAddresses {
+		_ = e.sm.stateMap[addr].Value
+	}
+	e.sm.lock.Unlock()
+	time.Sleep(time.Nanosecond * time.Duration(tx.ExecutionTime)) // Simulate transaction execution time
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// experiment holds the settings shared by all runs.
+type experiment struct {
+	workers []int // Numbers of workers the parallel schemes are run with
+	warmup  int   // Runs discarded before measuring
+	reps    int   // Measured runs
+}
+
+// measurement holds the results of the repetitions of one scheme with one
+// number of workers on one dataset.
+type measurement struct {
+	mode    string // "wall" for wall-clock times, "virtual" for virtual time
+	class   string
+	scheme  string
+	workers int
+	blocks  []string
+	runs    [][]Result // Indexed by repetition and block
+}
+
+// runSchemes executes the blocks with each of the named schedulers, the
+// parallel ones once for every number of workers, on a fresh executor from
+// newExec per run.
+func (e *experiment) runSchemes(blocks []Block, names []string, newExec func() (Executor, error), class string) ([]*measurement, error) {
+	numbers := make([]string, len(blocks))
+	for i := range blocks {
+		numbers[i] = blocks[i].BlockNumber
+	}
+	var ms []*measurement
+	for _, name := range names {
+		s, err := lookupScheme(name)
+		if err != nil {
+			return nil, err
+		}
+		counts := e.workers
+		if !s.parallel {
+			counts = []int{1}
+		}
+		for _, n := range counts {
+			m := &measurement{mode: "wall", class: class, scheme: name, workers: n, blocks: numbers}
+			for r := 0; r < e.warmup+e.reps; r++ {
+				fmt.Printf("Running %s on %s with %d workers, run %d of %d\n", name, class, n, r+1, e.warmup+e.reps)
+				results, err := runOnce(blocks, s.new(), newExec, n)
+				if errors.Is(err, errUnsupportedExecutor) {
+					fmt.Printf("Skipping %s on %s: %v\n", name, class, err)
+					break
+				}
+				if err != nil {
+					return nil, fmt.Errorf("%s on %s: %w", name, class, err)
+				}
+				if r >= e.warmup {
+					m.runs = append(m.runs, results)
+				}
+			}
+			if len(m.runs) > 0 {
+				ms = append(ms, m)
+			}
+		}
+	}
+	return ms, nil
+}
+
+// simulateSchemes executes the blocks with each of the named schedulers in
+// virtual time, the parallel ones once for every number of workers. Virtual
+// times don't vary, so every scheme is run once.
+func (e *experiment) simulateSchemes(blocks []Block, names []string, class string) ([]*measurement, error) {
+	numbers := make([]string, len(blocks))
+	for i := range blocks {
+		numbers[i] = blocks[i].BlockNumber
+	}
+	var ms []*measurement
+	for _, name := range names {
+		s, err := lookupScheme(name)
+		if err != nil {
+			return nil, err
+		}
+		vs, ok := s.new().(VirtualScheduler)
+		if !ok {
+			fmt.Printf("Skipping %s on %s: no virtual time model\n", name, class)
+			continue
+		}
+		counts := e.workers
+		if !s.parallel {
+			counts = []int{1}
+		}
+		for _, n := range counts {
+			fmt.Printf("Simulating %s on %s with %d workers\n", name, class, n)
+			results := make([]Result, len(blocks))
+			for b := range blocks {
+				results[b] = vs.SimulateBlock(&blocks[b], n)
+			}
+			ms = append(ms, &measurement{mode: "virtual", class: class, scheme: name, workers: n, blocks: numbers, runs: [][]Result{results}})
+		}
+	}
+	return ms, nil
+}
+
+// runOnce executes the blocks with the scheduler on an executor of its own.
+// The run works on copies of the blocks, as executors may replace the
+// read/write sets of the transactions.
+func runOnce(blocks []Block, s Scheduler, newExec func() (Executor, error), workers int) ([]Result, error) {
+	exec, err := newExec()
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := exec.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+	return runBlocks(copyBlocks(blocks), s, exec, workers)
+}
+
+// copyBlocks returns copies of the blocks holding copies of their transactions.
+func copyBlocks(blocks []Block) []Block {
+	copies := make([]Block, len(blocks))
+	for i, block := range blocks {
+		copies[i] = Block{BlockNumber: block.BlockNumber, Transactions: append([]Transaction(nil), block.Transactions...)}
+	}
+	return copies
+}
+
+// resultRow is a line of the results table, the times of a block or, with
+// block "total", of all blocks of a run, averaged over the repetitions.
+type resultRow struct {
+	Mode              string  `json:"mode"`
+	Class             string  `json:"class"`
+	Scheme            string  `json:"scheme"`
+	Workers           int     `json:"workers"`
+	Block             string  `json:"block"`
+	Runs              int     `json:"runs"`
+	ExecTime          float64 `json:"execTime"` // Milliseconds
+	ExecStddev        float64 `json:"execStddev"`
+	ValidationTime    float64 `json:"validationTime"`
+	ValidationStddev  float64 `json:"validationStddev"`
+	NeedRW            int     `json:"needRW"`
+	Executions        float64 `json:"executions"` // Transaction executions, re-executions included
+	Aborts            float64 `json:"aborts"`
+	Suspensions       float64 `json:"suspensions"`
+	Utilization       float64 `json:"utilization"`           // Share of the worker time spent executing transactions, virtual time only
+	ExecSpeedup       float64 `json:"execSpeedup,omitempty"` // Serial time over execution time
+	ValidationSpeedup float64 `json:"validationSpeedup,omitempty"`
+}
+
+// totalBlock names the rows holding the totals of all blocks.
+const totalBlock = "total"
+
+// combinedClass names the rows of the non-token contract transactions and the
+// vessel transactions executed together, compared against all contract
+// transactions executed serially.
+const combinedClass = "combined"
+
+// resultTable summarizes the measurements into one row per block and one for
+// the totals of every measurement, followed by the totals of the non-token
+// contract transactions combined with the vessel transactions for every pair
+// of schemes run with the same number of workers. Speedups are taken against
+// the serial measurement of the same mode and class, or of all transactions
+// for the combined rows, and left zero without one.
+func resultTable(ms []*measurement) []resultRow {
+	serial := make(map[string]*measurement)
+	for _, m := range ms {
+		if m.scheme == "serial" {
+			serial[m.mode+"/"+m.class] = m
+		}
+	}
+	var rows []resultRow
+	for _, m := range ms {
+		base := serial[m.mode+"/"+m.class]
+		for b, number := range m.blocks {
+			row := m.row(number, func(run []Result) []Result { return run[b : b+1] })
+			if base != nil {
+				row.speedup(mean(base.times(func(run []Result) []Result { return run[b : b+1] }, execTime)))
+			}
+			rows = append(rows, row)
+		}
+		row := m.row(totalBlock, allBlocks)
+		if base != nil {
+			row.speedup(mean(base.times(allBlocks, execTime)))
+		}
+		rows = append(rows, row)
+	}
+	// The non-token transactions and the vessel transactions of a block are
+	// executed one after another
+	for _, contract := range ms {
+		if contract.class != "without_token" || contract.scheme == "serial" {
+			continue
+		}
+		for _, vessel := range ms {
+			if vessel.class != "vessel" || vessel.scheme == "serial" || vessel.workers != contract.workers || vessel.mode != contract.mode {
+				continue
+			}
+			m := &measurement{mode: contract.mode, class: combinedClass, scheme: contract.scheme + "+" + vessel.scheme, workers: contract.workers}
+			for r := range contract.runs {
+				if r < len(vessel.runs) {
+					m.runs = append(m.runs, append(append([]Result{}, contract.runs[r]...), vessel.runs[r]...))
+				}
+			}
+			row := m.row(totalBlock, allBlocks)
+			if base := serial[m.mode+"/all"]; base != nil {
+				row.speedup(mean(base.times(allBlocks, execTime)))
+			}
+			if mean(contract.times(allBlocks, validationTime)) == 0 {
+				row.ValidationSpeedup = 0 // Only the vessel transactions are validated
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// allBlocks selects all blocks of a run.
+func allBlocks(run []Result) []Result { return run }
+
+func execTime(res Result) time.Duration       { return res.ExecTime }
+func validationTime(res Result) time.Duration { return res.ValidationTime }
+
+// times returns the time of the selected blocks summed up per repetition, in
+// milliseconds.
+func (m *measurement) times(sel func([]Result) []Result, phase func(Result) time.Duration) []float64 {
+	times := make([]float64, len(m.runs))
+	for r, run := range m.runs {
+		var total time.Duration
+		for _, res := range sel(run) {
+			total += phase(res)
+		}
+		times[r] = float64(total) / float64(time.Millisecond)
+	}
+	return times
+}
+
+// row returns the result row of the selected blocks.
+func (m *measurement) row(block string, sel func([]Result) []Result) resultRow {
+	exec, vali := m.times(sel, execTime), m.times(sel, validationTime)
+	row := resultRow{
+		Mode: m.mode, Class: m.class, Scheme: m.scheme, Workers: m.workers, Block: block, Runs: len(m.runs),
+		ExecTime: mean(exec), ExecStddev: stddev(exec),
+		ValidationTime: mean(vali), ValidationStddev: stddev(vali),
+	}
+	if len(m.runs) > 0 {
+		for _, res := range sel(m.runs[0]) {
+			row.NeedRW += res.NeedRW
+		}
+	}
+	for _, run := range m.runs {
+		for _, res := range sel(run) {
+			row.Executions += float64(res.Executions)
+			row.Aborts += float64(res.Aborts)
+			row.Suspensions += float64(res.Suspensions)
+		}
+	}
+	if len(m.runs) > 0 {
+		row.Executions /= float64(len(m.runs))
+		row.Aborts /= float64(len(m.runs))
+		row.Suspensions /= float64(len(m.runs))
+	}
+	busy := m.times(sel, func(res Result) time.Duration { return res.Busy })
+	utilization := make([]float64, len(m.runs))
+	for r := range m.runs {
+		if span := exec[r] + vali[r]; span > 0 {
+			utilization[r] = busy[r] / (float64(m.workers) * span)
+		}
+	}
+	row.Utilization = mean(utilization)
+	return row
+}
+
+// speedup sets the speedups of the row against the given serial time, leaving
+// them zero if there is no serial time to compare with.
+func (row *resultRow) speedup(serial float64) {
+	if serial <= 0 {
+		return
+	}
+	if row.ExecTime > 0 {
+		row.ExecSpeedup = serial / row.ExecTime
+	}
+	if row.ValidationTime > 0 {
+		row.ValidationSpeedup = serial / row.ValidationTime
+	}
+}
+
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// stddev returns the sample standard deviation, zero for less than two values.
+func stddev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	m, sum := mean(xs), 0.0
+	for _, x := range xs {
+		sum += (x - m) * (x - m)
+	}
+	return math.Sqrt(sum / float64(len(xs)-1))
+}
+
+// writeResults writes the rows to path as CSV, or as JSON if the path has the
+// .json extension.
+func writeResults(path string, rows []resultRow) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.HasSuffix(path, ".json") {
+		enc := json.NewEncoder(file)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rows); err != nil {
+			return err
+		}
+		return file.Close()
+	}
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Mode", "Class", "Scheme", "Workers", "BlockNumber", "Runs", "ExecutionTime(ms)", "ExecutionStddev(ms)", "ValidationTime(ms)", "ValidationStddev(ms)", "needRW", "Executions", "Aborts", "Suspensions", "Utilization", "ExecutionSpeedup", "ValidationSpeedup"})
+	for _, row := range rows {
+		writer.Write([]string{
+			row.Mode, row.Class, row.Scheme, strconv.Itoa(row.Workers), row.Block, strconv.Itoa(row.Runs),
+			formatFloat(row.ExecTime), formatFloat(row.ExecStddev),
+			formatFloat(row.ValidationTime), formatFloat(row.ValidationStddev),
+			strconv.Itoa(row.NeedRW), formatFloat(row.Executions), formatFloat(row.Aborts), formatFloat(row.Suspensions), formatFloat(row.Utilization),
+			formatFloat(row.ExecSpeedup), formatFloat(row.ValidationSpeedup),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRowSpeedup(t *testing.T) {
+	tests := []struct {
+		serial         float64
+		exec, vali     float64
+		execSp, valiSp float64
+	}{
+		{serial: 30, exec: 15, vali: 6, execSp: 2, valiSp: 5},
+		{serial: 30, exec: 15, vali: 0, execSp: 2, valiSp: 0},
+		{serial: 30, exec: 0, vali: 0, execSp: 0, valiSp: 0},
+		{serial: 0, exec: 15, vali: 6, execSp: 0, valiSp: 0},
+		{serial: 0, exec: 0, vali: 0, execSp: 0, valiSp: 0},
+	}
+	for i, tt := range tests {
+		row := resultRow{ExecTime: tt.exec, ValidationTime: tt.vali}
+		row.speedup(tt.serial)
+		if row.ExecSpeedup != tt.execSp || row.ValidationSpeedup != tt.valiSp {
+			t.Errorf("test %d: speedup mismatch: have %v/%v, want %v/%v", i, row.ExecSpeedup, row.ValidationSpeedup, tt.execSp, tt.valiSp)
+		}
+	}
+}
+
+func TestResultTable(t *testing.T) {
+	ms := []*measurement{
+		{mode: "wall", class: "all", scheme: "serial", workers: 1, blocks: []string{"1", "2"}, runs: [][]Result{
+			{{ExecTime: 10 * time.Millisecond}, {ExecTime: 20 * time.Millisecond}},
+			{{ExecTime: 12 * time.Millisecond}, {ExecTime: 18 * time.Millisecond}},
+		}},
+		{mode: "wall", class: "all", scheme: "occwsi", workers: 2, blocks: []string{"1", "2"}, runs: [][]Result{
+			{{ExecTime: 5 * time.Millisecond, ValidationTime: 2 * time.Millisecond, Executions: 3, Aborts: 1}, {ExecTime: 10 * time.Millisecond, ValidationTime: 4 * time.Millisecond, Executions: 2}},
+		}},
+		{mode: "wall", class: "without_token", scheme: "occwsi", workers: 2, blocks: []string{"1"}, runs: [][]Result{
+			{{ExecTime: 4 * time.Millisecond, ValidationTime: time.Millisecond}},
+		}},
+		{mode: "wall", class: "vessel", scheme: "serial", workers: 1, blocks: []string{"1"}, runs: [][]Result{
+			{{}},
+		}},
+		{mode: "wall", class: "vessel", scheme: "vessel", workers: 2, blocks: []string{"1"}, runs: [][]Result{
+			{{ExecTime: 6 * time.Millisecond, ValidationTime: 2 * time.Millisecond}},
+		}},
+		{mode: "wall", class: "vessel", scheme: "vessel", workers: 4, blocks: []string{"1"}, runs: [][]Result{
+			{{ExecTime: 3 * time.Millisecond}},
+		}},
+	}
+	want := []resultRow{
+		{Class: "all", Scheme: "serial", Workers: 1, Block: "1", Runs: 2, ExecTime: 11, ExecStddev: math.Sqrt2, ExecSpeedup: 1},
+		{Class: "all", Scheme: "serial", Workers: 1, Block: "2", Runs: 2, ExecTime: 19, ExecStddev: math.Sqrt2, ExecSpeedup: 1},
+		{Class: "all", Scheme: "serial", Workers: 1, Block: totalBlock, Runs: 2, ExecTime: 30, ExecSpeedup: 1},
+		{Class: "all", Scheme: "occwsi", Workers: 2, Block: "1", Runs: 1, ExecTime: 5, ValidationTime: 2, Executions: 3, Aborts: 1, ExecSpeedup: 2.2, ValidationSpeedup: 5.5},
+		{Class: "all", Scheme: "occwsi", Workers: 2, Block: "2", Runs: 1, ExecTime: 10, ValidationTime: 4, Executions: 2, ExecSpeedup: 1.9, ValidationSpeedup: 4.75},
+		{Class: "all", Scheme: "occwsi", Workers: 2, Block: totalBlock, Runs: 1, ExecTime: 15, ValidationTime: 6, Executions: 5, Aborts: 1, ExecSpeedup: 2, ValidationSpeedup: 5},
+		// No serial run of the class, no speedups
+		{Class: "without_token", Scheme: "occwsi", Workers: 2, Block: "1", Runs: 1, ExecTime: 4, ValidationTime: 1},
+		{Class: "without_token", Scheme: "occwsi", Workers: 2, Block: totalBlock, Runs: 1, ExecTime: 4, ValidationTime: 1},
+		// Zero serial time, no speedups
+		{Class: "vessel", Scheme: "serial", Workers: 1, Block: "1", Runs: 1},
+		{Class: "vessel", Scheme: "serial", Workers: 1, Block: totalBlock, Runs: 1},
+		{Class: "vessel", Scheme: "vessel", Workers: 2, Block: "1", Runs: 1, ExecTime: 6, ValidationTime: 2},
+		{Class: "vessel", Scheme: "vessel", Workers: 2, Block: totalBlock, Runs: 1, ExecTime: 6, ValidationTime: 2},
+		{Class: "vessel", Scheme: "vessel", Workers: 4, Block: "1", Runs: 1, ExecTime: 3},
+		{Class: "vessel", Scheme: "vessel", Workers: 4, Block: totalBlock, Runs: 1, ExecTime: 3},
+		// Only the pair run with the same number of workers is combined, and
+		// compared against all transactions executed serially
+		{Class: combinedClass, Scheme: "occwsi+vessel", Workers: 2, Block: totalBlock, Runs: 1, ExecTime: 10, ValidationTime: 3, ExecSpeedup: 3, ValidationSpeedup: 10},
+	}
+	have := resultTable(ms)
+	if len(have) != len(want) {
+		t.Fatalf("row count mismatch: have %d, want %d", len(have), len(want))
+	}
+	for i := range want {
+		want[i].Mode = "wall"
+		if !rowsEqual(have[i], want[i]) {
+			t.Errorf("row %d mismatch:\nhave %+v\nwant %+v", i, have[i], want[i])
+		}
+	}
+}
+
+// rowsEqual compares two result rows, allowing for rounding in the averaged
+// and derived values.
+func rowsEqual(a, b resultRow) bool {
+	close := func(x, y float64) bool { return math.Abs(x-y) < 1e-9 }
+	return a.Mode == b.Mode && a.Class == b.Class && a.Scheme == b.Scheme && a.Workers == b.Workers &&
+		a.Block == b.Block && a.Runs == b.Runs && a.NeedRW == b.NeedRW &&
+		close(a.ExecTime, b.ExecTime) && close(a.ExecStddev, b.ExecStddev) &&
+		close(a.ValidationTime, b.ValidationTime) && close(a.ValidationStddev, b.ValidationStddev) &&
+		close(a.Executions, b.Executions) && close(a.Aborts, b.Aborts) && close(a.Suspensions, b.Suspensions) && close(a.Utilization, b.Utilization) &&
+		close(a.ExecSpeedup, b.ExecSpeedup) && close(a.ValidationSpeedup, b.ValidationSpeedup)
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/csv"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -12,11 +14,19 @@ import (
 	"time"
 )
 
-const thread = 64
 const filePath_all = "transactions.csv"
 const filePath_token = "transactions_token.csv"
 const filePath_without_token = "transactions_without_token.csv"
 
+// filePath_witness holds the witnesses of the captured blocks, written by
+// geth capture --capture.witness, for executing the transactions on the EVM
+const filePath_witness = "witness.rlp"
+
+const filePath_vessel = "vessel.csv"
+
+// filePath_vesselDB is the leveldb populated by exp-init, holding the vessels
+const filePath_vesselDB = "../exp-init/leveldb"
+
 // Transaction defines the structure of a transaction
 type Transaction struct {
 	BlockNumber         string   // Block number
@@ -73,98 +83,203 @@ func NewDependencyGraph(n int) *DependencyGraph {
 }
 
 func main() {
+	var (
+		allPath          = flag.String("all", filePath_all, "contract transactions, all of them (CSV or .rwt trace, empty to skip)")
+		tokenPath        = flag.String("token", filePath_token, "token contract transactions (empty to skip)")
+		withoutTokenPath = flag.String("without-token", filePath_without_token, "non-token contract transactions (empty to skip)")
+		vesselPath       = flag.String("vessel", filePath_vessel, "vessel transactions (empty to skip)")
+		vesselDB         = flag.String("vesseldb", filePath_vesselDB, "leveldb holding the vessels, populated by exp-init")
+		witnessPath      = flag.String("witness", filePath_witness, "witnesses of the blocks of -all, executed on the EVM if the file exists")
+		chain            = flag.String("chain", "mainnet", "chain configuration the witnesses are executed with: mainnet or a genesis JSON file")
+		outDir           = flag.String("out", ".", "output directory")
+		format           = flag.String("format", "csv", "format of the results table, csv or json")
+		contractFlag     = flag.String("schemes", "serial,occwsi,deocc,blockstm", "schemes run on the contract transactions, available: "+strings.Join(schemeNames(), ","))
+		vesselFlag       = flag.String("vessel-schemes", "serial,vessel", "schemes run on the vessel transactions")
+		workersFlag      = flag.String("workers", "64", "numbers of workers the parallel schemes are run with, e.g. 1,2,4,8,16,32,64")
+		mode             = flag.String("mode", "wall", "wall for wall-clock times, virtual for virtual time, both to run both")
+		warmup           = flag.Int("warmup", 0, "runs discarded before measuring")
+		reps             = flag.Int("reps", 1, "measured runs of every scheme and number of workers")
+	)
+	flag.Parse()
 
-	transactions, err := readCSV(filePath_all)
-	if err != nil {
-		fmt.Printf("Error reading CSV file: %v\n", err)
-		return
-	}
-	stateManager := NewStateManager(transactions)
-	// Group transactions by block number
-	blocks := groupTransactionsByBlock(transactions)
-	// Serial execution of contract transactions
-	serial(blocks, stateManager.stateMap, "all")
-	// Parallel execution of contract transactions with OCCWSI
-	stateManager = NewStateManager(transactions)
-	occWsi(blocks, stateManager, "all")
-	// Parallel execution of contract transactions with DEOCC
-	stateManager = NewStateManager(transactions)
-	deOCC(blocks, stateManager, "all")
-
-	// Execute non-token contract transactions
-	transactions, err = readCSV(filePath_without_token)
+	workers, err := parseWorkers(*workersFlag)
 	if err != nil {
-		fmt.Printf("Error reading CSV file: %v\n", err)
-		return
-	}
-	stateManager = NewStateManager(transactions)
-	blocks = groupTransactionsByBlock(transactions)
-	serial(blocks, stateManager.stateMap, "without_token")
-	stateManager = NewStateManager(transactions)
-	occWsi(blocks, stateManager, "without_token")
-	stateManager = NewStateManager(transactions)
-	deOCC(blocks, stateManager, "without_token")
-
-	// Execute token contract transactions
-	transactions, err = readCSV(filePath_token)
+		fmt.Printf("Invalid -workers: %v\n", err)
+		os.Exit(2)
+	}
+	if *format != "csv" && *format != "json" {
+		fmt.Printf("Invalid -format %q\n", *format)
+		os.Exit(2)
+	}
+	if *mode != "wall" && *mode != "virtual" && *mode != "both" {
+		fmt.Printf("Invalid -mode %q\n", *mode)
+		os.Exit(2)
+	}
+	wall, virtual := *mode != "virtual", *mode != "wall"
+	if *reps < 1 || *warmup < 0 {
+		fmt.Printf("Invalid -reps %d or -warmup %d\n", *reps, *warmup)
+		os.Exit(2)
+	}
+	config, err := loadChainConfig(*chain)
 	if err != nil {
-		fmt.Printf("Error reading CSV file: %v\n", err)
-		return
+		fmt.Printf("Invalid -chain: %v\n", err)
+		os.Exit(2)
 	}
-	stateManager = NewStateManager(transactions)
-	blocks = groupTransactionsByBlock(transactions)
-	serial(blocks, stateManager.stateMap, "token")
-	stateManager = NewStateManager(transactions)
-	occWsi(blocks, stateManager, "token")
-	stateManager = NewStateManager(transactions)
-	deOCC(blocks, stateManager, "token")
-
-	// Serial execution of vessel transactions
-	vessel_serial_execute()
-	// Parallel execution of vessel transactions
-	vessel_parallel_execute()
+	contractSchemes, vesselSchemes := splitList(*contractFlag), splitList(*vesselFlag)
+	for _, name := range append(contractSchemes, vesselSchemes...) {
+		if _, err := lookupScheme(name); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Printf("Error creating output directory: %v\n", err)
+		os.Exit(1)
+	}
+	e := &experiment{workers: workers, warmup: *warmup, reps: *reps}
+	var ms []*measurement
 
-}
+	// Contract transactions, executed on the EVM as well if the witnesses of
+	// their blocks were captured
+	for _, set := range []struct{ class, path string }{
+		{"all", *allPath},
+		{"without_token", *withoutTokenPath},
+		{"token", *tokenPath},
+	} {
+		if set.path == "" {
+			continue
+		}
+		transactions, err := loadTransactions(set.path)
+		if err != nil {
+			fmt.Printf("Error reading CSV file: %v\n", err)
+			os.Exit(1)
+		}
+		// Group transactions by block number
+		blocks := groupTransactionsByBlock(transactions)
+		if virtual {
+			res, err := e.simulateSchemes(blocks, contractSchemes, set.class)
+			if err != nil {
+				fmt.Printf("Error simulating transactions: %v\n", err)
+				os.Exit(1)
+			}
+			ms = append(ms, res...)
+		}
+		if !wall {
+			continue
+		}
+		newExec := func() (Executor, error) { return newSimExecutor(transactions), nil }
+		res, err := e.runSchemes(blocks, contractSchemes, newExec, set.class)
+		if err != nil {
+			fmt.Printf("Error executing transactions: %v\n", err)
+			os.Exit(1)
+		}
+		ms = append(ms, res...)
 
-func serial(blocks []Block, stateMap map[string]*StateValue, class string) {
-	// Create output file
-	outputFilePath := class + "serial_execution_times.csv"
-	outputFile, err := os.Create(outputFilePath)
-	if err != nil {
-		fmt.Printf("Error creating output file: %v\n", err)
-		return
+		if set.class != "all" || *witnessPath == "" {
+			continue
+		}
+		if _, err := os.Stat(*witnessPath); err != nil {
+			continue
+		}
+		newExec = func() (Executor, error) { return newEVMExecutor(*witnessPath, config) }
+		if res, err = e.runSchemes(blocks, contractSchemes, newExec, set.class+"_evm"); err != nil {
+			fmt.Printf("Error executing transactions: %v\n", err)
+			os.Exit(1)
+		}
+		ms = append(ms, res...)
 	}
-	defer outputFile.Close()
-	writer := csv.NewWriter(outputFile)
-	defer writer.Flush()
-	writer.Write([]string{"BlockNumber", "ExecutionTime(ms)"})
 
-	// Record total execution time
-	totalExecTime := time.Duration(0)
+	// Vessel transactions
+	if *vesselPath != "" {
+		transactions, err := loadVessels(*vesselPath)
+		if err != nil {
+			fmt.Printf("Error reading CSV file: %v\n", err)
+			os.Exit(1)
+		}
+		blocks := groupUTXByBlock(transactions)
+		if virtual {
+			res, err := e.simulateSchemes(blocks, vesselSchemes, "vessel")
+			if err != nil {
+				fmt.Printf("Error simulating transactions: %v\n", err)
+				os.Exit(1)
+			}
+			ms = append(ms, res...)
+		}
+		if wall {
+			newExec := func() (Executor, error) { return newVesselExecutor(*vesselDB, transactions) }
+			res, err := e.runSchemes(blocks, vesselSchemes, newExec, "vessel")
+			if err != nil {
+				fmt.Printf("Error executing transactions: %v\n", err)
+				os.Exit(1)
+			}
+			ms = append(ms, res...)
+		}
+	}
 
-	// Execute each block in sequence
-	for _, block := range blocks {
-		startTime := time.Now()
-		executeBlockSerial(block.Transactions, stateMap)
-		execTime := time.Since(startTime)
-		totalExecTime += execTime
-		writer.Write([]string{block.BlockNumber, fmt.Sprintf("%d", execTime.Milliseconds())})
-		println(block.BlockNumber)
+	rows := resultTable(ms)
+	outputFilePath := filepath.Join(*outDir, "results."+*format)
+	if err := writeResults(outputFilePath, rows); err != nil {
+		fmt.Printf("Error writing results: %v\n", err)
+		os.Exit(1)
+	}
+	for _, row := range rows {
+		if row.Block == totalBlock {
+			fmt.Printf("%-7s %-14s %-14s workers=%-3d exec=%.1fms validation=%.1fms aborts=%.0f speedup=%.2f/%.2f\n", row.Mode, row.Class, row.Scheme, row.Workers, row.ExecTime, row.ValidationTime, row.Aborts, row.ExecSpeedup, row.ValidationSpeedup)
+		}
 	}
-	// Record total execution time
-	writer.Write([]string{"Total Execution Time", fmt.Sprintf("%d", totalExecTime.Milliseconds())})
+	fmt.Println("Results written to", outputFilePath)
 }
 
-func executeBlockSerial(txs []Transaction, stateMap map[string]*StateValue) {
-	for _, tx := range txs {
-		for _, addr := range tx.WriteStateAddresses {
-			stateMap[addr].Value++
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
-		for _, addr := range tx.ReadStateAddresses {
-			_ = stateMap[addr].Value
+	}
+	return items
+}
+
+// parseWorkers parses a comma separated list of positive worker counts.
+func parseWorkers(list string) ([]int, error) {
+	var workers []int
+	for _, item := range splitList(list) {
+		n, err := strconv.Atoi(item)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of workers %q", item)
 		}
-		time.Sleep(time.Nanosecond * time.Duration(tx.ExecutionTime)) // Simulate transaction execution time
+		workers = append(workers, n)
+	}
+	if len(workers) == 0 {
+		return nil, fmt.Errorf("no number of workers given")
 	}
+	return workers, nil
+}
+
+// serialScheduler executes the transactions of a block one after another.
+type serialScheduler struct{}
+
+// ExecuteBlock implements Scheduler, the number of workers is ignored.
+func (serialScheduler) ExecuteBlock(block *Block, exec Executor, workers int) (Result, error) {
+	if err := exec.BeginBlock(block); err != nil {
+		return Result{}, err
+	}
+	startTime := time.Now()
+	for i := range block.Transactions {
+		exec.Apply(block, i)
+	}
+	execTime := time.Since(startTime)
+	return Result{ExecTime: execTime, Executions: len(block.Transactions)}, nil
+}
+
+// SimulateBlock implements VirtualScheduler, the number of workers is ignored.
+func (serialScheduler) SimulateBlock(block *Block, workers int) Result {
+	var execTime time.Duration
+	for i := range block.Transactions {
+		execTime += time.Duration(block.Transactions[i].ExecutionTime)
+	}
+	return Result{ExecTime: execTime, Executions: len(block.Transactions), Busy: execTime}
 }
 
 func groupTransactionsByBlock(transactions []Transaction) []Block {
@@ -195,6 +310,15 @@ func groupTransactionsByBlock(transactions []Transaction) []Block {
 	return blocks
 }
 
+// loadTransactions reads the transactions from a merged CSV file, or from a
+// binary read/write set trace if the file has the .rwt extension.
+func loadTransactions(filePath string) ([]Transaction, error) {
+	if strings.HasSuffix(filePath, ".rwt") {
+		return readTrace(filePath)
+	}
+	return readCSV(filePath)
+}
+
 func readCSV(filePath string) ([]Transaction, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -205,8 +329,18 @@ func readCSV(filePath string) ([]Transaction, error) {
 	reader := csv.NewReader(file)
 	var transactions []Transaction
 
-	// Skip the header row
-	reader.Read()
+	// Locate the execution time column in the header row, newer captures
+	// carry extra slot columns before it
+	execTimeColumn := 5
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range header {
+		if strings.TrimSpace(name) == "ExecTime(ns)" {
+			execTimeColumn = i
+		}
+	}
 
 	for {
 		record, err := reader.Read()
@@ -228,7 +362,7 @@ func readCSV(filePath string) ([]Transaction, error) {
 		}
 
 		// Fix the reading of ExecutionTime, first parsing as float, then converting to int64
-		execTimeString := strings.TrimSpace(record[5])
+		execTimeString := strings.TrimSpace(record[execTimeColumn])
 		execTimeFloat, err := strconv.ParseFloat(execTimeString, 64)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Scheduler executes the transactions of a block with one parallelization
+// scheme, leaving running the transactions to an Executor.
+type Scheduler interface {
+	// ExecuteBlock executes the transactions of the block on exec, running
+	// up to workers transactions concurrently.
+	ExecuteBlock(block *Block, exec Executor, workers int) (Result, error)
+}
+
+// Result holds the times a scheduler took for a block.
+type Result struct {
+	ExecTime       time.Duration // Execution, the packaging phase of schemes with a validation phase
+	ValidationTime time.Duration // Validation phase, zero for schemes without one
+	NeedRW         int           // Dependencies passed along with the block, DeOCC only
+	Executions     int           // Transaction executions of the execution phase, re-executions included
+	Aborts         int           // Executions discarded for conflicts
+	Suspensions    int           // Executions stopped at the estimate of an aborted transaction, Block-STM only
+	Busy           time.Duration // Time the workers spent executing transactions, virtual time only
+}
+
+// errUnsupportedExecutor is returned by schedulers that can't run on the
+// executor they were given.
+var errUnsupportedExecutor = errors.New("scheme doesn't support the executor")
+
+// scheme is an entry of the scheduler registry.
+type scheme struct {
+	new      func() Scheduler
+	parallel bool // Whether the number of workers matters
+}
+
+// schemes holds the available schedulers by name.
+var schemes = map[string]scheme{
+	"serial":   {new: func() Scheduler { return serialScheduler{} }},
+	"occwsi":   {new: func() Scheduler { return occwsiScheduler{} }, parallel: true},
+	"deocc":    {new: func() Scheduler { return deoccScheduler{} }, parallel: true},
+	"blockstm": {new: func() Scheduler { return blockstmScheduler{} }, parallel: true},
+	"vessel":   {new: func() Scheduler { return vesselScheduler{} }, parallel: true},
+}
+
+// schemeNames returns the names of the registered schedulers, sorted.
+func schemeNames() []string {
+	names := make([]string, 0, len(schemes))
+	for name := range schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupScheme returns the registry entry of the scheduler called name.
+func lookupScheme(name string) (scheme, error) {
+	s, ok := schemes[name]
+	if !ok {
+		return scheme{}, fmt.Errorf("unknown scheme %q, available: %s", name, strings.Join(schemeNames(), ", "))
+	}
+	return s, nil
+}
+
+// runBlocks executes the blocks in sequence with the scheduler and returns the
+// result of every block.
+func runBlocks(blocks []Block, s Scheduler, exec Executor, workers int) ([]Result, error) {
+	results := make([]Result, len(blocks))
+	for b := range blocks {
+		block := &blocks[b]
+		res, err := s.ExecuteBlock(block, exec, workers)
+		if err == nil {
+			err = exec.Err()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("block %s: %w", block.BlockNumber, err)
+		}
+		results[b] = res
+	}
+	return results, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchemeNames(t *testing.T) {
+	want := []string{"blockstm", "deocc", "occwsi", "serial", "vessel"}
+	if have := schemeNames(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("scheme names mismatch: have %v, want %v", have, want)
+	}
+}
+
+func TestLookupScheme(t *testing.T) {
+	tests := []struct {
+		name     string
+		parallel bool
+		sched    Scheduler
+		err      string
+	}{
+		{name: "serial", parallel: false, sched: serialScheduler{}},
+		{name: "occwsi", parallel: true, sched: occwsiScheduler{}},
+		{name: "deocc", parallel: true, sched: deoccScheduler{}},
+		{name: "blockstm", parallel: true, sched: blockstmScheduler{}},
+		{name: "vessel", parallel: true, sched: vesselScheduler{}},
+		{name: "", err: `unknown scheme ""`},
+		{name: "Serial", err: `unknown scheme "Serial", available: blockstm, deocc, occwsi, serial, vessel`},
+	}
+	for i, tt := range tests {
+		s, err := lookupScheme(tt.name)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("test %d (%q): error mismatch: have %v, want %q", i, tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d (%q): unexpected error: %v", i, tt.name, err)
+			continue
+		}
+		if s.parallel != tt.parallel {
+			t.Errorf("test %d (%q): parallel mismatch: have %v, want %v", i, tt.name, s.parallel, tt.parallel)
+		}
+		if sched := s.new(); reflect.TypeOf(sched) != reflect.TypeOf(tt.sched) {
+			t.Errorf("test %d (%q): scheduler mismatch: have %T, want %T", i, tt.name, sched, tt.sched)
+		}
+	}
+}
+
+func TestRunBlocksSerial(t *testing.T) {
+	blocks := []Block{
+		{BlockNumber: "1", Transactions: []Transaction{
+			{BlockNumber: "1", TransactionHash: "0x01", ReadStateAddresses: []string{"a"}, WriteStateAddresses: []string{"b"}},
+			{BlockNumber: "1", TransactionHash: "0x02", ReadStateAddresses: []string{"b"}, WriteStateAddresses: []string{"c"}},
+		}},
+		{BlockNumber: "2", Transactions: []Transaction{
+			{BlockNumber: "2", TransactionHash: "0x03", ReadStateAddresses: []string{"c"}, WriteStateAddresses: []string{"a"}},
+		}},
+	}
+	var txs []Transaction
+	for _, block := range blocks {
+		txs = append(txs, block.Transactions...)
+	}
+	results, err := runBlocks(blocks, serialScheduler{}, newSimExecutor(txs), 1)
+	if err != nil {
+		t.Fatalf("failed to run blocks: %v", err)
+	}
+	if len(results) != len(blocks) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(blocks))
+	}
+	for i, res := range results {
+		if res.Executions != len(blocks[i].Transactions) || res.Aborts != 0 {
+			t.Errorf("block %d: have %d executions and %d aborts, want %d and 0", i, res.Executions, res.Aborts, len(blocks[i].Transactions))
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/hotcache/rwtrace"
+)
+
+// readTrace loads the transactions of a binary read/write set trace written
+// by the capture or converted with the rwtrace tool.
+func readTrace(filePath string) ([]Transaction, error) {
+	reader, err := rwtrace.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var transactions []Transaction
+	for _, number := range reader.Numbers() {
+		block, err := reader.Block(number)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Txs {
+			transactions = append(transactions, Transaction{
+				BlockNumber:         strconv.FormatUint(block.Number, 10),
+				TransactionHash:     tx.Hash.Hex(),
+				ReadStateAddresses:  rwtrace.KeyStrings(tx.Reads),
+				WriteStateAddresses: rwtrace.KeyStrings(tx.Writes),
+				ExecutionTime:       int64(tx.ExecTime),
+			})
+		}
+	}
+	return transactions, nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/csv"
 	"fmt"
 	"github.com/syndtr/goleveldb/leveldb"
+	"hash/fnv"
 	"math/rand"
 	"os"
 	"sort"
@@ -16,39 +17,41 @@ import (
 const executetime = 25 * time.Microsecond
 const delaytime = 200 * time.Microsecond
 
-// VesselTX defines the structure of a transaction, including the block number.
-type VesselTX struct {
-	BlockNumber   string
-	TransactionID string
-	From          string
-	To            string
-}
-
-// VTB defines the structure of a block, containing the block number and a slice of transactions.
-type VTB struct {
-	BlockNumber  string
-	Transactions []VesselTX
-}
-
-// groupUTXByBlock groups transactions by block number.
-func groupUTXByBlock(transactions []VesselTX) []VTB {
-	var blocks []VTB
-	blockMap := make(map[string]int) // Used to track the index of each block number in the blocks slice.
-
-	for _, tx := range transactions {
-		blockNumber := tx.BlockNumber
-		if index, exists := blockMap[blockNumber]; exists {
-			blocks[index].Transactions = append(blocks[index].Transactions, tx)
-		} else {
-			newBlock := VTB{
-				BlockNumber:  blockNumber,
-				Transactions: []VesselTX{tx},
-			}
-			blocks = append(blocks, newBlock)
-			blockMap[blockNumber] = len(blocks) - 1
+// loadVessels reads the vessel transactions from a CSV file. A vessel
+// transaction reads the vessel it spends and writes the vessel it creates, and
+// takes executetime to execute.
+func loadVessels(filePath string) ([]Transaction, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	// Create a CSV reader.
+	reader := csv.NewReader(file)
+	if _, err := reader.Read(); err != nil { // Skip the header row.
+		return nil, err
+	}
+	// Read the CSV file and create a slice of transactions.
+	var transactions []Transaction
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			break // End of file or encountered an error.
 		}
+		transactions = append(transactions, Transaction{
+			BlockNumber:         record[0],
+			TransactionHash:     record[1],
+			ReadStateAddresses:  []string{record[2]},
+			WriteStateAddresses: []string{record[3]},
+			ExecutionTime:       executetime.Nanoseconds(),
+		})
 	}
+	return transactions, nil
+}
 
+// groupUTXByBlock groups vessel transactions by block number.
+func groupUTXByBlock(transactions []Transaction) []Block {
+	blocks := groupTransactionsByBlock(transactions)
 	sort.Slice(blocks, func(i, j int) bool {
 		// Convert strings to integers for proper sorting.
 		iBlockNumber, _ := strconv.Atoi(blocks[i].BlockNumber)
@@ -58,242 +61,202 @@ func groupUTXByBlock(transactions []VesselTX) []VTB {
 	return blocks
 }
 
-func vessel_parallel_execute() {
+// vesselExecutor executes vessel transactions on the leveldb populated by
+// exp-init, deleting the spent vessel and storing the created one.
+type vesselExecutor struct {
+	db *leveldb.DB
+}
+
+// newVesselExecutor opens the database at path and stores a random value for
+// every vessel spent by the transactions.
+func newVesselExecutor(path string, transactions []Transaction) (*vesselExecutor, error) {
 	rand.Seed(time.Now().UnixNano()) // Initialize random number seed.
-	// Open the CSV file.
-	file, err := os.Open("vessel.csv")
-	defer file.Close()
 	// Open or create the database.
-	db, err := leveldb.OpenFile("../exp-init/leveldb", nil)
+	db, err := leveldb.OpenFile(path, nil)
 	if err != nil {
-		panic(err)
-	}
-	// Create a CSV reader.
-	reader := csv.NewReader(file)
-	_, err = reader.Read() // Skip the header row.
-	if err != nil {
-		panic(err)
-	}
-	// Read the CSV file and create a slice of transactions.
-	var transactions []VesselTX
-	for {
-		record, err := reader.Read()
-		if err != nil {
-			break // End of file or encountered an error.
-		}
-		tx := VesselTX{
-			BlockNumber:   record[0],
-			TransactionID: record[1],
-			From:          record[2],
-			To:            record[3],
-		}
-		transactions = append(transactions, tx)
+		return nil, err
 	}
-	// Group transactions by block number.
-	blocks := groupUTXByBlock(transactions)
 	// Initialize the vessel collection.
-	vesselMap := sync.Map{}
 	for _, tx := range transactions {
 		value := generateRandomHash(32)
-		err := db.Put([]byte(tx.From), []byte(value), nil)
-		if err != nil {
-			panic(err)
+		if err := db.Put([]byte(tx.ReadStateAddresses[0]), []byte(value), nil); err != nil {
+			db.Close()
+			return nil, err
 		}
-		vesselMap.Store(tx.From, value)
 	}
-	totalExecTime := time.Duration(0)
-	// Create the output file.
-	outputFilePath := strconv.Itoa(thread) + "vessel_execution_times_pack.csv"
-	outputFile, err := os.Create(outputFilePath)
-	if err != nil {
-		fmt.Printf("Error creating output file: %v\n", err)
-		return
-	}
-	defer outputFile.Close()
-	writer := csv.NewWriter(outputFile)
-	defer writer.Flush()
-	writer.Write([]string{"BlockNumber", "ExecutionTime(ms)"})
-	semaphore := make(chan struct{}, thread) // Control concurrency.
+	return &vesselExecutor{db: db}, nil
+}
 
-	// Iterate over blocks to process each transaction.
-	for _, block := range blocks {
-		println("vessel pack", block.BlockNumber)
-		startTime := time.Now()
-		toExecute := make([]bool, len(block.Transactions)) // Store indices of transactions to be executed or re-executed.
-		var mutex sync.RWMutex
-		last := 0
-		// Initially mark all transactions for execution.
-		for {
-			sum := 0
-			finish := true
-			wg := sync.WaitGroup{}
-			for i, executed := range toExecute {
-				if executed {
-					continue
-				}
-				sum++
-				finish = false
-				wg.Add(1)
-				go func(i int) {
-					defer wg.Done()
-					semaphore <- struct{}{} // Acquire semaphore.
-					executeVTX(i, toExecute, block.Transactions, &mutex, db)
-					<-semaphore // Release semaphore.
-				}(i)
-			}
-			wg.Wait() // Wait for all goroutines to complete.
-			if finish {
-				break
-			}
-			if sum == last {
-				break
-			}
-			last = sum
-		}
-		execTime := time.Since(startTime)
-		totalExecTime += execTime
-		writer.Write([]string{block.BlockNumber, fmt.Sprintf("%d", execTime.Milliseconds())})
-	}
+// Close closes the database.
+func (e *vesselExecutor) Close() error {
+	return e.db.Close()
+}
 
-	// Record the total execution time.
-	writer.Write([]string{"Total Execution Time", fmt.Sprintf("%d", totalExecTime.Milliseconds())})
-	// Create the output file.
-	outputFilePath = strconv.Itoa(thread) + "vessel_execution_times_val.csv"
-	outputFile, err = os.Create(outputFilePath)
-	if err != nil {
-		fmt.Printf("Error creating output file: %v\n", err)
-		return
-	}
-	defer outputFile.Close()
+// BeginBlock implements Executor. The vessels are kept across blocks.
+func (e *vesselExecutor) BeginBlock(block *Block) error {
+	return nil
+}
 
-	writer = csv.NewWriter(outputFile)
-	defer writer.Flush()
-	writer.Write([]string{"BlockNumber", "ExecutionTime(ms)"})
-	totalExecTime = time.Duration(0)
-	// Iterate over blocks to process each transaction.
-	for _, block := range blocks {
-		println("vessel validate", block.BlockNumber)
-		// Randomly select transactions to retain.
-		rand.Seed(time.Now().UnixNano())
-		rand.Shuffle(len(block.Transactions), func(i, j int) {
-			block.Transactions[i], block.Transactions[j] = block.Transactions[j], block.Transactions[i]
-		})
-		numToKeep := len(block.Transactions) / 3 // Retain one-third.
-		selectedTransactions := block.Transactions[:numToKeep]
-		startTime := time.Now()
-		tdg := NewDependencyGraph(len(selectedTransactions))
-		tdg.graph = generateDependencyGraph(selectedTransactions)
-		var wg sync.WaitGroup
-		for {
-			executable := findExecutableTransactions(tdg.graph)
-			if len(executable) <= 1 {
-				break // No more executable transactions, exit loop.
-			}
-			for _, txIndex := range executable {
-				wg.Add(1)
-				go func(index int) {
-					defer wg.Done()
-					semaphore <- struct{}{} // Acquire semaphore.
-					err := db.Delete([]byte(selectedTransactions[index].From), nil)
-					if err != nil {
-						panic(err)
-					}
-					value := generateRandomHash(32)
-					err = db.Put([]byte(selectedTransactions[index].To), []byte(value), nil)
-					if err != nil {
-						panic(err)
-					}
-					time.Sleep(executetime)
-					tdg.RemoveTransaction(index) // Remove completed transactions from the dependency graph.
-					<-semaphore                  // Release semaphore.
-				}(txIndex)
-			}
-			wg.Wait() // Wait for all executable transactions of this round to complete.
-		}
-		execTime := time.Since(startTime)
-		totalExecTime += execTime
-		writer.Write([]string{block.BlockNumber, fmt.Sprintf("%d", execTime.Milliseconds())})
-	}
-	// Record the total execution time.
-	writer.Write([]string{"Total Execution Time", fmt.Sprintf("%d", totalExecTime.Milliseconds())})
+// Attempt implements Executor. A vessel is only spent by the transaction it
+// belongs to, so the vessel scheduler orders the transactions up front and
+// attempts always commit.
+func (e *vesselExecutor) Attempt(block *Block, i int) bool {
+	e.Apply(block, i)
+	return true
 }
 
-func vessel_serial_execute() {
-	rand.Seed(time.Now().UnixNano()) // Initialize random number seed.
-	// Open the CSV file.
-	file, err := os.Open("vessel.csv")
-	defer file.Close()
-	// Open or create the database.
-	db, err := leveldb.OpenFile("../exp-init/leveldb", nil)
-	defer db.Close()
+// Apply implements Executor.
+func (e *vesselExecutor) Apply(block *Block, i int) {
+	tx := &block.Transactions[i]
+	err := e.db.Delete([]byte(tx.ReadStateAddresses[0]), nil)
 	if err != nil {
 		panic(err)
 	}
-	// Create a CSV reader.
-	reader := csv.NewReader(file)
-	_, err = reader.Read() // Skip the header row.
+	value := generateRandomHash(32)
+	err = e.db.Put([]byte(tx.WriteStateAddresses[0]), []byte(value), nil)
 	if err != nil {
 		panic(err)
 	}
-	// Read the CSV file and create a slice of transactions.
-	var transactions []VesselTX
+	time.Sleep(time.Nanosecond * time.Duration(tx.ExecutionTime))
+}
+
+// Err implements Executor, database failures panic.
+func (e *vesselExecutor) Err() error {
+	return nil
+}
+
+// vesselScheduler executes the vessel transactions of a block in rounds, every
+// transaction as soon as no other pending transaction creates a vessel of the
+// owner and token it spends. It then validates a random third of the block in
+// the order of the vessels passed between its transactions.
+type vesselScheduler struct{}
+
+// ExecuteBlock implements Scheduler.
+func (vesselScheduler) ExecuteBlock(block *Block, exec Executor, workers int) (Result, error) {
+	if err := exec.BeginBlock(block); err != nil {
+		return Result{}, err
+	}
+	semaphore := make(chan struct{}, workers) // Control concurrency.
+
+	startTime := time.Now()
+	toExecute := make([]bool, len(block.Transactions)) // Store indices of transactions to be executed or re-executed.
+	var mutex sync.RWMutex
+	last := 0
+	// Initially mark all transactions for execution.
 	for {
-		record, err := reader.Read()
-		if err != nil {
-			break // End of file or encountered an error.
+		sum := 0
+		finish := true
+		wg := sync.WaitGroup{}
+		for i, executed := range toExecute {
+			if executed {
+				continue
+			}
+			sum++
+			finish = false
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				semaphore <- struct{}{} // Acquire semaphore.
+				executeVTX(block, exec, i, toExecute, &mutex)
+				<-semaphore // Release semaphore.
+			}(i)
+		}
+		wg.Wait() // Wait for all goroutines to complete.
+		if finish {
+			break
 		}
-		tx := VesselTX{
-			BlockNumber:   record[0],
-			TransactionID: record[1],
-			From:          record[2],
-			To:            record[3],
+		if sum == last {
+			break
 		}
-		transactions = append(transactions, tx)
+		last = sum
 	}
-	// Group transactions by block number.
-	blocks := groupUTXByBlock(transactions)
-	// Initialize the vessel collection.
-	for _, tx := range transactions {
-		value := generateRandomHash(32)
-		err := db.Put([]byte(tx.From), []byte(value), nil)
-		if err != nil {
-			panic(err)
+	execTime := time.Since(startTime)
+	executions := 0
+	for _, executed := range toExecute {
+		if executed {
+			executions++
 		}
 	}
-	// Create the output file.
-	outputFilePath := "serial_vessel_execution_times.csv"
-	outputFile, err := os.Create(outputFilePath)
-	if err != nil {
-		fmt.Printf("Error creating output file: %v\n", err)
-		return
+
+	if err := exec.BeginBlock(block); err != nil {
+		return Result{}, err
+	}
+	// Randomly select transactions to retain, one-third of the block.
+	selected := rand.Perm(len(block.Transactions))[:len(block.Transactions)/3]
+	selectedTransactions := make([]Transaction, len(selected))
+	for k, i := range selected {
+		selectedTransactions[k] = block.Transactions[i]
 	}
-	defer outputFile.Close()
-	writer := csv.NewWriter(outputFile)
-	defer writer.Flush()
-	writer.Write([]string{"BlockNumber", "ExecutionTime(ms)"})
-	totalExecTime := time.Duration(0)
-	// Iterate over blocks to process each transaction.
-	for _, block := range blocks {
-		startTime := time.Now()
-		for i := range block.Transactions {
-			tx := block.Transactions[i] // Create a local variable copy for the current loop iteration.
-			err = db.Delete([]byte(tx.From), nil)
-			if err != nil {
-				panic(err)
+	startTime = time.Now()
+	tdg := NewDependencyGraph(len(selectedTransactions))
+	tdg.graph = generateDependencyGraph(selectedTransactions)
+	var wg sync.WaitGroup
+	for {
+		executable := findExecutableTransactions(tdg.graph)
+		if len(executable) == 0 {
+			break // No more executable transactions, exit loop.
+		}
+		for _, txIndex := range executable {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				semaphore <- struct{}{} // Acquire semaphore.
+				exec.Apply(block, selected[index])
+				tdg.RemoveTransaction(index) // Remove completed transactions from the dependency graph.
+				<-semaphore                  // Release semaphore.
+			}(txIndex)
+		}
+		wg.Wait() // Wait for all executable transactions of this round to complete.
+	}
+	return Result{ExecTime: execTime, ValidationTime: time.Since(startTime), Executions: executions}, nil
+}
+
+// SimulateBlock implements VirtualScheduler. The validated third of the block
+// is drawn from a random source seeded with the block number.
+func (vesselScheduler) SimulateBlock(block *Block, workers int) Result {
+	txs := block.Transactions
+	toExecute := make([]bool, len(txs))
+	var (
+		execTime   time.Duration
+		busy       time.Duration
+		last       int
+		executions int
+	)
+	for {
+		var pending []int
+		for i, executed := range toExecute {
+			if !executed {
+				pending = append(pending, i)
 			}
-			value := generateRandomHash(32)
-			err = db.Put([]byte(tx.To), []byte(value), nil)
-			if err != nil {
-				panic(err)
+		}
+		var b time.Duration
+		execTime, b = simulateRound(execTime, workers, len(pending), func(k int, now time.Duration) time.Duration {
+			i := pending[k]
+			if vesselPending(txs, toExecute, i) {
+				return 0
 			}
-			time.Sleep(executetime)
+			toExecute[i] = true
+			executions++
+			return time.Duration(txs[i].ExecutionTime)
+		}, func(int, time.Duration) {})
+		busy += b
+		if len(pending) == 0 || len(pending) == last {
+			break
 		}
-		execTime := time.Since(startTime)
-		totalExecTime += execTime
-		writer.Write([]string{block.BlockNumber, fmt.Sprintf("%d", execTime.Milliseconds())})
+		last = len(pending)
+	}
+
+	seed := fnv.New64a()
+	seed.Write([]byte(block.BlockNumber))
+	selected := rand.New(rand.NewSource(int64(seed.Sum64()))).Perm(len(txs))[:len(txs)/3]
+	selectedTransactions := make([]Transaction, len(selected))
+	for k, i := range selected {
+		selectedTransactions[k] = txs[i]
 	}
-	// Record the total execution time.
-	writer.Write([]string{"Total Execution Time", fmt.Sprintf("%d", totalExecTime.Milliseconds())})
+	tdg := NewDependencyGraph(len(selectedTransactions))
+	tdg.graph = generateDependencyGraph(selectedTransactions)
+	valiTime, valiBusy := simulateGraph(tdg, selectedTransactions, 0, workers)
+	return Result{ExecTime: execTime, ValidationTime: valiTime, Executions: executions, Busy: busy + valiBusy}
 }
 
 func generateRandomHash(length int) string {
@@ -315,24 +278,9 @@ func splitTransactionID(txID string) []string {
 }
 
 // Modify the executeVTX function to add transactions needing retry to the retry queue instead of waiting directly for retry.
-func executeVTX(index int, toExecute []bool, txs []VesselTX, lock *sync.RWMutex, db *leveldb.DB) {
-	fromParts := splitTransactionID(txs[index].From)
-
-	retry := false
+func executeVTX(block *Block, exec Executor, index int, toExecute []bool, lock *sync.RWMutex) {
 	lock.RLock()
-	for i, f := range toExecute {
-		if f {
-			continue
-		}
-		otherTxID := txs[i].TransactionID
-		otherToParts := splitTransactionID(txs[i].To)
-		if fromParts[2] == otherToParts[2] && fromParts[1] == otherToParts[1] {
-			if txs[index].TransactionID != otherTxID {
-				retry = true
-				break
-			}
-		}
-	}
+	retry := vesselPending(block.Transactions, toExecute, index)
 	lock.RUnlock()
 	if retry {
 		return
@@ -341,16 +289,26 @@ func executeVTX(index int, toExecute []bool, txs []VesselTX, lock *sync.RWMutex,
 	toExecute[index] = true
 	lock.Unlock()
 
-	err := db.Delete([]byte(txs[index].From), nil)
-	if err != nil {
-		panic(err)
-	}
-	value := generateRandomHash(32)
-	err = db.Put([]byte(txs[index].To), []byte(value), nil)
-	if err != nil {
-		panic(err)
+	exec.Apply(block, index)
+}
+
+// vesselPending reports whether a transaction not executed yet, other than the
+// one at index, creates a vessel of the owner and token spent at index.
+func vesselPending(txs []Transaction, toExecute []bool, index int) bool {
+	fromParts := splitTransactionID(txs[index].ReadStateAddresses[0])
+	for i, f := range toExecute {
+		if f {
+			continue
+		}
+		otherTxID := txs[i].TransactionHash
+		otherToParts := splitTransactionID(txs[i].WriteStateAddresses[0])
+		if fromParts[2] == otherToParts[2] && fromParts[1] == otherToParts[1] {
+			if txs[index].TransactionHash != otherTxID {
+				return true
+			}
+		}
 	}
-	time.Sleep(executetime)
+	return false
 }
 
 func canAddEdgeWithoutCycle(from, to int, graph [][]bool, n int) bool {
@@ -374,7 +332,7 @@ func canAddEdgeWithoutCycle(from, to int, graph [][]bool, n int) bool {
 	return !dfs(from)
 }
 
-func generateDependencyGraph(selectedTransactions []VesselTX) [][]bool {
+func generateDependencyGraph(selectedTransactions []Transaction) [][]bool {
 	n := len(selectedTransactions)
 	dependencyGraph := make([][]bool, n)
 	for i := range dependencyGraph {
@@ -383,7 +341,7 @@ func generateDependencyGraph(selectedTransactions []VesselTX) [][]bool {
 
 	for i, txA := range selectedTransactions {
 		for j, txB := range selectedTransactions {
-			if txA.TransactionID == txB.TransactionID && txA.To == txB.From {
+			if txA.TransactionHash == txB.TransactionHash && txA.WriteStateAddresses[0] == txB.ReadStateAddresses[0] {
 				// Check if adding this edge would result in a cycle in the graph.
 				if canAddEdgeWithoutCycle(j, i, dependencyGraph, n) {
 					dependencyGraph[j][i] = true // Edge from txB to txA exists.
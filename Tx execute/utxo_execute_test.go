@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// applyCounter counts the transactions applied since the last BeginBlock.
+type applyCounter struct {
+	applies int64
+}
+
+func (e *applyCounter) BeginBlock(block *Block) error {
+	atomic.StoreInt64(&e.applies, 0)
+	return nil
+}
+
+func (e *applyCounter) Attempt(block *Block, i int) bool {
+	e.Apply(block, i)
+	return true
+}
+
+func (e *applyCounter) Apply(block *Block, i int) {
+	atomic.AddInt64(&e.applies, 1)
+}
+
+func (e *applyCounter) Err() error { return nil }
+
+// vesselChain returns n vessel transactions of one swap, each spending the
+// vessel created by the one before.
+func vesselChain(n int) []Transaction {
+	txs := make([]Transaction, n)
+	for i := range txs {
+		txs[i] = Transaction{
+			BlockNumber:         "1",
+			TransactionHash:     "0x01",
+			ReadStateAddresses:  []string{"0x01_" + strconv.Itoa(i) + "_0xtoken"},
+			WriteStateAddresses: []string{"0x01_" + strconv.Itoa(i+1) + "_0xtoken"},
+			ExecutionTime:       executetime.Nanoseconds(),
+		}
+	}
+	return txs
+}
+
+func TestVesselValidation(t *testing.T) {
+	tests := []struct {
+		txs       int
+		validated int
+	}{
+		{txs: 2, validated: 0},
+		{txs: 3, validated: 1}, // A single transaction on the only round
+		{txs: 5, validated: 1},
+		{txs: 6, validated: 2}, // The last round holds one if both are chained
+		{txs: 9, validated: 3},
+	}
+	for i, tt := range tests {
+		block := &Block{BlockNumber: "1", Transactions: vesselChain(tt.txs)}
+		exec := new(applyCounter)
+		res, err := vesselScheduler{}.ExecuteBlock(block, exec, 4)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if res.Executions != tt.txs {
+			t.Errorf("test %d: %d executions, want %d", i, res.Executions, tt.txs)
+		}
+		if applies := atomic.LoadInt64(&exec.applies); applies != int64(tt.validated) {
+			t.Errorf("test %d: %d transactions validated, want %d", i, applies, tt.validated)
+		}
+		// The simulation keeps every worker busy for each execution
+		sim := vesselScheduler{}.SimulateBlock(block, 4)
+		if want := time.Duration(tt.txs+tt.validated) * executetime; sim.Busy != want {
+			t.Errorf("test %d: simulated busy time %v, want %v", i, sim.Busy, want)
+		}
+	}
+}
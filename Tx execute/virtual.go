@@ -0,0 +1,155 @@
+package main
+
+import (
+	"container/heap"
+	"time"
+)
+
+// VirtualScheduler is implemented by schedulers that can execute a block in
+// virtual time: the transactions are scheduled onto simulated workers and take
+// their recorded execution time without sleeping, so the results are exact and
+// reproducible. Scheduling, validation and the construction of dependency
+// graphs take no time.
+type VirtualScheduler interface {
+	// SimulateBlock executes the transactions of the block on workers
+	// simulated workers and returns the virtual times of its phases.
+	SimulateBlock(block *Block, workers int) Result
+}
+
+// vtEvent is a transaction running on a simulated worker.
+type vtEvent struct {
+	end time.Duration
+	seq int // Start order, breaks ties between transactions ending together
+	i   int
+}
+
+type vtQueue []vtEvent
+
+func (q vtQueue) Len() int { return len(q) }
+func (q vtQueue) Less(i, j int) bool {
+	if q[i].end != q[j].end {
+		return q[i].end < q[j].end
+	}
+	return q[i].seq < q[j].seq
+}
+func (q vtQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *vtQueue) Push(x interface{}) { *q = append(*q, x.(vtEvent)) }
+func (q *vtQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// simulateRound runs tasks 0 to n-1 on workers simulated workers from time
+// now, every worker taking the next task as soon as it is free, and returns
+// the time the last task ended and the time the workers were busy. start is
+// called when task i starts and returns how long it runs, finish when it ends.
+// The tasks ending at the same time finish in the order they started, and
+// before the tasks started at that time, as a worker only takes a new task
+// once it is done with the last.
+func simulateRound(now time.Duration, workers, n int, start func(i int, now time.Duration) time.Duration, finish func(i int, now time.Duration)) (time.Duration, time.Duration) {
+	var (
+		running vtQueue
+		next    int
+		seq     int
+		busy    time.Duration
+	)
+	for {
+		for len(running) < workers && next < n {
+			d := start(next, now)
+			busy += d
+			heap.Push(&running, vtEvent{end: now + d, seq: seq, i: next})
+			seq++
+			next++
+		}
+		if len(running) == 0 {
+			return now, busy
+		}
+		now = running[0].end
+		for len(running) > 0 && running[0].end == now {
+			finish(heap.Pop(&running).(vtEvent).i, now)
+		}
+	}
+}
+
+// simulateGraph executes the transactions of a dependency graph in virtual
+// time from now, in rounds of all transactions without dependencies like the
+// validation phases, and returns the time the last round ended and the time
+// the workers were busy.
+func simulateGraph(tdg *DependencyGraph, txs []Transaction, now time.Duration, workers int) (time.Duration, time.Duration) {
+	var busy time.Duration
+	for {
+		executable := findExecutableTransactions(tdg.graph)
+		if len(executable) == 0 {
+			return now, busy // No more executable transactions, exit loop
+		}
+		var b time.Duration
+		now, b = simulateRound(now, workers, len(executable), func(k int, now time.Duration) time.Duration {
+			return time.Duration(txs[executable[k]].ExecutionTime)
+		}, func(k int, now time.Duration) {
+			tdg.RemoveTransaction(executable[k])
+		})
+		busy += b
+	}
+}
+
+// simulateOCC executes the transactions of a block optimistically in virtual
+// time like the packaging phases, re-executing the aborted ones in rounds until
+// all are committed. A transaction aborts if a state item it accesses was
+// written by a transaction committed while it ran. committed is called for
+// every commit with the transactions finished so far. It returns the time the
+// last round ended, the time the workers were busy and the number of
+// executions.
+func simulateOCC(txs []Transaction, workers int, committed func(i int, finished []bool)) (time.Duration, time.Duration, int) {
+	var (
+		now        time.Duration
+		busy       time.Duration
+		executions int
+		versions   = make(map[string]int)
+		snapshots  = make([]map[string]int, len(txs))
+		finished   = make([]bool, len(txs))
+		toExecute  []int
+	)
+	for i := range txs {
+		toExecute = append(toExecute, i)
+	}
+	for len(toExecute) > 0 {
+		executions += len(toExecute)
+		var b time.Duration
+		now, b = simulateRound(now, workers, len(toExecute), func(k int, now time.Duration) time.Duration {
+			tx := &txs[toExecute[k]]
+			snapshot := make(map[string]int)
+			for _, addr := range tx.ReadStateAddresses {
+				snapshot[addr] = versions[addr]
+			}
+			for _, addr := range tx.WriteStateAddresses {
+				snapshot[addr] = versions[addr]
+			}
+			snapshots[toExecute[k]] = snapshot
+			return time.Duration(tx.ExecutionTime)
+		}, func(k int, now time.Duration) {
+			i := toExecute[k]
+			for addr, version := range snapshots[i] {
+				if versions[addr] != version {
+					return
+				}
+			}
+			for _, addr := range txs[i].WriteStateAddresses {
+				versions[addr]++
+			}
+			finished[i] = true
+			if committed != nil {
+				committed(i, finished)
+			}
+		})
+		busy += b
+		toExecute = toExecute[:0]
+		for i, done := range finished {
+			if !done {
+				toExecute = append(toExecute, i)
+			}
+		}
+	}
+	return now, busy, executions
+}
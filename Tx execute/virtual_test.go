@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimulateRound(t *testing.T) {
+	// Two workers: 0 runs 0-4, 1 runs 0-1, 2 runs 1-2 and 3 runs 2-5
+	var (
+		times    = []time.Duration{4, 1, 1, 3}
+		starts   = make([]time.Duration, len(times))
+		finished []int
+	)
+	end, busy := simulateRound(0, 2, len(times), func(i int, now time.Duration) time.Duration {
+		starts[i] = now
+		return times[i]
+	}, func(i int, now time.Duration) {
+		finished = append(finished, i)
+	})
+	if end != 5 || busy != 9 {
+		t.Errorf("round mismatch: have end %v busy %v, want 5ns and 9ns", end, busy)
+	}
+	if want := []time.Duration{0, 0, 1, 2}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("start times mismatch: have %v, want %v", starts, want)
+	}
+	if want := []int{1, 2, 0, 3}; !reflect.DeepEqual(finished, want) {
+		t.Errorf("finish order mismatch: have %v, want %v", finished, want)
+	}
+}
+
+func TestSimulateGraph(t *testing.T) {
+	txs := []Transaction{{ExecutionTime: 3}, {ExecutionTime: 2}, {ExecutionTime: 4}, {ExecutionTime: 1}}
+	tests := []struct {
+		workers  int
+		makespan time.Duration
+		busy     time.Duration
+	}{
+		// Rounds {0, 1} from 0 to 3, {2} to 7 and {3} to 8
+		{workers: 2, makespan: 8, busy: 10},
+		{workers: 4, makespan: 8, busy: 10},
+		// Rounds {0, 1} from 0 to 5, {2} to 9 and {3} to 10
+		{workers: 1, makespan: 10, busy: 10},
+	}
+	for i, tt := range tests {
+		// 2 depends on 0, 3 on 1 and 2
+		tdg := NewDependencyGraph(len(txs))
+		tdg.graph[2][0] = true
+		tdg.graph[3][1] = true
+		tdg.graph[3][2] = true
+
+		makespan, busy := simulateGraph(tdg, txs, 0, tt.workers)
+		if makespan != tt.makespan || busy != tt.busy {
+			t.Errorf("test %d: have makespan %v busy %v, want %v and %v", i, makespan, busy, tt.makespan, tt.busy)
+		}
+		if executable := findExecutableTransactions(tdg.graph); len(executable) != 0 {
+			t.Errorf("test %d: transactions %v left", i, executable)
+		}
+	}
+	// Starting later shifts the makespan only
+	tdg := NewDependencyGraph(1)
+	if makespan, busy := simulateGraph(tdg, txs[:1], 10, 1); makespan != 13 || busy != 3 {
+		t.Errorf("single transaction: have makespan %v busy %v, want 13ns and 3ns", makespan, busy)
+	}
+}
+
+func TestSimulateOCCWSI(t *testing.T) {
+	// 0 commits at 1, 1 started before and aborts at 3, then runs again
+	// until 6 and depends on 0. The validation runs 0 from 0 to 1, then 1
+	// until 4.
+	txs := []Transaction{
+		{WriteStateAddresses: []string{"a"}, ExecutionTime: 1},
+		{ReadStateAddresses: []string{"a"}, WriteStateAddresses: []string{"b"}, ExecutionTime: 3},
+	}
+	have := occwsiScheduler{}.SimulateBlock(&Block{Transactions: txs}, 2)
+	want := Result{ExecTime: 6, ValidationTime: 4, Executions: 3, Aborts: 1, Busy: 11}
+	if have != want {
+		t.Errorf("result mismatch: have %+v, want %+v", have, want)
+	}
+	// On a single worker nothing runs concurrently
+	have = occwsiScheduler{}.SimulateBlock(&Block{Transactions: txs}, 1)
+	want = Result{ExecTime: 4, ValidationTime: 4, Executions: 2, Busy: 8}
+	if have != want {
+		t.Errorf("single worker result mismatch: have %+v, want %+v", have, want)
+	}
+}
+
+func TestSimulateSerial(t *testing.T) {
+	txs := []Transaction{{ExecutionTime: 3}, {ExecutionTime: 2}, {ExecutionTime: 4}}
+	have := serialScheduler{}.SimulateBlock(&Block{Transactions: txs}, 8)
+	if want := (Result{ExecTime: 9, Executions: 3, Busy: 9}); have != want {
+		t.Errorf("result mismatch: have %+v, want %+v", have, want)
+	}
+}
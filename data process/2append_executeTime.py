@@ -4,9 +4,10 @@ import pandas as pd
 csv1_path = 'EVM_ACCESS.csv'  # Path to the first CSV file
 csv1 = pd.read_csv(csv1_path)
 
-# Preprocessing: Remove trailing ~ from the InvokeAddress, ReadStateSlot, and WriteStateSlot columns
-for column in ['InvokeAddress', 'ReadStateSlot', 'WriteStateSlot']:
-    csv1[column] = csv1[column].str.rstrip('~')
+# Preprocessing: Remove trailing ~ from the InvokeAddress and state slot columns
+for column in ['InvokeAddress', 'ReadStateSlot', 'WriteStateSlot', 'SilentWriteStateSlot', 'RevertedStateSlot']:
+    if column in csv1:
+        csv1[column] = csv1[column].str.rstrip('~')
 
 # Read the second CSV file
 csv2_path = 'EVM_ACCESSExecTime.csv'  # Path to the second CSV file
@@ -1,4 +1,5 @@
 import csv
+import os
 import sys
 
 
@@ -45,6 +46,8 @@ csv_file_paths_2_and_3 = [
     '15000001to15010000_ERC20Transaction.csv',
     '15000001to15010000_ERC721Transaction.csv'
 ]
+if os.path.exists('EVM_ACCESSTransfers.csv'):
+    csv_file_paths_2_and_3 = ['EVM_ACCESSTransfers.csv']
 input_csv_path_1 = 'transactions.csv'
 output_csv_path_part1 = 'transactions_token.csv'
 output_csv_path_part2 = 'transactions_without_token.csv'
@@ -1,14 +1,23 @@
+import os
+import sys
+
 import pandas as pd
 
-# Load two CSV files
-df1 = pd.read_csv('15000001to15010000_ERC20Transaction.csv')
-df2 = pd.read_csv('15000001to15010000_ERC721Transaction.csv')
+if os.path.exists('EVM_ACCESSTransfers.csv'):
+    df = pd.read_csv('EVM_ACCESSTransfers.csv')
+else:
+    # Load two CSV files
+    df1 = pd.read_csv('15000001to15010000_ERC20Transaction.csv')
+    df2 = pd.read_csv('15000001to15010000_ERC721Transaction.csv')
 
-# Merge two DataFrames
-df = pd.concat([df1, df2])
+    # Merge two DataFrames
+    df = pd.concat([df1, df2])
 
-# Filter data for block numbers between 15000000 and 15001500
-df_filtered = df[(df['blockNumber'] >= 15000000) & (df['blockNumber'] <= 15010000)]
+# Optionally keep only the blocks in the range given on the command line
+df_filtered = df
+if len(sys.argv) == 3:
+    block_number_min, block_number_max = int(sys.argv[1]), int(sys.argv[2])
+    df_filtered = df[(df['blockNumber'] >= block_number_min) & (df['blockNumber'] <= block_number_max)]
 
 # Initialize an empty list to store processed data
 processed_data = []
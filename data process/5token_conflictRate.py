@@ -1,3 +1,5 @@
+import os
+
 import numpy as np
 import pandas as pd
 from tqdm import tqdm
@@ -86,6 +88,8 @@ def process_block(block_data):
 
 def main():
     filenames = ['15000001to15010000_ERC20Transaction.csv', '15000001to15010000_ERC721Transaction.csv']
+    if os.path.exists('EVM_ACCESSTransfers.csv'):
+        filenames = ['EVM_ACCESSTransfers.csv']
     combined_df = pd.DataFrame()
     for filename in filenames:
         df = pd.read_csv(filename)